@@ -24,6 +24,7 @@
 package basic
 
 import (
+	"bytes"
 	"context"
 	"os"
 	"sync"
@@ -47,6 +48,10 @@ const (
 	CloseReceivedShutdownMessage = 4
 	// CloseTypeUnknown 未知原因
 	CloseTypeUnknown = 5
+	// CloseInteractionEnd 收到消息推送结束通知(INTERACTION_END), 该 conn_id 不会再有消息推送
+	CloseInteractionEnd = 6
+	// CloseServerGoingAway 服务端下线/重启/内部错误(1001, 1011, 1012, 1013), 可以重连
+	CloseServerGoingAway = 7
 )
 
 type StartResp interface {
@@ -81,11 +86,17 @@ type WsClient struct {
 	startResp StartResp // 启动app的返回信息
 	authed    bool      // 是否已经鉴权
 
-	onClose WsClientCloseCallback // 关闭回调
+	onClose   WsClientCloseCallback // 关闭回调
+	reconnect *ReconnectPolicy      // 重连策略, 为空时不自动重连
 
+	ctx       context.Context // 调用者传入的 context, 结束时会主动关闭链接
+	mu        sync.Mutex
 	closeWait sync.WaitGroup
 	once      *sync.Once
 	cancel    context.CancelFunc
+
+	stopped  chan struct{} // 调用者主动关闭后 close, 用于打断重连
+	stopOnce sync.Once
 }
 
 func NewWsClient(startResp StartResp, dispatcherHandleMap DispatcherHandleMap, logger *slog.Logger) *WsClient {
@@ -97,6 +108,7 @@ func NewWsClient(startResp StartResp, dispatcherHandleMap DispatcherHandleMap, l
 
 		closeWait: sync.WaitGroup{},
 		once:      &sync.Once{},
+		stopped:   make(chan struct{}),
 	}).initDispatcherHandleMap(dispatcherHandleMap)
 }
 
@@ -117,6 +129,13 @@ func (wsClient *WsClient) WithOnClose(onClose WsClientCloseCallback) *WsClient {
 	return wsClient
 }
 
+// WithReconnect 启用自动重连
+// 启用后, 非终止类型的关闭会按照策略自动重连, onClose 只会在最终放弃重连或终止关闭时触发
+func (wsClient *WsClient) WithReconnect(policy *ReconnectPolicy) *WsClient {
+	wsClient.reconnect = policy
+	return wsClient
+}
+
 func (wsClient *WsClient) initDispatcherHandleMap(dispatcherHandleMap DispatcherHandleMap) *WsClient {
 	wsClient.dispatcher = DispatcherHandleMap{
 		proto.OperationUserAuthenticationReply: authResp,
@@ -130,25 +149,46 @@ func (wsClient *WsClient) initDispatcherHandleMap(dispatcherHandleMap Dispatcher
 	return wsClient
 }
 
+// Close 主动关闭, 同时会终止正在进行的重连
 func (wsClient *WsClient) Close() error {
+	wsClient.stopOnce.Do(func() {
+		close(wsClient.stopped)
+	})
+
 	return wsClient.CloseWithType(CloseActively)
 }
 
 func (wsClient *WsClient) CloseWithType(t int) (err error) {
 	wsClient.logger.Info("ws client close", slog.Int("close_type", t))
 
-	wsClient.once.Do(func() {
-		_ = wsClient.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
-		wsClient.cancel()
+	wsClient.mu.Lock()
+	once := wsClient.once
+	cancel := wsClient.cancel
+	conn := wsClient.conn
+	wsClient.mu.Unlock()
+
+	once.Do(func() {
+		// 链接失败(如重连失败)时没有可关闭的链接, 最终的关闭回调由重连流程负责
+		if conn == nil {
+			return
+		}
+
+		_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		if cancel != nil {
+			cancel()
+		}
 
 		// 等待事件处理完毕
 		wsClient.closeWait.Wait()
-		err = wsClient.conn.Close()
+		err = conn.Close()
 
-		// 关闭回调
-		if wsClient.onClose != nil {
-			wsClient.onClose(wsClient, wsClient.startResp, t)
+		// 按照策略重连
+		if wsClient.reconnect != nil && !wsClient.isStopped() && wsClient.reconnect.shouldReconnect(t) {
+			go wsClient.reconnectLoop(t)
+			return
 		}
+
+		wsClient.onClosed(wsClient.startResp, t)
 	})
 
 	if err != nil {
@@ -157,34 +197,92 @@ func (wsClient *WsClient) CloseWithType(t int) (err error) {
 	return err
 }
 
+// onClosed 关闭回调
+func (wsClient *WsClient) onClosed(startResp StartResp, t int) {
+	if wsClient.onClose != nil {
+		wsClient.onClose(wsClient, startResp, t)
+	}
+}
+
+func (wsClient *WsClient) isStopped() bool {
+	select {
+	case <-wsClient.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// Reconnection 使用新的 startResp 重新链接
+// 沿用上一次 StartCtx / RunCtx 传入的 context
 func (wsClient *WsClient) Reconnection(startResp StartResp) error {
 	wsClient.startResp = startResp
 	wsClient.Reset()
 
-	if err := wsClient.Dial(startResp.GetLinks()...); err != nil {
+	return wsClient.StartCtx(wsClient.context())
+}
+
+func (wsClient *WsClient) Reset() {
+	wsClient.mu.Lock()
+	defer wsClient.mu.Unlock()
+
+	wsClient.conn = nil
+	wsClient.closeWait = sync.WaitGroup{}
+	wsClient.once = &sync.Once{}
+	wsClient.authed = false
+	wsClient.cancel = nil
+}
+
+// Start 链接, 鉴权并开始处理消息
+func (wsClient *WsClient) Start() error {
+	return wsClient.StartCtx(context.Background())
+}
+
+// StartCtx 链接, 鉴权并开始处理消息
+// ctx 结束时会主动关闭链接, 并终止正在进行的重连
+func (wsClient *WsClient) StartCtx(ctx context.Context) error {
+	if err := wsClient.DialCtx(ctx, wsClient.startResp.GetLinks()...); err != nil {
 		return err
 	}
 
 	if err := wsClient.SendAuth(); err != nil {
+		_ = wsClient.conn.Close()
 		return err
 	}
 
-	wsClient.Run()
+	wsClient.RunCtx(ctx)
 	return nil
 }
 
-func (wsClient *WsClient) Reset() {
-	wsClient.closeWait = sync.WaitGroup{}
-	wsClient.once = &sync.Once{}
-	wsClient.authed = false
-	wsClient.cancel = nil
+func (wsClient *WsClient) context() context.Context {
+	wsClient.mu.Lock()
+	defer wsClient.mu.Unlock()
+
+	if wsClient.ctx == nil {
+		return context.Background()
+	}
+
+	return wsClient.ctx
 }
 
 // Dial 链接
 func (wsClient *WsClient) Dial(links ...string) error {
-	var err error
+	return wsClient.DialCtx(context.Background(), links...)
+}
+
+// DialCtx 链接, 支持传入 context
+func (wsClient *WsClient) DialCtx(ctx context.Context, links ...string) error {
+	var (
+		conn *websocket.Conn
+		err  error
+	)
 	for _, link := range links {
-		wsClient.conn, _, err = websocket.DefaultDialer.Dial(link, nil)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = ctxErr
+			break
+		}
+
+		conn, _, err = websocket.DefaultDialer.DialContext(ctx, link, nil)
 		if err != nil {
 			wsClient.logger.Error("websocket dial fail", slog.String("link", link), slog.String("err", err.Error()))
 			continue
@@ -192,6 +290,14 @@ func (wsClient *WsClient) Dial(links ...string) error {
 		break
 	}
 
+	if err == nil && conn == nil {
+		err = errors.New("no available link")
+	}
+
+	wsClient.mu.Lock()
+	wsClient.conn = conn
+	wsClient.mu.Unlock()
+
 	if err != nil {
 		return errors.Wrapf(err, "websocket dial fail. links:%v", links)
 	}
@@ -203,7 +309,6 @@ func (wsClient *WsClient) Dial(links ...string) error {
 // eventLoop 处理事件
 func (wsClient *WsClient) eventLoop(ctx context.Context) {
 	wsClient.logger.Info("ws event loop start")
-	wsClient.closeWait.Add(1)
 
 	defer func() {
 		wsClient.logger.Info("ws event loop stop")
@@ -237,13 +342,33 @@ func (wsClient *WsClient) eventLoop(ctx context.Context) {
 					wsClient.logger.Error("handle msg fail", slog.String("err", err.Error()))
 				}
 			}
+
+			if msg.Operation() == proto.OperationMessage && isInteractionEnd(msg.Payload()) {
+				wsClient.logger.Info("received interaction end")
+				go wsClient.CloseWithType(CloseInteractionEnd)
+				return
+			}
 		}
 	}
 }
 
+// isInteractionEnd 是否为消息推送结束通知
+// 先做字节匹配, 避免每条消息都额外解析一次
+func isInteractionEnd(payload []byte) bool {
+	if !bytes.Contains(payload, []byte("_INTERACTION_END")) {
+		return false
+	}
+
+	cmd, err := proto.ParseCmd(payload)
+	if err != nil {
+		return false
+	}
+
+	return cmd.Cmd == proto.CmdLiveOpenPlatformInteractionEnd || cmd.Cmd == proto.CmdLiveRoomInteractionEnd
+}
+
 func (wsClient *WsClient) readMessage(ctx context.Context) {
 	wsClient.logger.Info("ws read message start")
-	wsClient.closeWait.Add(1)
 
 	defer func() {
 		wsClient.logger.Info("ws read message stop")
@@ -266,7 +391,13 @@ func (wsClient *WsClient) readMessage(ctx context.Context) {
 
 			// 读取err or read close message 会导致关闭链接
 			msgType, buf, err := wsClient.conn.ReadMessage()
+			var closeErr *websocket.CloseError
 			switch {
+			case errors.As(err, &closeErr) && closeErr.Code != websocket.CloseAbnormalClosure:
+				// gorilla/websocket 收到关闭帧时以 *websocket.CloseError 返回, 1006 表示链接异常断开而非关闭帧
+				wsClient.logger.Info("received shutdown message", slog.Int("close_code", closeErr.Code), slog.String("close_text", closeErr.Text))
+				go wsClient.CloseWithType(closeTypeOfCode(closeErr.Code))
+				return
 			case err != nil:
 				isReadingErr = err
 				continue
@@ -285,21 +416,58 @@ func (wsClient *WsClient) readMessage(ctx context.Context) {
 				}
 
 				for i := 0; i < len(msgList); i++ {
-					wsClient.msgChan <- &msgList[i]
+					select {
+					case wsClient.msgChan <- &msgList[i]:
+					case <-ctx.Done():
+						return
+					}
 				}
 			}
 		}
 	}
 }
 
+// closeTypeOfCode 根据关闭帧的状态码确定关闭类型
+// 服务端下线, 重启以及内部错误属于临时性关闭, 交由重连策略处理, 其余视为明确的关闭
+func closeTypeOfCode(code int) int {
+	switch code {
+	case websocket.CloseGoingAway, websocket.CloseInternalServerErr, websocket.CloseServiceRestart, websocket.CloseTryAgainLater:
+		return CloseServerGoingAway
+	}
+
+	return CloseReceivedShutdownMessage
+}
+
 func (wsClient *WsClient) Run() {
+	wsClient.RunCtx(context.Background())
+}
+
+// RunCtx 开始读取与处理消息
+// parent 结束时会主动关闭链接, 等同于调用 Close
+func (wsClient *WsClient) RunCtx(parent context.Context) {
 	ctx, cancel := context.WithCancel(context.Background())
+	wsClient.mu.Lock()
+	wsClient.ctx = parent
 	wsClient.cancel = cancel
+	wsClient.mu.Unlock()
+
+	// 需要在启动前 Add, 避免 CloseWithType 中的 Wait 提前返回
+	wsClient.closeWait.Add(2)
 
 	// 读取信息
 	go wsClient.readMessage(ctx)
 	// 处理事件
 	go wsClient.eventLoop(ctx)
+
+	if parent.Done() != nil {
+		go func() {
+			select {
+			case <-parent.Done():
+				_ = wsClient.Close()
+			case <-ctx.Done():
+			}
+		}()
+	}
 }
 
 // SendMessage 发送消息
@@ -344,15 +512,32 @@ func StartWebsocket(
 		logger).
 		WithOnClose(onCloseFunc)
 
-	if err := wsClient.Dial(startResp.GetLinks()...); err != nil {
+	if err := wsClient.Start(); err != nil {
 		return nil, err
 	}
 
-	if err := wsClient.SendAuth(); err != nil {
+	return wsClient, nil
+}
+
+// StartWebsocketCtx 启动websocket, 支持传入 context
+// ctx 结束时会主动关闭链接
+func StartWebsocketCtx(
+	ctx context.Context,
+	startResp StartResp,
+	dispatcherHandleMap DispatcherHandleMap,
+	onCloseFunc WsClientCloseCallback,
+	logger *slog.Logger,
+) (*WsClient, error) {
+	wsClient := NewWsClient(
+		startResp,
+		dispatcherHandleMap,
+		logger).
+		WithOnClose(onCloseFunc)
+
+	if err := wsClient.StartCtx(ctx); err != nil {
 		return nil, err
 	}
 
-	wsClient.Run()
 	return wsClient, nil
 }
 
@@ -0,0 +1,491 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package basic
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/vtb-link/bianka/proto"
+	"golang.org/x/exp/slog"
+)
+
+type testStartResp struct {
+	authBody string
+	links    []string
+}
+
+func (r *testStartResp) GetAuthBody() []byte {
+	return []byte(r.authBody)
+}
+
+func (r *testStartResp) GetLinks() []string {
+	return r.links
+}
+
+// testWsServer 本地websocket服务, 完成鉴权后交给 handle 处理
+type testWsServer struct {
+	*httptest.Server
+
+	conns  int32
+	mu     sync.Mutex
+	bodies []string
+}
+
+func newTestWsServer(t *testing.T, handle func(n int, conn *websocket.Conn)) *testWsServer {
+	srv := &testWsServer{}
+	upgrader := websocket.Upgrader{}
+
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&srv.conns, 1))
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade fail: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		_, buf, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		msgList, err := proto.UnpackMessage(buf)
+		if err != nil || len(msgList) != 1 || msgList[0].Operation() != proto.OperationUserAuthentication {
+			t.Errorf("unexpected auth message: %v", err)
+			return
+		}
+
+		srv.mu.Lock()
+		srv.bodies = append(srv.bodies, string(msgList[0].Payload()))
+		srv.mu.Unlock()
+
+		reply := proto.PackMessage(proto.HeaderDefaultSequence, proto.OperationUserAuthenticationReply, []byte(`{"code":0}`))
+		if err := conn.WriteMessage(websocket.BinaryMessage, reply.ToBytes()); err != nil {
+			return
+		}
+
+		handle(n, conn)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func (srv *testWsServer) startResp(authBody string) *testStartResp {
+	return &testStartResp{
+		authBody: authBody,
+		links:    []string{"ws" + strings.TrimPrefix(srv.URL, "http")},
+	}
+}
+
+func (srv *testWsServer) authBodies() []string {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	return append([]string(nil), srv.bodies...)
+}
+
+// drop 不发送关闭帧直接断开
+func drop(conn *websocket.Conn) {
+	_ = conn.UnderlyingConn().Close()
+}
+
+// hold 保持链接直到对端关闭
+func hold(conn *websocket.Conn) {
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func testReconnectPolicy(maxAttempts int) *ReconnectPolicy {
+	return &ReconnectPolicy{
+		Backoff: Backoff{
+			InitialInterval: time.Millisecond * 10,
+			MaxInterval:     time.Millisecond * 50,
+			Multiplier:      2,
+			Jitter:          0.2,
+		},
+		MaxAttempts: maxAttempts,
+	}
+}
+
+func waitClose(t *testing.T, closeCh <-chan int) int {
+	t.Helper()
+
+	select {
+	case closeType := <-closeCh:
+		return closeType
+	case <-time.After(time.Second * 5):
+		t.Fatal("wait close callback timeout")
+		return 0
+	}
+}
+
+func TestWsClient_Reconnect(t *testing.T) {
+	connected := make(chan int, 8)
+	srv := newTestWsServer(t, func(n int, conn *websocket.Conn) {
+		connected <- n
+		if n < 3 {
+			drop(conn)
+			return
+		}
+		hold(conn)
+	})
+
+	var refreshed int32
+	policy := testReconnectPolicy(5).WithRefreshStartResp(func(_ context.Context, _ StartResp, closeType int) (StartResp, error) {
+		if closeType != CloseReadingConnError {
+			t.Errorf("unexpected close type %d", closeType)
+		}
+
+		n := atomic.AddInt32(&refreshed, 1)
+		return srv.startResp("auth-" + string(rune('0'+n))), nil
+	})
+
+	var reconnected int32
+	policy.OnReconnect = func(_ *WsClient, _ int, err error) {
+		if err == nil {
+			atomic.AddInt32(&reconnected, 1)
+		}
+	}
+
+	closeCh := make(chan int, 1)
+	wsClient := NewWsClient(srv.startResp("auth-0"), nil, testLogger()).
+		WithOnClose(func(_ *WsClient, _ StartResp, closeType int) {
+			closeCh <- closeType
+		}).
+		WithReconnect(policy)
+
+	if err := wsClient.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		select {
+		case n := <-connected:
+			if n != i {
+				t.Fatalf("unexpected connection %d, expected %d", n, i)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatalf("wait connection %d timeout", i)
+		}
+	}
+
+	if got := srv.authBodies(); strings.Join(got, ",") != "auth-0,auth-1,auth-2" {
+		t.Fatalf("unexpected auth bodies %v", got)
+	}
+
+	select {
+	case closeType := <-closeCh:
+		t.Fatalf("close callback should not be called while reconnecting, got %d", closeType)
+	default:
+	}
+
+	if err := wsClient.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if closeType := waitClose(t, closeCh); closeType != CloseActively {
+		t.Fatalf("unexpected close type %d", closeType)
+	}
+
+	if n := atomic.LoadInt32(&reconnected); n != 2 {
+		t.Fatalf("unexpected reconnect count %d", n)
+	}
+}
+
+func TestWsClient_ReconnectGiveUp(t *testing.T) {
+	srv := newTestWsServer(t, func(_ int, conn *websocket.Conn) {
+		drop(conn)
+	})
+
+	// 之后的重连全部指向一个已关闭的地址
+	deadSrv := httptest.NewServer(http.NotFoundHandler())
+	deadLinks := []string{"ws" + strings.TrimPrefix(deadSrv.URL, "http")}
+	deadSrv.Close()
+
+	policy := testReconnectPolicy(3).WithRefreshStartResp(func(_ context.Context, _ StartResp, _ int) (StartResp, error) {
+		return &testStartResp{authBody: "auth", links: deadLinks}, nil
+	})
+
+	var attempts int32
+	policy.OnReconnect = func(_ *WsClient, _ int, err error) {
+		if err == nil {
+			t.Error("reconnect should fail")
+		}
+		atomic.AddInt32(&attempts, 1)
+	}
+
+	closeCh := make(chan int, 1)
+	wsClient := NewWsClient(srv.startResp("auth"), nil, testLogger()).
+		WithOnClose(func(_ *WsClient, _ StartResp, closeType int) {
+			closeCh <- closeType
+		}).
+		WithReconnect(policy)
+
+	if err := wsClient.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	if closeType := waitClose(t, closeCh); closeType != CloseReadingConnError {
+		t.Fatalf("unexpected close type %d", closeType)
+	}
+
+	if n := atomic.LoadInt32(&attempts); n != 3 {
+		t.Fatalf("unexpected attempts %d", n)
+	}
+}
+
+func TestWsClient_TerminalCloseType(t *testing.T) {
+	srv := newTestWsServer(t, func(_ int, conn *websocket.Conn) {
+		_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "bye"))
+		hold(conn)
+	})
+
+	policy := testReconnectPolicy(3)
+	policy.OnReconnect = func(_ *WsClient, _ int, _ error) {
+		t.Error("terminal close type should not reconnect")
+	}
+
+	closeCh := make(chan int, 1)
+	wsClient := NewWsClient(srv.startResp("auth"), nil, testLogger()).
+		WithOnClose(func(_ *WsClient, _ StartResp, closeType int) {
+			closeCh <- closeType
+		}).
+		WithReconnect(policy)
+
+	if err := wsClient.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	if closeType := waitClose(t, closeCh); closeType != CloseReceivedShutdownMessage {
+		t.Fatalf("unexpected close type %d", closeType)
+	}
+
+	if n := atomic.LoadInt32(&srv.conns); n != 1 {
+		t.Fatalf("unexpected connections %d", n)
+	}
+}
+
+func TestWsClient_ReconnectOnServerRestart(t *testing.T) {
+	for _, code := range []int{websocket.CloseGoingAway, websocket.CloseInternalServerErr, websocket.CloseServiceRestart} {
+		code := code
+		t.Run(strconv.Itoa(code), func(t *testing.T) {
+			connected := make(chan int, 4)
+			srv := newTestWsServer(t, func(n int, conn *websocket.Conn) {
+				connected <- n
+				if n == 1 {
+					_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, "restart"))
+				}
+				hold(conn)
+			})
+
+			policy := testReconnectPolicy(3).WithRefreshStartResp(func(_ context.Context, startResp StartResp, closeType int) (StartResp, error) {
+				if closeType != CloseServerGoingAway {
+					t.Errorf("unexpected close type %d", closeType)
+				}
+				return startResp, nil
+			})
+
+			closeCh := make(chan int, 1)
+			wsClient := NewWsClient(srv.startResp("auth"), nil, testLogger()).
+				WithOnClose(func(_ *WsClient, _ StartResp, closeType int) {
+					closeCh <- closeType
+				}).
+				WithReconnect(policy)
+
+			if err := wsClient.Start(); err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 1; i <= 2; i++ {
+				select {
+				case <-connected:
+				case <-time.After(time.Second * 5):
+					t.Fatalf("wait connection %d timeout", i)
+				}
+			}
+
+			if err := wsClient.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if closeType := waitClose(t, closeCh); closeType != CloseActively {
+				t.Fatalf("unexpected close type %d", closeType)
+			}
+		})
+	}
+}
+
+func TestWsClient_CloseAfterReconnectFail(t *testing.T) {
+	srv := newTestWsServer(t, func(_ int, conn *websocket.Conn) {
+		drop(conn)
+	})
+
+	deadSrv := httptest.NewServer(http.NotFoundHandler())
+	deadLinks := []string{"ws" + strings.TrimPrefix(deadSrv.URL, "http")}
+	deadSrv.Close()
+
+	policy := testReconnectPolicy(0).WithRefreshStartResp(func(_ context.Context, _ StartResp, _ int) (StartResp, error) {
+		return &testStartResp{authBody: "auth", links: deadLinks}, nil
+	})
+
+	failed := make(chan struct{}, 1)
+	policy.OnReconnect = func(_ *WsClient, _ int, err error) {
+		if err != nil {
+			select {
+			case failed <- struct{}{}:
+			default:
+			}
+		}
+	}
+
+	closeCh := make(chan int, 2)
+	wsClient := NewWsClient(srv.startResp("auth"), nil, testLogger()).
+		WithOnClose(func(_ *WsClient, _ StartResp, closeType int) {
+			closeCh <- closeType
+		}).
+		WithReconnect(policy)
+
+	if err := wsClient.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-failed:
+	case <-time.After(time.Second * 5):
+		t.Fatal("wait reconnect fail timeout")
+	}
+
+	// 重连失败后链接为空, 关闭不应 panic
+	if err := wsClient.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if closeType := waitClose(t, closeCh); closeType != CloseActively {
+		t.Fatalf("unexpected close type %d", closeType)
+	}
+}
+
+func TestBackoff_Duration(t *testing.T) {
+	b := Backoff{
+		InitialInterval: time.Second,
+		MaxInterval:     time.Second * 5,
+		Multiplier:      2,
+	}
+
+	expected := []time.Duration{time.Second, time.Second * 2, time.Second * 4, time.Second * 5, time.Second * 5}
+	for i, want := range expected {
+		if got := b.Duration(i + 1); got != want {
+			t.Fatalf("attempt %d: got %s, want %s", i+1, got, want)
+		}
+	}
+
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := b.Duration(1); got < time.Second/2 || got > time.Second*3/2 {
+			t.Fatalf("jitter out of range: %s", got)
+		}
+	}
+}
+
+func TestWsClient_StartCtxCancel(t *testing.T) {
+	srv := newTestWsServer(t, func(_ int, conn *websocket.Conn) {
+		hold(conn)
+	})
+
+	closeCh := make(chan int, 1)
+	wsClient := NewWsClient(srv.startResp("auth"), nil, testLogger()).
+		WithOnClose(func(_ *WsClient, _ StartResp, closeType int) {
+			closeCh <- closeType
+		}).
+		WithReconnect(testReconnectPolicy(3))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := wsClient.StartCtx(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+
+	if closeType := waitClose(t, closeCh); closeType != CloseActively {
+		t.Fatalf("unexpected close type %d", closeType)
+	}
+}
+
+func TestWsClient_InteractionEnd(t *testing.T) {
+	srv := newTestWsServer(t, func(n int, conn *websocket.Conn) {
+		msg := proto.PackMessage(proto.HeaderDefaultSequence, proto.OperationMessage,
+			[]byte(`{"cmd":"OPEN_LIVEROOM_INTERACTION_END","data":{"conn_id":"conn","timestamp":1700000000}}`))
+		if err := conn.WriteMessage(websocket.BinaryMessage, msg.ToBytes()); err != nil {
+			return
+		}
+		hold(conn)
+	})
+
+	received := make(chan string, 1)
+	router := NewEventRouter().OnInteractionEnd(func(data *proto.CmdInteractionEndData) {
+		received <- data.ConnID
+	})
+
+	closeCh := make(chan int, 1)
+	wsClient := NewWsClient(srv.startResp("auth"), router.DispatcherHandleMap(), testLogger()).
+		WithOnClose(func(_ *WsClient, _ StartResp, closeType int) {
+			closeCh <- closeType
+		}).
+		WithReconnect(testReconnectPolicy(3))
+
+	if err := wsClient.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	if closeType := waitClose(t, closeCh); closeType != CloseInteractionEnd {
+		t.Fatalf("unexpected close type %d", closeType)
+	}
+
+	if connID := <-received; connID != "conn" {
+		t.Fatalf("unexpected conn id %s", connID)
+	}
+
+	if conns := atomic.LoadInt32(&srv.conns); conns != 1 {
+		t.Fatalf("should not reconnect, conns: %d", conns)
+	}
+}
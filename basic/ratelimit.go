@@ -0,0 +1,246 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package basic
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	ierrors "github.com/vtb-link/bianka/errors"
+)
+
+// ErrRateLimitExceeded 本地限流, 仅在 RateLimitModeFailFast 下返回
+var ErrRateLimitExceeded = errors.New("rate limit exceeded")
+
+// RateLimitMode 触发限流时的处理方式
+type RateLimitMode int
+
+const (
+	RateLimitModeWait     RateLimitMode = iota // 阻塞等待, 直到获取令牌或 context 结束
+	RateLimitModeFailFast                      // 立即返回 ErrRateLimitExceeded
+)
+
+// RateLimit 令牌桶配置
+type RateLimit struct {
+	QPS   float64 // 每秒生成的令牌数, 小于等于0表示不限制
+	Burst int     // 桶容量, 小于1时按1处理
+}
+
+// DefaultRateLimitPenalty 默认的限流惩罚
+// 收到限流错误后暂停该分组 1s, 连续限流时翻倍, 最多30s
+func DefaultRateLimitPenalty() Backoff {
+	return Backoff{
+		InitialInterval: time.Second,
+		MaxInterval:     time.Second * 30,
+		Multiplier:      2,
+		Jitter:          0.2,
+	}
+}
+
+// RateLimiter 按分组限流的令牌桶
+// 每个分组独立计算, 未单独配置的分组使用 Default, Default 为空时不限制
+// 通过 Report 反馈请求结果, 收到限流错误(errors.ErrRateLimited)时按照 Penalty 暂停该分组, 请求成功后恢复
+// 配置需要在使用前完成
+type RateLimiter struct {
+	Mode    RateLimitMode
+	Default *RateLimit
+	Groups  map[string]RateLimit
+
+	// Penalty 收到限流错误后的暂停时间, 第 n 次连续限流暂停 Penalty.Duration(n)
+	// InitialInterval 为0时不暂停
+	Penalty Backoff
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// NewRateLimiter 创建限流器, 默认阻塞等待, 使用 DefaultRateLimitPenalty
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		Mode:    RateLimitModeWait,
+		Groups:  map[string]RateLimit{},
+		Penalty: DefaultRateLimitPenalty(),
+		buckets: map[string]*tokenBucket{},
+	}
+}
+
+// WithMode 设置触发限流时的处理方式
+func (rl *RateLimiter) WithMode(mode RateLimitMode) *RateLimiter {
+	rl.Mode = mode
+	return rl
+}
+
+// WithDefaultLimit 设置未单独配置的分组的限制
+func (rl *RateLimiter) WithDefaultLimit(qps float64, burst int) *RateLimiter {
+	rl.Default = &RateLimit{QPS: qps, Burst: burst}
+	return rl
+}
+
+// WithGroupLimit 设置分组的限制
+func (rl *RateLimiter) WithGroupLimit(group string, qps float64, burst int) *RateLimiter {
+	if rl.Groups == nil {
+		rl.Groups = map[string]RateLimit{}
+	}
+
+	rl.Groups[group] = RateLimit{QPS: qps, Burst: burst}
+	return rl
+}
+
+// WithPenalty 设置收到限流错误后的暂停时间
+func (rl *RateLimiter) WithPenalty(penalty Backoff) *RateLimiter {
+	rl.Penalty = penalty
+	return rl
+}
+
+// bucket 获取分组的令牌桶, 需要持有 mu
+func (rl *RateLimiter) bucket(group string, now time.Time) *tokenBucket {
+	if b, ok := rl.buckets[group]; ok {
+		return b
+	}
+
+	limit, ok := rl.Groups[group]
+	if !ok && rl.Default != nil {
+		limit = *rl.Default
+	}
+
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+
+	b := &tokenBucket{limit: limit, tokens: float64(limit.Burst), last: now}
+	if rl.buckets == nil {
+		rl.buckets = map[string]*tokenBucket{}
+	}
+	rl.buckets[group] = b
+
+	return b
+}
+
+// Wait 获取分组的一个令牌
+// RateLimitModeWait 下阻塞直到获取成功或 ctx 结束, RateLimitModeFailFast 下无法立即获取时返回 ErrRateLimitExceeded
+// rl 为空时不限制
+func (rl *RateLimiter) Wait(ctx context.Context, group string) error {
+	if rl == nil {
+		return nil
+	}
+
+	for {
+		now := time.Now()
+		rl.mu.Lock()
+		delay := rl.bucket(group, now).reserve(now)
+		rl.mu.Unlock()
+
+		if delay <= 0 {
+			return nil
+		}
+
+		if rl.Mode == RateLimitModeFailFast {
+			return errors.Wrapf(ErrRateLimitExceeded, "group:%s retry after:%s", group, delay)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Report 反馈分组的请求结果
+// err 为限流错误时暂停该分组, 为空时清除连续限流次数, 其他错误忽略
+func (rl *RateLimiter) Report(group string, err error) {
+	if rl == nil || (err != nil && !errors.Is(err, ierrors.ErrRateLimited)) {
+		return
+	}
+
+	now := time.Now()
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	b := rl.bucket(group, now)
+	if err == nil {
+		b.strikes = 0
+		return
+	}
+
+	b.strikes++
+	if rl.Penalty.InitialInterval > 0 {
+		// 暂停结束后只保留一个令牌用于试探
+		b.pausedUntil = now.Add(rl.Penalty.Duration(b.strikes))
+		b.tokens = 1
+		b.last = b.pausedUntil
+	}
+}
+
+// Do 获取令牌后执行 fn, 并反馈结果
+// rl 为空时直接执行 fn
+func (rl *RateLimiter) Do(ctx context.Context, group string, fn func() error) error {
+	if err := rl.Wait(ctx, group); err != nil {
+		return err
+	}
+
+	err := fn()
+	rl.Report(group, err)
+
+	return err
+}
+
+type tokenBucket struct {
+	limit       RateLimit
+	tokens      float64
+	last        time.Time
+	strikes     int       // 连续限流次数
+	pausedUntil time.Time // 暂停截止时间
+}
+
+// reserve 尝试获取一个令牌, 成功返回0, 否则返回需要等待的时间
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	if now.Before(b.pausedUntil) {
+		return b.pausedUntil.Sub(now)
+	}
+
+	if b.limit.QPS <= 0 {
+		return 0
+	}
+
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed.Seconds()*b.limit.QPS)
+	}
+
+	if b.last.Before(now) {
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) / b.limit.QPS * float64(time.Second))
+}
@@ -0,0 +1,144 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package basic
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	ierrors "github.com/vtb-link/bianka/errors"
+)
+
+func TestRateLimiter_Wait(t *testing.T) {
+	rl := NewRateLimiter().
+		WithDefaultLimit(20, 2).
+		WithGroupLimit("unlimited", 0, 0)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := rl.Wait(context.Background(), "default"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// burst 为2, 第三次需要等待约 50ms
+	if elapsed := time.Since(start); elapsed < time.Millisecond*40 {
+		t.Fatalf("third token should wait, elapsed %s", elapsed)
+	}
+
+	start = time.Now()
+	for i := 0; i < 100; i++ {
+		if err := rl.Wait(context.Background(), "unlimited"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Millisecond*200 {
+		t.Fatalf("unlimited group should not wait, elapsed %s", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	_ = rl.WithGroupLimit("slow", 0.1, 1).Wait(ctx, "slow")
+	if err := rl.Wait(ctx, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	var nilLimiter *RateLimiter
+	if err := nilLimiter.Do(context.Background(), "any", func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRateLimiter_FailFast(t *testing.T) {
+	rl := NewRateLimiter().
+		WithMode(RateLimitModeFailFast).
+		WithGroupLimit("start", 1, 1)
+
+	if err := rl.Wait(context.Background(), "start"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := rl.Wait(context.Background(), "start")
+	if !errors.Is(err, ErrRateLimitExceeded) {
+		t.Fatalf("expected ErrRateLimitExceeded, got %v", err)
+	}
+
+	if DefaultRetryable(err) {
+		t.Fatal("local rate limit should not be retried")
+	}
+
+	// 其他分组不受影响
+	if err = rl.Wait(context.Background(), "heartbeat"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRateLimiter_Penalty(t *testing.T) {
+	rl := NewRateLimiter().
+		WithMode(RateLimitModeFailFast).
+		WithPenalty(Backoff{InitialInterval: time.Millisecond * 20, Multiplier: 2})
+
+	rateLimited := &ierrors.APIError{Platform: ierrors.PlatformOpenLive, HTTPStatus: 200, Code: 7001}
+	calls := 0
+	fn := func() error {
+		calls++
+		return rateLimited
+	}
+
+	if err := rl.Do(context.Background(), "start", fn); !errors.Is(err, ierrors.ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+
+	if err := rl.Do(context.Background(), "start", fn); !errors.Is(err, ErrRateLimitExceeded) || calls != 1 {
+		t.Fatalf("group should be paused, err %v calls %d", err, calls)
+	}
+
+	// 其他错误不会触发暂停
+	rl.Report("other", errors.New("connection reset"))
+	if err := rl.Wait(context.Background(), "other"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 阻塞模式下等待暂停结束
+	rl.WithMode(RateLimitModeWait)
+	start := time.Now()
+	if err := rl.Do(context.Background(), "start", func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed < time.Millisecond*10 {
+		t.Fatalf("should wait for the penalty, elapsed %s", elapsed)
+	}
+
+	rl.mu.Lock()
+	strikes := rl.buckets["start"].strikes
+	rl.mu.Unlock()
+	if strikes != 0 {
+		t.Fatalf("success should reset strikes, got %d", strikes)
+	}
+}
@@ -0,0 +1,202 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package basic
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// Backoff 指数退避
+// 第 n 次(从1开始)等待 InitialInterval * Multiplier^(n-1), 不超过 MaxInterval
+// Jitter 为抖动比例, 例如 0.2 表示在计算结果的 ±20% 内随机
+type Backoff struct {
+	InitialInterval time.Duration // 初始间隔
+	MaxInterval     time.Duration // 最大间隔, 0 表示不限制
+	Multiplier      float64       // 倍数, 小于1时按1处理
+	Jitter          float64       // 抖动比例 [0, 1]
+}
+
+// Duration 计算第 attempt 次的等待时间
+func (b Backoff) Duration(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	multiplier := b.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	d := float64(b.InitialInterval) * math.Pow(multiplier, float64(attempt-1))
+	if b.MaxInterval > 0 && d > float64(b.MaxInterval) {
+		d = float64(b.MaxInterval)
+	}
+
+	if jitter := math.Min(b.Jitter, 1); jitter > 0 {
+		d *= 1 - jitter + 2*jitter*rand.Float64() //nolint:gosec
+	}
+
+	return time.Duration(d)
+}
+
+// StartRespRefresher 重连前获取新的 StartResp
+// 例如 game_id / conn_id 过期后, 需要重新调用 AppStart / WsStart
+type StartRespRefresher func(ctx context.Context, startResp StartResp, closeType int) (StartResp, error)
+
+// ReconnectPolicy 自动重连策略
+type ReconnectPolicy struct {
+	Backoff
+
+	// MaxAttempts 单次断线最大重连次数, 小于等于0表示不限制
+	MaxAttempts int
+
+	// ShouldReconnect 判断关闭类型是否需要重连
+	// 默认 CloseActively, CloseAuthFailed, CloseReceivedShutdownMessage, CloseInteractionEnd 不会重连
+	ShouldReconnect func(closeType int) bool
+
+	// RefreshStartResp 每次重连前调用, 为空时沿用上一次的 StartResp
+	RefreshStartResp StartRespRefresher
+
+	// OnReconnect 每次重连尝试后调用, err 为空表示重连成功
+	OnReconnect func(wsClient *WsClient, attempt int, err error)
+}
+
+// DefaultReconnectPolicy 默认重连策略
+// 1s 起步, 2倍递增, 最大30s, ±20% 抖动, 最多重试10次
+func DefaultReconnectPolicy() *ReconnectPolicy {
+	return &ReconnectPolicy{
+		Backoff: Backoff{
+			InitialInterval: time.Second,
+			MaxInterval:     time.Second * 30,
+			Multiplier:      2,
+			Jitter:          0.2,
+		},
+		MaxAttempts: 10,
+	}
+}
+
+// WithRefreshStartResp 设置重连前获取新的 StartResp 的方法
+func (rp *ReconnectPolicy) WithRefreshStartResp(refresh StartRespRefresher) *ReconnectPolicy {
+	rp.RefreshStartResp = refresh
+	return rp
+}
+
+// WithMaxAttempts 设置最大重连次数
+func (rp *ReconnectPolicy) WithMaxAttempts(maxAttempts int) *ReconnectPolicy {
+	rp.MaxAttempts = maxAttempts
+	return rp
+}
+
+func (rp *ReconnectPolicy) shouldReconnect(closeType int) bool {
+	if rp.ShouldReconnect != nil {
+		return rp.ShouldReconnect(closeType)
+	}
+
+	return !IsTerminalCloseType(closeType)
+}
+
+// IsTerminalCloseType 默认不需要重连的关闭类型
+func IsTerminalCloseType(closeType int) bool {
+	switch closeType {
+	case CloseActively, CloseAuthFailed, CloseReceivedShutdownMessage, CloseInteractionEnd:
+		return true
+	}
+
+	return false
+}
+
+// reconnectLoop 按照策略进行重连, 直到成功, 次数用尽或被主动关闭
+// 只有最终放弃时才会触发 onClose
+func (wsClient *WsClient) reconnectLoop(closeType int) {
+	policy := wsClient.reconnect
+	startResp := wsClient.startResp
+
+	ctx, cancel := context.WithCancel(wsClient.context())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-wsClient.stopped:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for attempt := 1; policy.MaxAttempts <= 0 || attempt <= policy.MaxAttempts; attempt++ {
+		delay := policy.Duration(attempt)
+		wsClient.logger.Info("ws client reconnect wait",
+			slog.Int("attempt", attempt),
+			slog.Int("close_type", closeType),
+			slog.Duration("delay", delay),
+		)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			wsClient.onClosed(startResp, CloseActively)
+			return
+		case <-timer.C:
+		}
+
+		err := wsClient.reconnectOnce(ctx, startResp, closeType)
+		if policy.OnReconnect != nil {
+			policy.OnReconnect(wsClient, attempt, err)
+		}
+
+		if err == nil {
+			wsClient.logger.Info("ws client reconnect success", slog.Int("attempt", attempt))
+
+			// 重连过程中被主动关闭
+			if wsClient.isStopped() {
+				_ = wsClient.CloseWithType(CloseActively)
+			}
+			return
+		}
+
+		wsClient.logger.Error("ws client reconnect fail", slog.Int("attempt", attempt), slog.String("err", err.Error()))
+		startResp = wsClient.startResp
+	}
+
+	wsClient.logger.Error("ws client reconnect give up", slog.Int("max_attempts", policy.MaxAttempts))
+	wsClient.onClosed(startResp, closeType)
+}
+
+func (wsClient *WsClient) reconnectOnce(ctx context.Context, startResp StartResp, closeType int) error {
+	if refresh := wsClient.reconnect.RefreshStartResp; refresh != nil {
+		newStartResp, err := refresh(ctx, startResp, closeType)
+		if err != nil {
+			return err
+		}
+
+		startResp = newStartResp
+	}
+
+	return wsClient.Reconnection(startResp)
+}
@@ -0,0 +1,147 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package basic
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	ierrors "github.com/vtb-link/bianka/errors"
+)
+
+// RetryPolicy 接口请求重试策略
+type RetryPolicy struct {
+	Backoff
+
+	// MaxAttempts 最大尝试次数, 包含第一次请求, 小于等于1表示不重试
+	MaxAttempts int
+
+	// Retryable 判断错误是否可以重试, 为空时使用 DefaultRetryable
+	Retryable func(err error) bool
+
+	// OnRetry 每次重试前调用, attempt 为失败的次数
+	OnRetry func(attempt int, err error)
+}
+
+// DefaultRetryPolicy 默认重试策略
+// 200ms 起步, 2倍递增, 最大2s, ±20% 抖动, 最多请求3次
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		Backoff: Backoff{
+			InitialInterval: time.Millisecond * 200,
+			MaxInterval:     time.Second * 2,
+			Multiplier:      2,
+			Jitter:          0.2,
+		},
+		MaxAttempts: 3,
+	}
+}
+
+// WithMaxAttempts 设置最大尝试次数
+func (rp *RetryPolicy) WithMaxAttempts(maxAttempts int) *RetryPolicy {
+	rp.MaxAttempts = maxAttempts
+	return rp
+}
+
+// WithRetryable 设置可以重试的错误
+func (rp *RetryPolicy) WithRetryable(retryable func(err error) bool) *RetryPolicy {
+	rp.Retryable = retryable
+	return rp
+}
+
+// DefaultRetryable 默认的重试判断, 适用于幂等请求, 非幂等请求见 NonIdempotentRetryable
+// context 取消或超时以及本地限流(ErrRateLimitExceeded)不重试; *errors.APIError 按照 Retryable 判断(5xx, 429, 限流以及请求过期等); 其他错误(例如网络错误)重试
+func DefaultRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrRateLimitExceeded) {
+		return false
+	}
+
+	if apiErr, ok := ierrors.AsAPIError(err); ok {
+		return apiErr.Retryable()
+	}
+
+	return true
+}
+
+// IsConnectError 是否为建立链接阶段的错误, 此时请求还没有发出
+func IsConnectError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// NonIdempotentRetryable 非幂等请求(例如新增, 编辑)的重试判断
+// 只重试服务端没有处理请求的错误: 建立链接失败以及服务端限流
+func NonIdempotentRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrRateLimitExceeded) {
+		return false
+	}
+
+	return IsConnectError(err) || errors.Is(err, ierrors.ErrRateLimited)
+}
+
+// NonIdempotent 返回用于非幂等请求的策略副本
+// 在 Retryable 的基础上只重试 NonIdempotentRetryable 的错误, rp 为空时返回空
+func (rp *RetryPolicy) NonIdempotent() *RetryPolicy {
+	if rp == nil {
+		return nil
+	}
+
+	policy := *rp
+	policy.Retryable = func(err error) bool {
+		return NonIdempotentRetryable(err) && rp.retryable(err)
+	}
+	return &policy
+}
+
+func (rp *RetryPolicy) retryable(err error) bool {
+	if rp.Retryable != nil {
+		return rp.Retryable(err)
+	}
+	return DefaultRetryable(err)
+}
+
+// Do 按照策略执行 fn, attempt 从1开始
+// rp 为空时只执行一次, 返回最后一次的错误
+func (rp *RetryPolicy) Do(ctx context.Context, fn func(attempt int) error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(attempt)
+		if err == nil || rp == nil || attempt >= rp.MaxAttempts || ctx.Err() != nil || !rp.retryable(err) {
+			return err
+		}
+
+		timer := time.NewTimer(rp.Duration(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		if rp.OnRetry != nil {
+			rp.OnRetry(attempt, err)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package basic
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	ierrors "github.com/vtb-link/bianka/errors"
+)
+
+func testRetryPolicy(maxAttempts int) *RetryPolicy {
+	return &RetryPolicy{
+		Backoff:     Backoff{InitialInterval: time.Millisecond},
+		MaxAttempts: maxAttempts,
+	}
+}
+
+func TestRetryPolicy_Do(t *testing.T) {
+	netErr := errors.New("connection reset")
+	rateLimited := &ierrors.APIError{Platform: ierrors.PlatformOpenHome, HTTPStatus: 200, Code: -509}
+	invalidCode := &ierrors.APIError{Platform: ierrors.PlatformOpenLive, HTTPStatus: 200, Code: 7007}
+
+	tests := []struct {
+		name     string
+		policy   *RetryPolicy
+		errs     []error
+		attempts int
+		err      error
+	}{
+		{name: "nil policy", policy: nil, errs: []error{netErr, nil}, attempts: 1, err: netErr},
+		{name: "network error", policy: testRetryPolicy(3), errs: []error{netErr, netErr, nil}, attempts: 3, err: nil},
+		{name: "rate limited", policy: testRetryPolicy(3), errs: []error{rateLimited, nil}, attempts: 2, err: nil},
+		{name: "not retryable", policy: testRetryPolicy(3), errs: []error{invalidCode, nil}, attempts: 1, err: invalidCode},
+		{name: "exhausted", policy: testRetryPolicy(2), errs: []error{netErr, netErr, nil}, attempts: 2, err: netErr},
+		{
+			name:     "custom retryable",
+			policy:   testRetryPolicy(3).WithRetryable(func(err error) bool { return errors.Is(err, ierrors.ErrInvalidCode) }),
+			errs:     []error{invalidCode, nil},
+			attempts: 2,
+			err:      nil,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := tt.policy.Do(context.Background(), func(attempt int) error {
+				attempts++
+				if attempt != attempts {
+					t.Fatalf("unexpected attempt %d", attempt)
+				}
+				return tt.errs[attempt-1]
+			})
+
+			if !errors.Is(err, tt.err) || (tt.err == nil && err != nil) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if attempts != tt.attempts {
+				t.Fatalf("unexpected attempts %d, expected %d", attempts, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_NonIdempotent(t *testing.T) {
+	connErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	readErr := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset")}
+	serverErr := &ierrors.APIError{Platform: ierrors.PlatformOpenHome, HTTPStatus: 502}
+	rateLimited := &ierrors.APIError{Platform: ierrors.PlatformOpenHome, HTTPStatus: 200, Code: -509}
+
+	tests := []struct {
+		err       error
+		retryable bool
+	}{
+		{err: connErr, retryable: true},
+		{err: rateLimited, retryable: true},
+		{err: readErr, retryable: false},
+		{err: serverErr, retryable: false},
+		{err: ErrRateLimitExceeded, retryable: false},
+	}
+
+	policy := testRetryPolicy(2).NonIdempotent()
+	for _, tt := range tests {
+		attempts := 0
+		_ = policy.Do(context.Background(), func(_ int) error {
+			attempts++
+			return tt.err
+		})
+
+		if retried := attempts == 2; retried != tt.retryable {
+			t.Fatalf("%v: unexpected attempts %d", tt.err, attempts)
+		}
+	}
+
+	if (*RetryPolicy)(nil).NonIdempotent() != nil {
+		t.Fatal("nil policy should stay nil")
+	}
+}
+
+func TestRetryPolicy_DoCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := &RetryPolicy{Backoff: Backoff{InitialInterval: time.Hour}, MaxAttempts: 3}
+
+	attempts := 0
+	go cancel()
+	err := policy.Do(ctx, func(_ int) error {
+		attempts++
+		return errors.New("fail")
+	})
+
+	if err == nil || attempts != 1 {
+		t.Fatalf("unexpected result %v %d", err, attempts)
+	}
+}
@@ -0,0 +1,159 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package basic
+
+import (
+	"reflect"
+
+	"github.com/vtb-link/bianka/proto"
+)
+
+// EventRouter 按照消息类型分发 proto.OperationMessage
+// 同一事件的 LIVE_OPEN_PLATFORM_* 与 OPEN_LIVEROOM_* 会触发同一个处理函数, 所以 live 与 openhome 的长连接可以共用
+// 注意: 处理函数需要在启动长连接前注册, 处理函数内不要做耗时操作
+type EventRouter struct {
+	handlers map[reflect.Type][]func(data interface{})
+	unknown  []func(cmd string, raw []byte)
+}
+
+func NewEventRouter() *EventRouter {
+	return &EventRouter{
+		handlers: map[reflect.Type][]func(data interface{}){},
+	}
+}
+
+// On 注册任意类型的处理函数, T 为 proto.AutomaticParsingMessageCommand 解析出的结构体
+func On[T any](router *EventRouter, handle func(data *T)) *EventRouter {
+	key := reflect.TypeOf((*T)(nil))
+	router.handlers[key] = append(router.handlers[key], func(data interface{}) {
+		handle(data.(*T))
+	})
+
+	return router
+}
+
+// OnDanmu 弹幕
+func (router *EventRouter) OnDanmu(handle func(data *proto.CmdDanmuData)) *EventRouter {
+	return On(router, handle)
+}
+
+// OnGift 礼物
+func (router *EventRouter) OnGift(handle func(data *proto.CmdSendGiftData)) *EventRouter {
+	return On(router, handle)
+}
+
+// OnSuperChat SC
+func (router *EventRouter) OnSuperChat(handle func(data *proto.CmdSuperChatData)) *EventRouter {
+	return On(router, handle)
+}
+
+// OnSuperChatDel SC删除
+func (router *EventRouter) OnSuperChatDel(handle func(data *proto.CmdSuperChatDelData)) *EventRouter {
+	return On(router, handle)
+}
+
+// OnGuard 付费大航海
+func (router *EventRouter) OnGuard(handle func(data *proto.CmdGuardData)) *EventRouter {
+	return On(router, handle)
+}
+
+// OnLike 点赞
+func (router *EventRouter) OnLike(handle func(data *proto.CmdLikeData)) *EventRouter {
+	return On(router, handle)
+}
+
+// OnRoomEnter 进入房间
+func (router *EventRouter) OnRoomEnter(handle func(data *proto.CmdLiveRoomEnterData)) *EventRouter {
+	return On(router, handle)
+}
+
+// OnLiveStart 开始直播
+func (router *EventRouter) OnLiveStart(handle func(data *proto.CmdLiveStartData)) *EventRouter {
+	return On(router, handle)
+}
+
+// OnLiveEnd 结束直播
+func (router *EventRouter) OnLiveEnd(handle func(data *proto.CmdLiveEndData)) *EventRouter {
+	return On(router, handle)
+}
+
+// OnRoomChange 直播间基础信息更新
+func (router *EventRouter) OnRoomChange(handle func(data *proto.CmdRoomChangeData)) *EventRouter {
+	return On(router, handle)
+}
+
+// OnBlock 用户禁言通知
+func (router *EventRouter) OnBlock(handle func(data *proto.CmdRoomBlockMsgData)) *EventRouter {
+	return On(router, handle)
+}
+
+// OnInteractWord 用户关注通知
+func (router *EventRouter) OnInteractWord(handle func(data *proto.CmdInteractWordData)) *EventRouter {
+	return On(router, handle)
+}
+
+// OnWarning 直播间警告信息
+func (router *EventRouter) OnWarning(handle func(data *proto.CmdWarningData)) *EventRouter {
+	return On(router, handle)
+}
+
+// OnInteractionEnd 消息推送结束通知, 处理后长连接会以 CloseInteractionEnd 关闭
+func (router *EventRouter) OnInteractionEnd(handle func(data *proto.CmdInteractionEndData)) *EventRouter {
+	return On(router, handle)
+}
+
+// OnUnknown 未知的cmd, raw 为完整的消息体
+func (router *EventRouter) OnUnknown(handle func(cmd string, raw []byte)) *EventRouter {
+	router.unknown = append(router.unknown, handle)
+	return router
+}
+
+// Handle 实现 DispatcherHandle
+func (router *EventRouter) Handle(_ *WsClient, msg *proto.Message) error {
+	cmd, data, err := proto.AutomaticParsingMessageCommand(msg.Payload())
+	if err != nil {
+		return err
+	}
+
+	// 未知的cmd 会被解析成 map[string]interface{} 等非结构体指针
+	if reflect.TypeOf(data).Kind() != reflect.Ptr {
+		for _, handle := range router.unknown {
+			handle(cmd, msg.Payload())
+		}
+		return nil
+	}
+
+	for _, handle := range router.handlers[reflect.TypeOf(data)] {
+		handle(data)
+	}
+
+	return nil
+}
+
+// DispatcherHandleMap 用于 NewWsClient / StartWebsocket
+func (router *EventRouter) DispatcherHandleMap() DispatcherHandleMap {
+	return DispatcherHandleMap{
+		proto.OperationMessage: router.Handle,
+	}
+}
@@ -0,0 +1,74 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package basic
+
+import (
+	"testing"
+
+	"github.com/vtb-link/bianka/proto"
+)
+
+func TestEventRouter_Handle(t *testing.T) {
+	var danmus, gifts []string
+	var unknown []string
+
+	router := NewEventRouter().
+		OnDanmu(func(data *proto.CmdDanmuData) {
+			danmus = append(danmus, data.Msg)
+		}).
+		OnGift(func(data *proto.CmdSendGiftData) {
+			gifts = append(gifts, data.GiftName)
+		}).
+		OnUnknown(func(cmd string, _ []byte) {
+			unknown = append(unknown, cmd)
+		})
+
+	payloads := []string{
+		`{"cmd":"LIVE_OPEN_PLATFORM_DM","data":{"msg":"live"}}`,
+		`{"cmd":"OPEN_LIVEROOM_DM","data":{"msg":"openhome"}}`,
+		`{"cmd":"OPEN_LIVEROOM_SEND_GIFT","data":{"gift_name":"gift"}}`,
+		`{"cmd":"LIVE_OPEN_PLATFORM_LIKE","data":{"like_count":1}}`,
+		`{"cmd":"LIVE_OPEN_PLATFORM_UNKNOWN","data":{}}`,
+	}
+
+	handle := router.DispatcherHandleMap()[proto.OperationMessage]
+	for _, payload := range payloads {
+		msg := proto.PackMessage(proto.HeaderDefaultSequence, proto.OperationMessage, []byte(payload))
+		if err := handle(nil, &msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(danmus) != 2 || danmus[0] != "live" || danmus[1] != "openhome" {
+		t.Fatalf("unexpected danmus %v", danmus)
+	}
+
+	if len(gifts) != 1 || gifts[0] != "gift" {
+		t.Fatalf("unexpected gifts %v", gifts)
+	}
+
+	if len(unknown) != 1 || unknown[0] != "LIVE_OPEN_PLATFORM_UNKNOWN" {
+		t.Fatalf("unexpected unknown %v", unknown)
+	}
+}
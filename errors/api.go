@@ -0,0 +1,212 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// Platform 接口所属平台
+type Platform string
+
+const (
+	PlatformOpenLive Platform = "open-live" // 直播创作者服务中心 live-open.biliapi.com
+	PlatformOpenHome Platform = "open-home" // 开放平台 member.bilibili.com
+)
+
+var (
+	// ErrInvalidParams 参数错误
+	ErrInvalidParams = errors.New("bilibili invalid params")
+	// ErrInvalidApp 应用无效
+	ErrInvalidApp = errors.New("bilibili invalid app")
+	// ErrInvalidSignature 签名错误
+	ErrInvalidSignature = errors.New("bilibili invalid signature")
+	// ErrRequestExpired 请求过期
+	ErrRequestExpired = errors.New("bilibili request expired")
+	// ErrDuplicateRequest 重复请求
+	ErrDuplicateRequest = errors.New("bilibili duplicate request")
+	// ErrInvalidCode 主播身份码错误
+	ErrInvalidCode = errors.New("bilibili invalid code")
+	// ErrGameAlreadyStarted 房间重复游戏
+	ErrGameAlreadyStarted = errors.New("bilibili game already started")
+	// ErrGameIDInvalid 心跳过期或GameId错误
+	ErrGameIDInvalid = errors.New("bilibili game id invalid")
+	// ErrTokenExpired access_token 无效或已过期
+	ErrTokenExpired = errors.New("bilibili token expired")
+	// ErrPermissionDenied 权限不足
+	ErrPermissionDenied = errors.New("bilibili permission denied")
+	// ErrNotFound 资源不存在
+	ErrNotFound = errors.New("bilibili not found")
+	// ErrRateLimited 请求过于频繁
+	ErrRateLimited = errors.New("bilibili rate limited")
+	// ErrServerError 服务端错误
+	ErrServerError = errors.New("bilibili server error")
+)
+
+// CodeInfo 错误码说明
+type CodeInfo struct {
+	Platform  Platform
+	Code      int64
+	Message   string
+	Err       error // errors.Is 可匹配的错误
+	Retryable bool  // 是否可以原样重试(可能需要等待)
+}
+
+// codeCatalog 已知的错误码
+// open-live 见 https://open-live.bilibili.com/document/
+// open-home 为B站通用错误码
+var codeCatalog = map[Platform]map[int64]CodeInfo{
+	PlatformOpenLive: {
+		4000: {Message: "参数错误", Err: ErrInvalidParams},
+		4001: {Message: "应用无效", Err: ErrInvalidApp},
+		4002: {Message: "签名错误", Err: ErrInvalidSignature},
+		4003: {Message: "请求过期, 时间戳误差过大", Err: ErrRequestExpired, Retryable: true},
+		4004: {Message: "重复请求, nonce 重复", Err: ErrDuplicateRequest},
+		7001: {Message: "请求冷却期", Err: ErrRateLimited, Retryable: true},
+		7002: {Message: "房间重复游戏, 需要先结束上一场", Err: ErrGameAlreadyStarted},
+		7003: {Message: "心跳过期或GameId错误, 需要重新启动", Err: ErrGameIDInvalid},
+		7007: {Message: "身份码错误", Err: ErrInvalidCode},
+	},
+	PlatformOpenHome: {
+		-101: {Message: "账号未登录, access_token 无效或已过期", Err: ErrTokenExpired},
+		-400: {Message: "请求错误", Err: ErrInvalidParams},
+		-403: {Message: "访问权限不足", Err: ErrPermissionDenied},
+		-404: {Message: "资源不存在", Err: ErrNotFound},
+		-412: {Message: "请求被拦截", Err: ErrRateLimited, Retryable: true},
+		-500: {Message: "服务器错误", Err: ErrServerError, Retryable: true},
+		-503: {Message: "服务暂不可用", Err: ErrServerError, Retryable: true},
+		-509: {Message: "请求过于频繁", Err: ErrRateLimited, Retryable: true},
+	},
+}
+
+// LookupCode 查询错误码说明
+func LookupCode(platform Platform, code int64) (CodeInfo, bool) {
+	info, ok := codeCatalog[platform][code]
+	if !ok {
+		return CodeInfo{}, false
+	}
+
+	info.Platform = platform
+	info.Code = code
+	return info, true
+}
+
+// Codes 所有已知的错误码, 按平台与错误码排序
+func Codes() []CodeInfo {
+	codes := make([]CodeInfo, 0, 32)
+	for platform, catalog := range codeCatalog {
+		for code := range catalog {
+			info, _ := LookupCode(platform, code)
+			codes = append(codes, info)
+		}
+	}
+
+	sort.Slice(codes, func(i, j int) bool {
+		if codes[i].Platform != codes[j].Platform {
+			return codes[i].Platform < codes[j].Platform
+		}
+		return codes[i].Code < codes[j].Code
+	})
+	return codes
+}
+
+// APIError 接口返回的错误
+// errors.Is 可以匹配 BilibiliRequestFailed / BilibiliResponseNotSuccess 以及已知错误码对应的错误, 例如 ErrGameIDInvalid
+//
+//	var apiErr *errors.APIError
+//	if errors.As(err, &apiErr) {
+//		log.Println(apiErr.Code, apiErr.RequestID)
+//	}
+type APIError struct {
+	Platform   Platform
+	Endpoint   string // 请求的接口路径
+	HTTPStatus int
+	Code       int64
+	Message    string
+	RequestID  string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("bilibili %s api error, endpoint: %s, http status: %d, code: %d, message: %s, request_id: %s",
+		e.Platform, e.Endpoint, e.HTTPStatus, e.Code, e.Message, e.RequestID)
+}
+
+// Unwrap 用于 errors.Is / errors.As
+func (e *APIError) Unwrap() []error {
+	errs := make([]error, 0, 2)
+	if e.HTTPStatus >= http.StatusBadRequest {
+		errs = append(errs, BilibiliRequestFailed)
+	} else {
+		errs = append(errs, BilibiliResponseNotSuccess)
+	}
+
+	switch {
+	case e.HTTPStatus == http.StatusTooManyRequests:
+		errs = append(errs, ErrRateLimited)
+	case e.HTTPStatus >= http.StatusInternalServerError:
+		errs = append(errs, ErrServerError)
+	}
+
+	if info, ok := e.Info(); ok {
+		errs = append(errs, info.Err)
+	}
+
+	return errs
+}
+
+// Info 错误码说明, 未知的错误码返回 false
+func (e *APIError) Info() (CodeInfo, bool) {
+	if e.HTTPStatus >= http.StatusBadRequest && e.Code == 0 {
+		return CodeInfo{}, false
+	}
+	return LookupCode(e.Platform, e.Code)
+}
+
+// Retryable 是否可以重试
+func (e *APIError) Retryable() bool {
+	if e.HTTPStatus == http.StatusTooManyRequests || e.HTTPStatus >= http.StatusInternalServerError {
+		return true
+	}
+
+	info, ok := e.Info()
+	return ok && info.Retryable
+}
+
+// AsAPIError 获取 err 中的 APIError
+func AsAPIError(err error) (*APIError, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+	return nil, false
+}
+
+// IsRetryable err 是否为可以重试的 APIError
+func IsRetryable(err error) bool {
+	apiErr, ok := AsAPIError(err)
+	return ok && apiErr.Retryable()
+}
@@ -0,0 +1,119 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package errors
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       *APIError
+		is        []error
+		isNot     []error
+		retryable bool
+	}{
+		{
+			name:  "game id invalid",
+			err:   &APIError{Platform: PlatformOpenLive, HTTPStatus: http.StatusOK, Code: 7003},
+			is:    []error{BilibiliResponseNotSuccess, ErrGameIDInvalid},
+			isNot: []error{BilibiliRequestFailed, ErrInvalidCode},
+		},
+		{
+			name:      "rate limited",
+			err:       &APIError{Platform: PlatformOpenHome, HTTPStatus: http.StatusOK, Code: -509},
+			is:        []error{BilibiliResponseNotSuccess, ErrRateLimited},
+			retryable: true,
+		},
+		{
+			name:  "token expired",
+			err:   &APIError{Platform: PlatformOpenHome, HTTPStatus: http.StatusOK, Code: -101},
+			is:    []error{ErrTokenExpired},
+			isNot: []error{ErrRateLimited},
+		},
+		{
+			name:      "http 503",
+			err:       &APIError{Platform: PlatformOpenLive, HTTPStatus: http.StatusServiceUnavailable},
+			is:        []error{BilibiliRequestFailed, ErrServerError},
+			isNot:     []error{BilibiliResponseNotSuccess},
+			retryable: true,
+		},
+		{
+			name:  "unknown code",
+			err:   &APIError{Platform: PlatformOpenLive, HTTPStatus: http.StatusOK, Code: 123456},
+			is:    []error{BilibiliResponseNotSuccess},
+			isNot: []error{ErrGameIDInvalid, ErrServerError},
+		},
+		{
+			name:  "code of another platform",
+			err:   &APIError{Platform: PlatformOpenHome, HTTPStatus: http.StatusOK, Code: 7003},
+			isNot: []error{ErrGameIDInvalid},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := pkgerrors.WithMessage(pkgerrors.WithStack(tt.err), "wrapped")
+
+			for _, target := range tt.is {
+				if !errors.Is(err, target) {
+					t.Errorf("should be %v", target)
+				}
+			}
+			for _, target := range tt.isNot {
+				if errors.Is(err, target) {
+					t.Errorf("should not be %v", target)
+				}
+			}
+
+			apiErr, ok := AsAPIError(err)
+			if !ok || apiErr != tt.err {
+				t.Fatalf("errors.As fail")
+			}
+
+			if IsRetryable(err) != tt.retryable {
+				t.Errorf("unexpected retryable %v", !tt.retryable)
+			}
+		})
+	}
+}
+
+func TestCodes(t *testing.T) {
+	codes := Codes()
+	if len(codes) == 0 {
+		t.Fatal("empty catalog")
+	}
+
+	for _, info := range codes {
+		if info.Err == nil || info.Message == "" {
+			t.Errorf("incomplete code info %+v", info)
+		}
+	}
+}
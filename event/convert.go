@@ -0,0 +1,317 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package event
+
+import (
+	"strings"
+	"time"
+
+	"github.com/vtb-link/bianka/basic"
+	"github.com/vtb-link/bianka/proto"
+)
+
+// SourceOf 根据 cmd 前缀判断消息来源
+func SourceOf(cmd string) Source {
+	switch {
+	case strings.HasPrefix(cmd, "LIVE_OPEN_PLATFORM_"):
+		return SourceOpenLive
+	case strings.HasPrefix(cmd, "OPEN_LIVEROOM_"):
+		return SourceOpenHome
+	default:
+		return SourceUnknown
+	}
+}
+
+// Parse 解析消息并转换为 Event
+func Parse(payload []byte) (*Event, error) {
+	cmd, data, err := proto.AutomaticParsingMessageCommand(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return FromCmd(cmd, data), nil
+}
+
+// FromCmd 将 proto.AutomaticParsingMessageCommand 的解析结果转换为 Event
+// 未知的 data 会被转换为 KindUnknown
+func FromCmd(cmd string, data interface{}) *Event {
+	var e *Event
+	switch d := data.(type) {
+	case *proto.CmdDanmuData:
+		e = FromDanmu(d)
+	case *proto.CmdSendGiftData:
+		e = FromSendGift(d)
+	case *proto.CmdSuperChatData:
+		e = FromSuperChat(d)
+	case *proto.CmdSuperChatDelData:
+		e = FromSuperChatDel(d)
+	case *proto.CmdGuardData:
+		e = FromGuard(d)
+	case *proto.CmdLikeData:
+		e = FromLike(d)
+	case *proto.CmdLiveRoomEnterData:
+		e = FromLiveRoomEnter(d)
+	case *proto.CmdLiveStartData:
+		e = FromLiveStart(d)
+	case *proto.CmdLiveEndData:
+		e = FromLiveEnd(d)
+	case *proto.CmdRoomChangeData:
+		e = FromRoomChange(d)
+	case *proto.CmdRoomBlockMsgData:
+		e = FromRoomBlockMsg(d)
+	case *proto.CmdInteractWordData:
+		e = FromInteractWord(d)
+	case *proto.CmdWarningData:
+		e = FromWarning(d)
+	case *proto.CmdInteractionEndData:
+		e = FromInteractionEnd(d)
+	default:
+		e = newEvent(KindUnknown, data, 0, "", 0)
+	}
+
+	e.Cmd = cmd
+	e.Source = SourceOf(cmd)
+	return e
+}
+
+// FromDanmu 转换弹幕
+func FromDanmu(d *proto.CmdDanmuData) *Event {
+	e := newEvent(KindDanmu, d, int64(d.RoomID), d.MsgID, int64(d.Timestamp))
+	e.User = newUser(d.OpenID, int64(d.Uid), d.Uname, d.UFace, d.GuardLevel, d.FansMedalName, d.FansMedalLevel, d.FansMedalWearingStatus)
+	e.Danmu = &Danmu{
+		Msg:         d.Msg,
+		EmojiImgUrl: d.EmojiImgUrl,
+		DmType:      d.DmType,
+	}
+	return e
+}
+
+// FromSendGift 转换礼物
+func FromSendGift(d *proto.CmdSendGiftData) *Event {
+	e := newEvent(KindGift, d, int64(d.RoomID), d.MsgID, int64(d.Timestamp))
+	e.User = newUser(d.OpenID, int64(d.Uid), d.Uname, d.Uface, d.GuardLevel, d.FansMedalName, d.FansMedalLevel, d.FansMedalWearingStatus)
+	e.Gift = &Gift{
+		ID:     int64(d.GiftID),
+		Name:   d.GiftName,
+		Num:    int64(d.GiftNum),
+		Price:  int64(d.Price),
+		RPrice: int64(d.RPrice),
+		Paid:   d.Paid,
+		Icon:   d.GiftIcon,
+		Anchor: &User{
+			OpenID: d.AnchorInfo.OpenID,
+			Uid:    int64(d.AnchorInfo.Uid),
+			Name:   d.AnchorInfo.Uname,
+			Face:   d.AnchorInfo.Uface,
+		},
+	}
+
+	if d.ComboGift {
+		e.Gift.Combo = &Combo{
+			ID:      d.ComboInfo.ComboID,
+			BaseNum: int64(d.ComboInfo.ComboBaseNum),
+			Count:   int64(d.ComboInfo.ComboCount),
+			Timeout: int64(d.ComboInfo.ComboTimeout),
+		}
+	}
+	return e
+}
+
+// FromSuperChat 转换SC
+func FromSuperChat(d *proto.CmdSuperChatData) *Event {
+	e := newEvent(KindSuperChat, d, int64(d.RoomID), d.MsgID, int64(d.Timestamp))
+	e.User = newUser(d.OpenID, int64(d.Uid), d.Uname, d.Uface, d.GuardLevel, d.FansMedalName, d.FansMedalLevel, d.FansMedalWearingStatus)
+	e.SuperChat = &SuperChat{
+		ID:        int64(d.MessageID),
+		Message:   d.Message,
+		Rmb:       int64(d.Rmb),
+		StartTime: unix(int64(d.StartTime)),
+		EndTime:   unix(int64(d.EndTime)),
+	}
+	return e
+}
+
+// FromSuperChatDel 转换SC删除
+func FromSuperChatDel(d *proto.CmdSuperChatDelData) *Event {
+	e := newEvent(KindSuperChatDel, d, int64(d.RoomID), d.MsgID, 0)
+	ids := make([]int64, 0, len(d.MessageIds))
+	for _, id := range d.MessageIds {
+		ids = append(ids, int64(id))
+	}
+	e.SuperChatDel = &SuperChatDel{IDs: ids}
+	return e
+}
+
+// FromGuard 转换付费大航海
+func FromGuard(d *proto.CmdGuardData) *Event {
+	e := newEvent(KindGuard, d, int64(d.RoomID), d.MsgID, int64(d.Timestamp))
+	e.User = newUser(d.UserInfo.OpenID, int64(d.UserInfo.Uid), d.UserInfo.Uname, d.UserInfo.Uface, d.GuardLevel, d.FansMedalName, d.FansMedalLevel, d.FansMedalWearingStatus)
+	e.Guard = &Guard{
+		Level: d.GuardLevel,
+		Num:   int64(d.GuardNum),
+		Unit:  d.GuardUnit,
+		Price: int64(d.Price),
+	}
+	return e
+}
+
+// FromLike 转换点赞
+func FromLike(d *proto.CmdLikeData) *Event {
+	e := newEvent(KindLike, d, int64(d.RoomID), d.MsgID, int64(d.Timestamp))
+	e.User = newUser(d.OpenID, int64(d.Uid), d.Uname, d.Uface, 0, d.FansMedalName, d.FansMedalLevel, d.FansMedalWearingStatus)
+	e.Like = &Like{
+		Text:  d.LikeText,
+		Count: int64(d.LikeCount),
+	}
+	return e
+}
+
+// FromLiveRoomEnter 转换进入房间
+func FromLiveRoomEnter(d *proto.CmdLiveRoomEnterData) *Event {
+	e := newEvent(KindRoomEnter, d, d.RoomID, "", d.Timestamp)
+	e.User = newUser(d.OpenID, 0, d.Uname, d.Uface, 0, "", 0, false)
+	return e
+}
+
+// FromLiveStart 转换开始直播, User 为主播
+func FromLiveStart(d *proto.CmdLiveStartData) *Event {
+	e := newEvent(KindLiveStart, d, d.RoomID, "", d.Timestamp)
+	e.User = newUser(d.OpenID, 0, "", "", 0, "", 0, false)
+	e.Live = &Live{
+		AreaName: d.AreaName,
+		Title:    d.Title,
+	}
+	return e
+}
+
+// FromLiveEnd 转换结束直播, User 为主播
+func FromLiveEnd(d *proto.CmdLiveEndData) *Event {
+	e := newEvent(KindLiveEnd, d, d.RoomID, "", d.Timestamp)
+	e.User = newUser(d.OpenID, 0, "", "", 0, "", 0, false)
+	e.Live = &Live{
+		AreaName: d.AreaName,
+		Title:    d.Title,
+	}
+	return e
+}
+
+// FromRoomChange 转换直播间基础信息更新
+func FromRoomChange(d *proto.CmdRoomChangeData) *Event {
+	e := newEvent(KindRoomChange, d, d.RoomID, d.MsgID, d.Timestamp)
+	e.Live = &Live{
+		AreaName:       d.AreaName,
+		ParentAreaName: d.ParentAreaName,
+		Title:          d.Title,
+	}
+	return e
+}
+
+// FromRoomBlockMsg 转换用户禁言通知
+// 消息不携带发生时间, Time 为零值
+func FromRoomBlockMsg(d *proto.CmdRoomBlockMsgData) *Event {
+	e := newEvent(KindBlock, d, d.RoomID, d.MsgID, 0)
+	e.User = newUser(d.OpenID, 0, d.Uname, "", 0, "", 0, false)
+	e.Block = &Block{
+		Expired: unix(d.BlockExpired),
+	}
+	return e
+}
+
+// FromInteractWord 转换用户关注通知
+func FromInteractWord(d *proto.CmdInteractWordData) *Event {
+	e := newEvent(KindInteractWord, d, d.RoomID, d.MsgID, d.Timestamp)
+	e.User = newUser(d.OpenID, 0, d.Uname, "", 0, "", 0, false)
+	return e
+}
+
+// FromWarning 转换直播间警告信息
+func FromWarning(d *proto.CmdWarningData) *Event {
+	e := newEvent(KindWarning, d, d.RoomID, d.MsgID, d.Timestamp)
+	e.Warning = &Warning{
+		Msg: d.Msg,
+	}
+	return e
+}
+
+// FromInteractionEnd 转换消息推送结束通知
+func FromInteractionEnd(d *proto.CmdInteractionEndData) *Event {
+	e := newEvent(KindInteractionEnd, d, 0, "", d.Timestamp)
+	e.InteractionEnd = &InteractionEnd{
+		ConnID: d.ConnID,
+	}
+	return e
+}
+
+func newEvent(kind Kind, raw interface{}, roomID int64, msgID string, timestamp int64) *Event {
+	return &Event{
+		Kind:       kind,
+		RoomID:     roomID,
+		MsgID:      msgID,
+		Time:       unix(timestamp),
+		ReceivedAt: time.Now(),
+		Raw:        raw,
+	}
+}
+
+func newUser(openID string, uid int64, name, face string, guardLevel int, medalName string, medalLevel int, medalWearing bool) *User {
+	u := &User{
+		OpenID:     openID,
+		Uid:        uid,
+		Name:       name,
+		Face:       face,
+		GuardLevel: guardLevel,
+	}
+
+	if medalName != "" || medalLevel > 0 {
+		u.Medal = &Medal{
+			Name:    medalName,
+			Level:   medalLevel,
+			Wearing: medalWearing,
+		}
+	}
+	return u
+}
+
+// unix 秒级时间戳转换为 time.Time, 0 转换为零值
+func unix(ts int64) time.Time {
+	if ts <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(ts, 0)
+}
+
+// DispatcherHandleMap 将 proto.OperationMessage 转换为 Event 后交给 handle, 用于 basic.NewWsClient / basic.StartWebsocket
+func DispatcherHandleMap(handle func(e *Event)) basic.DispatcherHandleMap {
+	return basic.DispatcherHandleMap{
+		proto.OperationMessage: func(_ *basic.WsClient, msg *proto.Message) error {
+			e, err := Parse(msg.Payload())
+			if err != nil {
+				return err
+			}
+
+			handle(e)
+			return nil
+		},
+	}
+}
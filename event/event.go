@@ -0,0 +1,186 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+// Package event
+//
+// 统一的事件模型
+// proto.Cmd*Data 中房间号, 时间戳的类型不一致, 用户信息的结构也不一致(例如 CmdGuardData.UserInfo)
+// event 将 open-live(LIVE_OPEN_PLATFORM_*) 与 open-home(OPEN_LIVEROOM_*) 的消息转换为同一个结构, 便于存储, 统计以及展示
+package event
+
+import (
+	"time"
+)
+
+// Kind 事件类型
+type Kind string
+
+const (
+	KindDanmu          Kind = "danmu"           // 弹幕
+	KindGift           Kind = "gift"            // 礼物
+	KindSuperChat      Kind = "super_chat"      // SC
+	KindSuperChatDel   Kind = "super_chat_del"  // SC删除
+	KindGuard          Kind = "guard"           // 付费大航海
+	KindLike           Kind = "like"            // 点赞
+	KindRoomEnter      Kind = "room_enter"      // 进入房间
+	KindLiveStart      Kind = "live_start"      // 开始直播
+	KindLiveEnd        Kind = "live_end"        // 结束直播
+	KindRoomChange     Kind = "room_change"     // 直播间基础信息更新
+	KindBlock          Kind = "block"           // 用户禁言通知
+	KindInteractWord   Kind = "interact_word"   // 用户关注通知
+	KindWarning        Kind = "warning"         // 直播间警告信息
+	KindInteractionEnd Kind = "interaction_end" // 消息推送结束通知
+	KindUnknown        Kind = "unknown"         // 未知
+)
+
+// Source 消息来源
+type Source string
+
+const (
+	SourceUnknown  Source = ""          // 未知
+	SourceOpenLive Source = "open_live" // 互动开放平台 LIVE_OPEN_PLATFORM_*
+	SourceOpenHome Source = "open_home" // 开放平台 OPEN_LIVEROOM_*
+)
+
+// Event 事件
+// 公共字段之外, 根据 Kind 只会有一个对应的字段不为空
+type Event struct {
+	Kind       Kind      `json:"kind"`
+	Cmd        string    `json:"cmd"`
+	Source     Source    `json:"source"`
+	RoomID     int64     `json:"room_id"`
+	MsgID      string    `json:"msg_id"`
+	Time       time.Time `json:"time"`        // 事件发生的时间, 消息未携带时为零值
+	ReceivedAt time.Time `json:"received_at"` // 接收(转换)的时间
+	User       *User     `json:"user,omitempty"`
+
+	Danmu        *Danmu        `json:"danmu,omitempty"`
+	Gift         *Gift         `json:"gift,omitempty"`
+	SuperChat    *SuperChat    `json:"super_chat,omitempty"`
+	SuperChatDel *SuperChatDel `json:"super_chat_del,omitempty"`
+	Guard        *Guard        `json:"guard,omitempty"`
+	Like         *Like         `json:"like,omitempty"`
+	Live         *Live         `json:"live,omitempty"` // 开始直播, 结束直播, 直播间基础信息更新
+	Block        *Block        `json:"block,omitempty"`
+	Warning      *Warning      `json:"warning,omitempty"`
+
+	InteractionEnd *InteractionEnd `json:"interaction_end,omitempty"`
+
+	// Raw 原始数据, 即 proto.Cmd*Data, 未知的cmd 为 map[string]interface{}
+	Raw interface{} `json:"-"`
+}
+
+// User 用户信息
+type User struct {
+	OpenID     string `json:"open_id"`
+	Uid        int64  `json:"uid,omitempty"` // 已废弃字段, 新的消息中为0
+	Name       string `json:"name"`
+	Face       string `json:"face"`
+	Medal      *Medal `json:"medal,omitempty"`
+	GuardLevel int    `json:"guard_level"` // 大航海等级 0-无 1-总督 2-提督 3-舰长
+}
+
+// Medal 粉丝勋章
+type Medal struct {
+	Name    string `json:"name"`
+	Level   int    `json:"level"`
+	Wearing bool   `json:"wearing"` // 是否佩戴当前直播间的勋章
+}
+
+// Danmu 弹幕
+type Danmu struct {
+	Msg         string `json:"msg"`
+	EmojiImgUrl string `json:"emoji_img_url,omitempty"`
+	DmType      int    `json:"dm_type"` // 0-普通弹幕 1-表情包弹幕
+}
+
+// Gift 礼物
+type Gift struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Num    int64  `json:"num"`
+	Price  int64  `json:"price"`   // 礼物单价(1000 = 1元 = 10电池)
+	RPrice int64  `json:"r_price"` // 实际价值
+	Paid   bool   `json:"paid"`    // 是否是付费道具
+	Icon   string `json:"icon"`
+	Anchor *User  `json:"anchor,omitempty"` // 收礼主播
+	Combo  *Combo `json:"combo,omitempty"`
+}
+
+// Combo 连击信息
+type Combo struct {
+	ID      string `json:"id"`
+	BaseNum int64  `json:"base_num"`
+	Count   int64  `json:"count"`
+	Timeout int64  `json:"timeout"`
+}
+
+// SuperChat SC
+type SuperChat struct {
+	ID        int64     `json:"id"`
+	Message   string    `json:"message"`
+	Rmb       int64     `json:"rmb"`
+	StartTime time.Time `json:"start_time"`
+	EndTime   time.Time `json:"end_time"`
+}
+
+// SuperChatDel SC删除
+type SuperChatDel struct {
+	IDs []int64 `json:"ids"`
+}
+
+// Guard 付费大航海
+type Guard struct {
+	Level int    `json:"level"`
+	Num   int64  `json:"num"`
+	Unit  string `json:"unit"` // 月, 周
+	Price int64  `json:"price"`
+}
+
+// Like 点赞
+type Like struct {
+	Text  string `json:"text"`
+	Count int64  `json:"count"`
+}
+
+// Live 直播间信息
+type Live struct {
+	AreaName       string `json:"area_name"`
+	ParentAreaName string `json:"parent_area_name,omitempty"`
+	Title          string `json:"title"`
+}
+
+// Block 禁言
+type Block struct {
+	Expired time.Time `json:"expired"` // 禁言结束时间
+}
+
+// Warning 直播间警告
+type Warning struct {
+	Msg string `json:"msg"`
+}
+
+// InteractionEnd 消息推送结束
+type InteractionEnd struct {
+	ConnID string `json:"conn_id"`
+}
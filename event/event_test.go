@@ -0,0 +1,106 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package event
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		check   func(t *testing.T, e *Event)
+	}{
+		{
+			name:    "open-live danmu",
+			payload: `{"cmd":"LIVE_OPEN_PLATFORM_DM","data":{"room_id":1,"open_id":"o1","uname":"u1","uface":"f1","msg":"hi","msg_id":"m1","fans_medal_level":3,"fans_medal_name":"medal","fans_medal_wearing_status":true,"guard_level":3,"timestamp":1700000000}}`,
+			check: func(t *testing.T, e *Event) {
+				if e.Kind != KindDanmu || e.Source != SourceOpenLive || e.RoomID != 1 || e.MsgID != "m1" {
+					t.Fatalf("unexpected envelope: %+v", e)
+				}
+				if !e.Time.Equal(time.Unix(1700000000, 0)) {
+					t.Fatalf("unexpected time: %v", e.Time)
+				}
+				if e.User.OpenID != "o1" || e.User.Name != "u1" || e.User.Face != "f1" || e.User.GuardLevel != 3 {
+					t.Fatalf("unexpected user: %+v", e.User)
+				}
+				if e.User.Medal == nil || e.User.Medal.Name != "medal" || e.User.Medal.Level != 3 || !e.User.Medal.Wearing {
+					t.Fatalf("unexpected medal: %+v", e.User.Medal)
+				}
+				if e.Danmu == nil || e.Danmu.Msg != "hi" {
+					t.Fatalf("unexpected danmu: %+v", e.Danmu)
+				}
+			},
+		},
+		{
+			name:    "open-home guard",
+			payload: `{"cmd":"OPEN_LIVEROOM_GUARD","data":{"user_info":{"open_id":"o2","uname":"u2","uface":"f2"},"guard_level":1,"guard_num":1,"guard_unit":"月","price":198000,"timestamp":1700000000,"room_id":2,"msg_id":"m2"}}`,
+			check: func(t *testing.T, e *Event) {
+				if e.Kind != KindGuard || e.Source != SourceOpenHome || e.RoomID != 2 {
+					t.Fatalf("unexpected envelope: %+v", e)
+				}
+				if e.User.OpenID != "o2" || e.User.Name != "u2" || e.User.GuardLevel != 1 || e.User.Medal != nil {
+					t.Fatalf("unexpected user: %+v", e.User)
+				}
+				if e.Guard == nil || e.Guard.Level != 1 || e.Guard.Unit != "月" || e.Guard.Price != 198000 {
+					t.Fatalf("unexpected guard: %+v", e.Guard)
+				}
+			},
+		},
+		{
+			name:    "super chat del",
+			payload: `{"cmd":"LIVE_OPEN_PLATFORM_SUPER_CHAT_DEL","data":{"room_id":3,"message_ids":[1,2],"msg_id":"m3"}}`,
+			check: func(t *testing.T, e *Event) {
+				if e.Kind != KindSuperChatDel || len(e.SuperChatDel.IDs) != 2 || !e.Time.IsZero() {
+					t.Fatalf("unexpected event: %+v", e)
+				}
+			},
+		},
+		{
+			name:    "unknown",
+			payload: `{"cmd":"SOMETHING_NEW","data":{"a":1}}`,
+			check: func(t *testing.T, e *Event) {
+				if e.Kind != KindUnknown || e.Source != SourceUnknown || e.Cmd != "SOMETHING_NEW" || e.Raw == nil {
+					t.Fatalf("unexpected event: %+v", e)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := Parse([]byte(tt.payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.ReceivedAt.IsZero() {
+				t.Fatal("received at is zero")
+			}
+			tt.check(t, e)
+		})
+	}
+}
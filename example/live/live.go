@@ -29,7 +29,6 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"github.com/vtb-link/bianka/basic"
 	"github.com/vtb-link/bianka/live"
@@ -45,74 +44,43 @@ var rCfg = live.NewConfig(
 var code = "主播的code" // 身份码 也叫 idCode
 
 func main() {
-	ctx, cancel := context.WithCancelCause(context.Background())
-	defer cancel(nil)
-
 	liveClient := live.NewClient(rCfg)
 
-	startResp, err := liveClient.AppStart(code)
-	if err != nil {
-		panic(err)
-	}
-
-	tk := time.NewTicker(time.Second * 20)
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-tk.C:
-				// 心跳
-				if err := liveClient.AppHeartbeat(startResp.GameInfo.GameID); err != nil {
-					log.Println("Heartbeat fail", err)
-				}
-			}
-		}
-	}()
-
-	defer func() {
-		tk.Stop()
-		liveClient.AppEnd(startResp.GameInfo.GameID)
-	}()
-
-	// close 事件处理
-	onCloseHandle := func(wcs *basic.WsClient, startResp basic.StartResp, closeType int) {
-		// 注册关闭回调
-		log.Println("WebsocketClient onClose", startResp)
-
-		// 注意检查关闭类型, 避免无限重连
-		if closeType == basic.CloseActively || closeType == basic.CloseReceivedShutdownMessage || closeType == basic.CloseAuthFailed {
-			log.Println("WebsocketClient exit")
-			return
-		}
-
-		// 对于可能的情况下重新连接
-		// 注意: 在某些场景下 startResp 会变化, 需要重新获取
-		// 此外, 一但 AppHeartbeat 失败, 会导致 startResp.GameInfo.GameID 变化, 需要重新获取
-		err := wcs.Reconnection(startResp)
-		if err != nil {
-			log.Println("Reconnection fail", err)
-		}
-	}
-
 	// 消息处理 Handle
 	dispatcherHandleMap := basic.DispatcherHandleMap{
 		proto.OperationMessage: messageHandle,
 	}
 
-	wcs, err := basic.StartWebsocket(startResp, dispatcherHandleMap, onCloseHandle, basic.DefaultLoggerGenerator())
-
-	if err != nil {
+	// Session 会完成 AppStart, 项目心跳, 长连接, 断线重连, 失效重启以及 AppEnd
+	session := live.NewSession(liveClient, code, dispatcherHandleMap, basic.DefaultLoggerGenerator()).
+		WithOnStart(func(_ *live.Session, startResp *live.AppStartResponse) {
+			log.Println("Session start", startResp.GameInfo.GameID)
+		}).
+		WithOnError(func(_ *live.Session, err error) {
+			log.Println("Session error", err)
+		}).
+		WithOnStop(func(_ *live.Session, err error) {
+			log.Println("Session stop", err)
+		})
+
+	if err := session.Start(context.Background()); err != nil {
 		panic(err)
 	}
 
-	defer wcs.Close()
+	defer session.Stop()
 
 	// 退出
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT)
 	for {
-		s := <-c
+		var s os.Signal
+		select {
+		case s = <-c:
+		case <-session.Done():
+			log.Println("Session done", session.Err())
+			return
+		}
+
 		switch s {
 		case syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT:
 			log.Println("WebsocketClient exit")
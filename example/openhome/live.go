@@ -52,33 +52,34 @@ func main() {
 	}()
 
 	// close 事件处理
+	// 启用自动重连后, 只有在终止关闭(主动关闭, 鉴权失败, 收到关闭消息)或重连次数用尽时才会触发
 	onCloseHandle := func(wcs *basic.WsClient, startResp basic.StartResp, closeType int) {
-		// 注册关闭回调
-		log.Println("WebsocketClient onClose", startResp)
-
-		// 注意检查关闭类型, 避免无限重连
-		if closeType == basic.CloseActively || closeType == basic.CloseReceivedShutdownMessage || closeType == basic.CloseAuthFailed {
-			log.Println("WebsocketClient exit")
-			return
-		}
-
-		// 对于可能的情况下重新连接
-		// 注意: 在某些场景下 startResp 会变化, 需要重新获取
-		// 此外, 一但 WsHeartbeat 失败, 会导致 startResp.ConnID 变化, 需要重新获取
-		err := wcs.Reconnection(startResp)
-		if err != nil {
-			log.Println("Reconnection fail", err)
-		}
+		log.Println("WebsocketClient onClose", startResp, closeType)
 	}
 
 	// 消息处理 Handle
-	dispatcherHandleMap := basic.DispatcherHandleMap{
-		proto.OperationMessage: messageHandle,
-	}
-
-	wcs, err := basic.StartWebsocket(startResp, dispatcherHandleMap, onCloseHandle, basic.DefaultLoggerGenerator())
-
-	if err != nil {
+	// 按消息类型注册处理函数, open-home 与 open-live 的同一事件会触发同一个处理函数
+	router := basic.NewEventRouter().
+		OnDanmu(func(data *proto.CmdDanmuData) {
+			log.Println("danmu", data.Uname, data.Msg)
+		}).
+		OnGift(func(data *proto.CmdSendGiftData) {
+			log.Println("gift", data.Uname, data.GiftName, data.GiftNum)
+		}).
+		OnUnknown(func(cmd string, raw []byte) {
+			log.Println("unknown", cmd, string(raw))
+		})
+	dispatcherHandleMap := router.DispatcherHandleMap()
+
+	// 自动重连策略: 指数退避 + 抖动, 最多重试10次
+	// 注意: 一但 WsHeartbeat 失败, startResp.ConnID 变化, 可以通过 WithRefreshStartResp 在重连前重新获取
+	reconnectPolicy := basic.DefaultReconnectPolicy()
+
+	wcs := basic.NewWsClient(startResp, dispatcherHandleMap, basic.DefaultLoggerGenerator()).
+		WithOnClose(onCloseHandle).
+		WithReconnect(reconnectPolicy)
+
+	if err := wcs.Start(); err != nil {
 		panic(err)
 	}
 
@@ -99,29 +100,3 @@ func main() {
 		}
 	}
 }
-
-func messageHandle(wcs *basic.WsClient, msg *proto.Message) error {
-	// 单条消息raw
-	log.Println(string(msg.Payload()))
-
-	//// 自动解析
-	//cmd, data, err := proto.AutomaticParsingMessageCommand(msg.Payload())
-	//if err != nil {
-	//    return err
-	//}
-	//
-	//// Switch cmd
-	//// 由于open-home 和open-live 的命令并不一致 所以更推荐使用 switch data.(type) 进行类型判断,不然你就要自己case 2个cmd
-	//switch cmd {
-	//case proto.CmdLiveOpenPlatformDanmu:
-	//    log.Println(cmd, data.(*proto.CmdDanmuData))
-	//}
-	//
-	//// Switch data type
-	//switch v := data.(type) {
-	//case *proto.CmdDanmuData:
-	//    log.Println(cmd, v)
-	//}
-	//
-	return nil
-}
@@ -3,6 +3,7 @@ module github.com/vtb-link/bianka
 go 1.20
 
 require (
+	github.com/andybalholm/brotli v1.1.0
 	github.com/go-resty/resty/v2 v2.16.3
 	github.com/gorilla/websocket v1.5.3
 	github.com/pkg/errors v0.9.1
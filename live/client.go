@@ -40,6 +40,10 @@ const (
 	CloseReceivedShutdownMessage = basic.CloseReceivedShutdownMessage
 	// CloseTypeUnknown 未知原因
 	CloseTypeUnknown = basic.CloseTypeUnknown
+	// CloseInteractionEnd 收到消息推送结束通知
+	CloseInteractionEnd = basic.CloseInteractionEnd
+	// CloseServerGoingAway 服务端下线/重启, 可以重连
+	CloseServerGoingAway = basic.CloseServerGoingAway
 )
 
 type WsClientCloseCallback func(wsClient *WsClient, startResp *AppStartResponse, closeType int)
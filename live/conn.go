@@ -0,0 +1,401 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+package live
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vtb-link/bianka/basic"
+	"github.com/vtb-link/bianka/openhome"
+	"golang.org/x/exp/slog"
+)
+
+var (
+	// ErrConnStarted 重复启动
+	ErrConnStarted = errors.New("openhome conn already started")
+
+	// ErrConnTooManyRestarts 连续重启次数过多
+	ErrConnTooManyRestarts = errors.New("openhome conn too many restarts")
+)
+
+// OpenhomeConn 管理一个 openhome 直播长连接 (conn_id) 的生命周期
+// 包含 WsStart, 长连接, 断线重连以及失效重启, 心跳由 SessionPool 批量完成
+type OpenhomeConn struct {
+	live        *openhome.Live
+	key         string
+	accessToken string
+	logger      *slog.Logger
+
+	dispatcher  basic.DispatcherHandleMap
+	reconnect   *basic.ReconnectPolicy
+	maxRestarts int
+
+	onStart func(c *OpenhomeConn, startResp *openhome.WsStartResp)
+	onError func(c *OpenhomeConn, err error)
+	onStop  func(c *OpenhomeConn, err error)
+
+	mu        sync.Mutex
+	startResp *openhome.WsStartResp
+	wsClient  *basic.WsClient
+	started   bool
+	cancel    context.CancelFunc
+	wsCtx     context.Context
+
+	restarts          int // 距离上一次心跳成功的重启次数
+	totalRestarts     int
+	pendingRestart    bool // 长连接断开或重启失败, 等待下一次心跳时重启
+	lastHeartbeat     time.Time
+	heartbeatFailures int // 连续心跳失败次数
+	lastErr           error
+
+	done     chan struct{}
+	err      error
+	stopOnce sync.Once
+}
+
+// NewOpenhomeConn 创建一个 OpenhomeConn
+// key 用于在 SessionPool 中区分长连接, 例如 openid; accessToken 同 openhome.Live.WsStart, 可以使用 openhome.OpenIDToken
+// dispatcherHandleMap 与 basic.StartWebsocket 一致, logger 为空时使用 basic.DefaultLoggerGenerator
+func NewOpenhomeConn(live *openhome.Live, key, accessToken string, dispatcherHandleMap basic.DispatcherHandleMap, logger *slog.Logger) *OpenhomeConn {
+	if logger == nil {
+		logger = basic.DefaultLoggerGenerator()
+	}
+
+	return &OpenhomeConn{
+		live:        live,
+		key:         key,
+		accessToken: accessToken,
+		logger:      logger,
+
+		dispatcher:  dispatcherHandleMap,
+		reconnect:   basic.DefaultReconnectPolicy(),
+		maxRestarts: DefaultMaxRestarts,
+
+		done: make(chan struct{}),
+	}
+}
+
+// WithReconnect 设置长连接重连策略, 为空时不自动重连, 断线后等待下一次心跳时重启
+func (c *OpenhomeConn) WithReconnect(policy *basic.ReconnectPolicy) *OpenhomeConn {
+	c.reconnect = policy
+	return c
+}
+
+// WithMaxRestarts 设置连续重启的最大次数, 小于等于0表示不限制
+func (c *OpenhomeConn) WithMaxRestarts(maxRestarts int) *OpenhomeConn {
+	c.maxRestarts = maxRestarts
+	return c
+}
+
+// WithOnStart 启动回调, 每次(重新) WsStart 并建立长连接后触发
+func (c *OpenhomeConn) WithOnStart(onStart func(c *OpenhomeConn, startResp *openhome.WsStartResp)) *OpenhomeConn {
+	c.onStart = onStart
+	return c
+}
+
+// WithOnError 错误回调, 例如心跳失败, 重启失败
+func (c *OpenhomeConn) WithOnError(onError func(c *OpenhomeConn, err error)) *OpenhomeConn {
+	c.onError = onError
+	return c
+}
+
+// WithOnStop 结束回调, err 为空表示调用者主动结束
+func (c *OpenhomeConn) WithOnStop(onStop func(c *OpenhomeConn, err error)) *OpenhomeConn {
+	c.onStop = onStop
+	return c
+}
+
+// Key 长连接的标识
+func (c *OpenhomeConn) Key() string {
+	return c.key
+}
+
+// StartResp 当前的长连接信息
+func (c *OpenhomeConn) StartResp() *openhome.WsStartResp {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.startResp
+}
+
+// WsClient 当前的长连接
+func (c *OpenhomeConn) WsClient() *basic.WsClient {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.wsClient
+}
+
+// ConnHealth 运行状态
+type ConnHealth struct {
+	Key               string    `json:"key"`
+	ConnID            string    `json:"conn_id"`
+	Running           bool      `json:"running"`
+	PendingRestart    bool      `json:"pending_restart"`    // 等待重启
+	LastHeartbeat     time.Time `json:"last_heartbeat"`     // 上一次心跳成功的时间
+	HeartbeatFailures int       `json:"heartbeat_failures"` // 连续心跳失败次数
+	Restarts          int       `json:"restarts"`           // 累计重启次数
+	LastError         error     `json:"-"`
+}
+
+// Health 运行状态
+func (c *OpenhomeConn) Health() ConnHealth {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	health := ConnHealth{
+		Key:               c.key,
+		Running:           c.started && !c.isDone(),
+		PendingRestart:    c.pendingRestart,
+		LastHeartbeat:     c.lastHeartbeat,
+		HeartbeatFailures: c.heartbeatFailures,
+		Restarts:          c.totalRestarts,
+		LastError:         c.lastErr,
+	}
+
+	if c.startResp != nil {
+		health.ConnID = c.startResp.ConnID
+	}
+
+	return health
+}
+
+func (c *OpenhomeConn) isDone() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Done 结束后关闭
+func (c *OpenhomeConn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err 结束原因, 主动结束时为空
+func (c *OpenhomeConn) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// PendingRestart 是否等待重启
+func (c *OpenhomeConn) PendingRestart() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.pendingRestart
+}
+
+// Start WsStart 并建立长连接
+// ctx 仅用于启动过程, 之后的生命周期由 Stop 控制
+func (c *OpenhomeConn) Start(ctx context.Context) error {
+	wsCtx, cancel := context.WithCancel(context.Background())
+
+	c.mu.Lock()
+	if c.started {
+		c.mu.Unlock()
+		cancel()
+		return ErrConnStarted
+	}
+	c.started = true
+	c.wsCtx, c.cancel = wsCtx, cancel
+	c.mu.Unlock()
+
+	if err := c.start(ctx); err != nil {
+		c.stop(err)
+		return err
+	}
+
+	return nil
+}
+
+// Stop 关闭长连接
+func (c *OpenhomeConn) Stop() {
+	c.mu.Lock()
+	started := c.started
+	c.mu.Unlock()
+
+	// 未启动时不占用 stopOnce, 之后启动的长连接仍然可以结束
+	if started {
+		c.stop(nil)
+	}
+}
+
+// reportHeartbeat 记录心跳结果, 返回是否需要重启
+func (c *OpenhomeConn) reportHeartbeat(err error, connInvalid bool) bool {
+	c.mu.Lock()
+	if err == nil {
+		c.restarts = 0
+		c.heartbeatFailures = 0
+		c.lastHeartbeat = time.Now()
+		c.mu.Unlock()
+		return false
+	}
+
+	c.heartbeatFailures++
+	c.lastErr = err
+	connID := ""
+	if c.startResp != nil {
+		connID = c.startResp.ConnID
+	}
+	c.mu.Unlock()
+
+	c.logger.Error("openhome conn heartbeat fail", slog.String("conn_id", connID), slog.String("err", err.Error()))
+	c.emitError(err)
+
+	return connInvalid
+}
+
+// restart 重新 WsStart 并建立长连接, 连续重启次数过多时结束
+func (c *OpenhomeConn) restart(ctx context.Context) {
+	c.mu.Lock()
+	if c.maxRestarts > 0 && c.restarts >= c.maxRestarts {
+		c.mu.Unlock()
+
+		c.logger.Error("openhome conn fail", slog.String("err", ErrConnTooManyRestarts.Error()))
+		c.stop(ErrConnTooManyRestarts)
+		return
+	}
+
+	c.restarts++
+	c.totalRestarts++
+	restarts := c.restarts
+	wsClient := c.wsClient
+	c.wsClient = nil
+	c.mu.Unlock()
+
+	c.logger.Info("openhome conn restart", slog.Int("restarts", restarts))
+
+	if wsClient != nil {
+		_ = wsClient.Close()
+	}
+
+	err := c.start(ctx)
+
+	c.mu.Lock()
+	c.pendingRestart = err != nil
+	if err != nil {
+		c.lastErr = err
+	}
+	c.mu.Unlock()
+
+	if err != nil && ctx.Err() == nil {
+		c.emitError(err)
+	}
+}
+
+// start WsStart 并建立长连接, 长连接的生命周期为 c.wsCtx
+func (c *OpenhomeConn) start(ctx context.Context) error {
+	startResp, err := c.live.WsStartCtx(ctx, c.accessToken)
+	if err != nil {
+		return errors.WithMessage(err, "openhome conn start fail")
+	}
+
+	c.mu.Lock()
+	c.startResp = startResp
+	wsCtx := c.wsCtx
+	c.mu.Unlock()
+
+	logger := c.logger.With(slog.String("conn_id", startResp.ConnID))
+	wsClient := basic.NewWsClient(startResp, c.dispatcher, logger).
+		WithOnClose(c.onWsClose)
+
+	if c.reconnect != nil {
+		policy := *c.reconnect
+		policy.RefreshStartResp = func(_ context.Context, _ basic.StartResp, _ int) (basic.StartResp, error) {
+			return c.StartResp(), nil
+		}
+		wsClient.WithReconnect(&policy)
+	}
+
+	if err = wsClient.StartCtx(wsCtx); err != nil {
+		return errors.WithMessage(err, "openhome conn start websocket fail")
+	}
+
+	c.mu.Lock()
+	// 启动过程中已经结束
+	if c.isDone() {
+		c.mu.Unlock()
+		_ = wsClient.Close()
+		return nil
+	}
+	c.wsClient = wsClient
+	c.mu.Unlock()
+
+	c.logger.Info("openhome conn started", slog.String("conn_id", startResp.ConnID))
+	if c.onStart != nil {
+		c.onStart(c, startResp)
+	}
+
+	return nil
+}
+
+// onWsClose 长连接最终关闭(放弃重连或终止关闭)后, 等待下一次心跳时重启
+func (c *OpenhomeConn) onWsClose(wsClient *basic.WsClient, _ basic.StartResp, closeType int) {
+	c.mu.Lock()
+	current := c.wsClient == wsClient
+	if current {
+		c.pendingRestart = true
+	}
+	c.mu.Unlock()
+
+	if current {
+		c.logger.Info("openhome conn websocket closed", slog.Int("close_type", closeType))
+	}
+}
+
+func (c *OpenhomeConn) emitError(err error) {
+	if c.onError != nil {
+		c.onError(c, err)
+	}
+}
+
+// stop 关闭长连接并结束, Err 返回 err
+func (c *OpenhomeConn) stop(err error) {
+	c.stopOnce.Do(func() {
+		c.mu.Lock()
+		cancel, wsClient := c.cancel, c.wsClient
+		c.wsClient = nil
+		c.err = err
+		close(c.done)
+		c.mu.Unlock()
+
+		cancel()
+		if wsClient != nil {
+			_ = wsClient.Close()
+		}
+
+		if c.onStop != nil {
+			c.onStop(c, err)
+		}
+	})
+}
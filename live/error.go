@@ -11,4 +11,36 @@ var (
 
 	// BilibiliWebsocketAuthFailed 发生在websocket连接建立后，发送auth请求后，收到的响应不是success
 	BilibiliWebsocketAuthFailed = errors.BilibiliWebsocketAuthFailed
+
+	// ErrInvalidCode 身份码错误, 见 errors.APIError
+	ErrInvalidCode = errors.ErrInvalidCode
+
+	// ErrGameAlreadyStarted 房间重复游戏
+	ErrGameAlreadyStarted = errors.ErrGameAlreadyStarted
+
+	// ErrGameIDInvalid 心跳过期或GameId错误
+	ErrGameIDInvalid = errors.ErrGameIDInvalid
+)
+
+// APIError 接口返回的错误
+type APIError = errors.APIError
+
+// 开放平台错误码
+const (
+	// CodeInvalidParams 参数错误
+	CodeInvalidParams = 4000
+	// CodeInvalidApp 应用无效
+	CodeInvalidApp = 4001
+	// CodeInvalidSignature 签名错误
+	CodeInvalidSignature = 4002
+	// CodeRequestExpired 请求过期, 时间戳误差过大
+	CodeRequestExpired = 4003
+	// CodeDuplicateRequest 重复请求, nonce 重复
+	CodeDuplicateRequest = 4004
+	// CodeGameAlreadyStarted 房间重复游戏, 需要先 AppEnd
+	CodeGameAlreadyStarted = 7002
+	// CodeGameIDInvalid 心跳过期或GameId错误, 需要重新调用 AppStart
+	CodeGameIDInvalid = 7003
+	// CodeInvalidCode 身份码错误
+	CodeInvalidCode = 7007
 )
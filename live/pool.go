@@ -0,0 +1,550 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package live
+
+import (
+	"context"
+	stderrors "errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vtb-link/bianka/basic"
+	"github.com/vtb-link/bianka/openhome"
+	"golang.org/x/exp/slog"
+)
+
+// BatchHeartbeatMaxSize 批量心跳单次最多的 game_id / conn_id 数量
+const BatchHeartbeatMaxSize = 200
+
+var (
+	// ErrSessionExists 身份码对应的 Session 已存在
+	ErrSessionExists = errors.New("session already exists")
+
+	// ErrSessionNotFound 身份码对应的 Session 不存在
+	ErrSessionNotFound = errors.New("session not found")
+
+	// ErrSessionPoolClosed SessionPool 已关闭
+	ErrSessionPoolClosed = errors.New("session pool closed")
+
+	// ErrBatchHeartbeatFailed 批量心跳返回的失败场次
+	ErrBatchHeartbeatFailed = errors.New("batch heartbeat failed")
+
+	// ErrConnExists key 对应的 OpenhomeConn 已存在
+	ErrConnExists = errors.New("openhome conn already exists")
+
+	// ErrConnNotFound key 对应的 OpenhomeConn 不存在
+	ErrConnNotFound = errors.New("openhome conn not found")
+
+	// ErrOpenhomeNotSet 未通过 WithOpenhome 设置 openhome.Live
+	ErrOpenhomeNotSet = errors.New("session pool openhome not set")
+)
+
+// SessionPool 管理多个主播的 Session 以及 openhome 长连接
+// 直播开放平台的 game_id 使用 AppBatchHeartbeat, 只重启 FailedGameIds 中的场次
+// openhome 的 conn_id 按 access_token 分组使用 WsBatchHeartbeat, 只重启 FailedConnIds 中的长连接
+type SessionPool struct {
+	client   *Client
+	openhome *openhome.Live
+	logger   *slog.Logger
+
+	heartbeatInterval time.Duration
+	batchSize         int
+	sessionOption     func(s *Session)
+	connOption        func(c *OpenhomeConn)
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+	conns    map[string]*OpenhomeConn
+	closed   bool
+	cancel   context.CancelFunc
+	loopDone chan struct{}
+}
+
+// NewSessionPool 创建一个 SessionPool, logger 为空时使用 basic.DefaultLoggerGenerator
+func NewSessionPool(client *Client, logger *slog.Logger) *SessionPool {
+	if logger == nil {
+		logger = basic.DefaultLoggerGenerator()
+	}
+
+	return &SessionPool{
+		client: client,
+		logger: logger,
+
+		heartbeatInterval: DefaultHeartbeatInterval,
+		batchSize:         BatchHeartbeatMaxSize,
+
+		sessions: map[string]*Session{},
+		conns:    map[string]*OpenhomeConn{},
+		loopDone: make(chan struct{}),
+	}
+}
+
+// WithHeartbeatInterval 设置批量心跳间隔
+func (p *SessionPool) WithHeartbeatInterval(interval time.Duration) *SessionPool {
+	p.heartbeatInterval = interval
+	return p
+}
+
+// WithBatchSize 设置单次批量心跳的数量, 不超过 BatchHeartbeatMaxSize
+func (p *SessionPool) WithBatchSize(batchSize int) *SessionPool {
+	if batchSize <= 0 || batchSize > BatchHeartbeatMaxSize {
+		batchSize = BatchHeartbeatMaxSize
+	}
+
+	p.batchSize = batchSize
+	return p
+}
+
+// WithSessionOption 创建 Session 时调用, 可用于设置回调, 重连策略等
+// 心跳间隔由 SessionPool 接管, 在此设置无效
+func (p *SessionPool) WithSessionOption(option func(s *Session)) *SessionPool {
+	p.sessionOption = option
+	return p
+}
+
+// WithOpenhome 设置 openhome 长连接使用的 openhome.Live, AddConn 前必须设置
+func (p *SessionPool) WithOpenhome(live *openhome.Live) *SessionPool {
+	p.openhome = live
+	return p
+}
+
+// WithConnOption 创建 OpenhomeConn 时调用, 可用于设置回调, 重连策略等
+func (p *SessionPool) WithConnOption(option func(c *OpenhomeConn)) *SessionPool {
+	p.connOption = option
+	return p
+}
+
+// Start 开始批量心跳
+// Add 时会自动开始, 重复调用无影响
+func (p *SessionPool) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed || p.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	go p.loop(ctx)
+}
+
+// Add 添加并启动一个 Session, 并开始批量心跳
+// 同一个身份码已存在且未结束时返回 ErrSessionExists
+func (p *SessionPool) Add(ctx context.Context, code string, dispatcherHandleMap basic.DispatcherHandleMap) (*Session, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrSessionPoolClosed
+	}
+
+	if exists, ok := p.sessions[code]; ok && !exists.isDone() {
+		p.mu.Unlock()
+		return nil, ErrSessionExists
+	}
+	p.mu.Unlock()
+
+	session := NewSession(p.client, code, dispatcherHandleMap, p.logger.With(slog.String("code", code)))
+	if p.sessionOption != nil {
+		p.sessionOption(session)
+	}
+	session.WithHeartbeatInterval(0)
+
+	if err := session.Start(ctx); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	if exists, ok := p.sessions[code]; p.closed || (ok && !exists.isDone()) {
+		closed := p.closed
+		p.mu.Unlock()
+
+		_ = session.Stop()
+		if closed {
+			return nil, ErrSessionPoolClosed
+		}
+		return nil, ErrSessionExists
+	}
+
+	p.sessions[code] = session
+	p.mu.Unlock()
+
+	p.Start()
+	return session, nil
+}
+
+// Remove 结束并移除一个 Session
+func (p *SessionPool) Remove(code string) error {
+	p.mu.Lock()
+	session, ok := p.sessions[code]
+	delete(p.sessions, code)
+	p.mu.Unlock()
+
+	if !ok {
+		return ErrSessionNotFound
+	}
+
+	return session.Stop()
+}
+
+// Get 获取身份码对应的 Session
+func (p *SessionPool) Get(code string) (*Session, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	session, ok := p.sessions[code]
+	return session, ok
+}
+
+// Health 所有 Session 的运行状态, 按身份码排序
+func (p *SessionPool) Health() []SessionHealth {
+	sessions := p.snapshot()
+
+	healths := make([]SessionHealth, 0, len(sessions))
+	for _, session := range sessions {
+		healths = append(healths, session.Health())
+	}
+
+	sort.Slice(healths, func(i, j int) bool {
+		return healths[i].Code < healths[j].Code
+	})
+
+	return healths
+}
+
+// AddConn 添加并启动一个 openhome 长连接, 并开始批量心跳
+// key 用于区分长连接, 例如 openid; 同一个 key 已存在且未结束时返回 ErrConnExists
+func (p *SessionPool) AddConn(ctx context.Context, key, accessToken string, dispatcherHandleMap basic.DispatcherHandleMap) (*OpenhomeConn, error) {
+	if p.openhome == nil {
+		return nil, ErrOpenhomeNotSet
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, ErrSessionPoolClosed
+	}
+
+	if exists, ok := p.conns[key]; ok && !exists.isDone() {
+		p.mu.Unlock()
+		return nil, ErrConnExists
+	}
+	p.mu.Unlock()
+
+	conn := NewOpenhomeConn(p.openhome, key, accessToken, dispatcherHandleMap, p.logger.With(slog.String("key", key)))
+	if p.connOption != nil {
+		p.connOption(conn)
+	}
+
+	if err := conn.Start(ctx); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	if exists, ok := p.conns[key]; p.closed || (ok && !exists.isDone()) {
+		closed := p.closed
+		p.mu.Unlock()
+
+		conn.Stop()
+		if closed {
+			return nil, ErrSessionPoolClosed
+		}
+		return nil, ErrConnExists
+	}
+
+	p.conns[key] = conn
+	p.mu.Unlock()
+
+	p.Start()
+	return conn, nil
+}
+
+// RemoveConn 关闭并移除一个 openhome 长连接
+func (p *SessionPool) RemoveConn(key string) error {
+	p.mu.Lock()
+	conn, ok := p.conns[key]
+	delete(p.conns, key)
+	p.mu.Unlock()
+
+	if !ok {
+		return ErrConnNotFound
+	}
+
+	conn.Stop()
+	return nil
+}
+
+// GetConn 获取 key 对应的 openhome 长连接
+func (p *SessionPool) GetConn(key string) (*OpenhomeConn, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	conn, ok := p.conns[key]
+	return conn, ok
+}
+
+// ConnHealth 所有 openhome 长连接的运行状态, 按 key 排序
+func (p *SessionPool) ConnHealth() []ConnHealth {
+	conns := p.connSnapshot()
+
+	healths := make([]ConnHealth, 0, len(conns))
+	for _, conn := range conns {
+		healths = append(healths, conn.Health())
+	}
+
+	sort.Slice(healths, func(i, j int) bool {
+		return healths[i].Key < healths[j].Key
+	})
+
+	return healths
+}
+
+// Close 停止批量心跳并结束所有 Session 以及 openhome 长连接
+func (p *SessionPool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	cancel := p.cancel
+	p.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-p.loopDone
+	}
+
+	var errs []error
+	for _, session := range p.snapshot() {
+		if err := session.Stop(); err != nil {
+			errs = append(errs, errors.WithMessagef(err, "stop session fail, code: %s", session.Code()))
+		}
+	}
+
+	for _, conn := range p.connSnapshot() {
+		conn.Stop()
+	}
+
+	return stderrors.Join(errs...)
+}
+
+func (p *SessionPool) snapshot() []*Session {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sessions := make([]*Session, 0, len(p.sessions))
+	for _, session := range p.sessions {
+		sessions = append(sessions, session)
+	}
+
+	return sessions
+}
+
+func (p *SessionPool) connSnapshot() []*OpenhomeConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	conns := make([]*OpenhomeConn, 0, len(p.conns))
+	for _, conn := range p.conns {
+		conns = append(conns, conn)
+	}
+
+	return conns
+}
+
+func (p *SessionPool) loop(ctx context.Context) {
+	defer close(p.loopDone)
+
+	ticker := time.NewTicker(p.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.heartbeat(ctx)
+			p.heartbeatConns(ctx)
+		}
+	}
+}
+
+// heartbeat 一轮批量心跳
+func (p *SessionPool) heartbeat(ctx context.Context) {
+	sessions := p.snapshot()
+	byGameID := make(map[string]*Session, len(sessions))
+	gameIDs := make([]string, 0, len(sessions))
+
+	for _, session := range sessions {
+		if session.isDone() {
+			continue
+		}
+
+		// 重启失败的 Session 不参与心跳, 直接重试
+		if session.PendingRestart() {
+			session.Restart()
+			continue
+		}
+
+		startResp := session.StartResp()
+		if startResp == nil {
+			continue
+		}
+
+		byGameID[startResp.GameInfo.GameID] = session
+		gameIDs = append(gameIDs, startResp.GameInfo.GameID)
+	}
+
+	for start := 0; start < len(gameIDs); start += p.batchSize {
+		end := start + p.batchSize
+		if end > len(gameIDs) {
+			end = len(gameIDs)
+		}
+
+		batch := gameIDs[start:end]
+		resp, err := p.client.AppBatchHeartbeatCtx(ctx, batch)
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err != nil {
+			p.logger.Error("session pool batch heartbeat fail", slog.Int("size", len(batch)), slog.String("err", err.Error()))
+			for _, gameID := range batch {
+				byGameID[gameID].reportHeartbeat(err, false)
+			}
+			continue
+		}
+
+		failed := make(map[string]bool, len(resp.FailedGameIds))
+		for _, gameID := range resp.FailedGameIds {
+			failed[gameID] = true
+		}
+
+		for _, gameID := range batch {
+			session := byGameID[gameID]
+			if !failed[gameID] {
+				session.reportHeartbeat(nil, false)
+				continue
+			}
+
+			// 心跳期间可能已经重启过
+			if current := session.StartResp(); current == nil || current.GameInfo.GameID != gameID {
+				continue
+			}
+
+			err := errors.Wrapf(ErrBatchHeartbeatFailed, "game_id: %s", gameID)
+			if session.reportHeartbeat(err, true) {
+				session.Restart()
+			}
+		}
+	}
+}
+
+// heartbeatConns 一轮 openhome 长连接批量心跳
+// WsBatchHeartbeat 按 access_token 调用, 失败的长连接在本轮心跳结束后依次重启
+func (p *SessionPool) heartbeatConns(ctx context.Context) {
+	conns := p.connSnapshot()
+	byConnID := make(map[string]*OpenhomeConn, len(conns))
+	byToken := map[string][]string{}
+	tokens := make([]string, 0, len(conns))
+	var restarts []*OpenhomeConn
+
+	for _, conn := range conns {
+		if conn.isDone() {
+			continue
+		}
+
+		// 长连接断开或重启失败的不参与心跳, 直接重启
+		if conn.PendingRestart() {
+			restarts = append(restarts, conn)
+			continue
+		}
+
+		startResp := conn.StartResp()
+		if startResp == nil {
+			continue
+		}
+
+		if _, ok := byToken[conn.accessToken]; !ok {
+			tokens = append(tokens, conn.accessToken)
+		}
+		byConnID[startResp.ConnID] = conn
+		byToken[conn.accessToken] = append(byToken[conn.accessToken], startResp.ConnID)
+	}
+
+	for _, token := range tokens {
+		connIDs := byToken[token]
+		for start := 0; start < len(connIDs); start += p.batchSize {
+			end := start + p.batchSize
+			if end > len(connIDs) {
+				end = len(connIDs)
+			}
+
+			batch := connIDs[start:end]
+			resp, err := p.openhome.WsBatchHeartbeatCtx(ctx, token, batch...)
+			if ctx.Err() != nil {
+				return
+			}
+
+			if err != nil {
+				p.logger.Error("session pool conn batch heartbeat fail", slog.Int("size", len(batch)), slog.String("err", err.Error()))
+				for _, connID := range batch {
+					byConnID[connID].reportHeartbeat(err, false)
+				}
+				continue
+			}
+
+			failed := make(map[string]bool, len(resp.FailedConnIds))
+			for _, connID := range resp.FailedConnIds {
+				failed[connID] = true
+			}
+
+			for _, connID := range batch {
+				conn := byConnID[connID]
+				if !failed[connID] {
+					conn.reportHeartbeat(nil, false)
+					continue
+				}
+
+				err := errors.Wrapf(ErrBatchHeartbeatFailed, "conn_id: %s", connID)
+				if conn.reportHeartbeat(err, true) {
+					restarts = append(restarts, conn)
+				}
+			}
+		}
+	}
+
+	for _, conn := range restarts {
+		if ctx.Err() != nil {
+			return
+		}
+		if !conn.isDone() {
+			conn.restart(ctx)
+		}
+	}
+}
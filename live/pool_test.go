@@ -0,0 +1,277 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package live
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vtb-link/bianka/openhome"
+	"github.com/vtb-link/bianka/testserver"
+	"golang.org/x/exp/slog"
+)
+
+func TestSessionPool_BatchHeartbeat(t *testing.T) {
+	f := newFakeOpenLive(t)
+	f.invalid["game-2"] = true
+
+	pool := NewSessionPool(f.client(), slog.New(slog.NewTextHandler(io.Discard, nil))).
+		WithHeartbeatInterval(time.Millisecond * 20).
+		WithBatchSize(2)
+	defer pool.Close()
+
+	// Add 后无需 Start 即开始批量心跳
+	for _, code := range []string{"a", "b", "c"} {
+		if _, err := pool.Add(context.Background(), code, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := pool.Add(context.Background(), "a", nil); !errors.Is(err, ErrSessionExists) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// game-2 失败后只重启对应的 Session
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		session, _ := pool.Get("b")
+		if session.StartResp().GameInfo.GameID == "game-4" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("wait restart timeout")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	healths := pool.Health()
+	if len(healths) != 3 {
+		t.Fatalf("unexpected healths %v", healths)
+	}
+	for _, health := range healths {
+		expectedRestarts := 0
+		if health.Code == "b" {
+			expectedRestarts = 1
+		}
+		if !health.Running || health.Restarts != expectedRestarts {
+			t.Fatalf("unexpected health %+v", health)
+		}
+	}
+
+	if err := pool.Remove("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Remove("a"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.heartbeats != 0 {
+		t.Fatalf("single heartbeat should not be used, got %d", f.heartbeats)
+	}
+
+	for _, batch := range f.batches {
+		if len(batch) == 0 || len(batch) > 2 {
+			t.Fatalf("unexpected batch %v", batch)
+		}
+	}
+
+	ended := map[string]bool{}
+	for _, gameID := range f.ended {
+		ended[gameID] = true
+	}
+	if !ended["game-1"] || !ended["game-2"] || ended["game-3"] {
+		t.Fatalf("unexpected ended games %v", f.ended)
+	}
+}
+
+// fakeOpenhome 本地的 openhome 直播长连接接口, 长连接使用 testserver
+type fakeOpenhome struct {
+	api *httptest.Server
+	ws  *testserver.Server
+
+	mu      sync.Mutex
+	conns   int
+	tokens  map[string]string // conn_id -> access_token
+	batches [][]string
+	failed  map[string]bool
+}
+
+func newFakeOpenhome(t *testing.T) *fakeOpenhome {
+	f := &fakeOpenhome{
+		ws:     testserver.NewServer(),
+		tokens: map[string]string{},
+		failed: map[string]bool{},
+	}
+	t.Cleanup(f.ws.Close)
+
+	f.api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("access_token")
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		var data interface{}
+		switch r.URL.Path {
+		case "/arcopen/fn/live/room/ws-start":
+			f.conns++
+			connID := fmt.Sprintf("conn-%d", f.conns)
+			f.tokens[connID] = token
+			startResp := f.ws.StartResp("auth-" + connID)
+			data = map[string]interface{}{
+				"conn_id": connID,
+				"websocket_info": map[string]interface{}{
+					"auth_body": startResp.AuthBody,
+					"wss_link":  startResp.Links,
+				},
+			}
+		case "/arcopen/fn/live/room/ws-batch-heartbeat":
+			var req struct {
+				ConnIDs []string `json:"conn_ids"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&req)
+
+			f.batches = append(f.batches, req.ConnIDs)
+			failed := []string{}
+			for _, connID := range req.ConnIDs {
+				if f.tokens[connID] != token {
+					t.Errorf("conn %s heartbeat with unexpected token %s", connID, token)
+				}
+				if f.failed[connID] {
+					failed = append(failed, connID)
+				}
+			}
+			data = map[string]interface{}{"failed_conn_ids": failed}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"code": 0, "message": "0", "data": data})
+	}))
+	t.Cleanup(f.api.Close)
+
+	return f
+}
+
+func (f *fakeOpenhome) live() *openhome.Live {
+	return openhome.NewAppClient(&openhome.AppConfig{
+		ClientID:   "cid",
+		MemberHost: f.api.URL,
+	}).Live
+}
+
+func TestSessionPool_ConnBatchHeartbeat(t *testing.T) {
+	f := newFakeOpenhome(t)
+	f.failed["conn-2"] = true
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if _, err := NewSessionPool(nil, logger).AddConn(context.Background(), "a", "token-1", nil); !errors.Is(err, ErrOpenhomeNotSet) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	pool := NewSessionPool(nil, logger).
+		WithOpenhome(f.live()).
+		WithHeartbeatInterval(time.Millisecond * 20).
+		WithBatchSize(2)
+	defer pool.Close()
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		token := "token-1"
+		if key == "d" {
+			token = "token-2"
+		}
+		if _, err := pool.AddConn(context.Background(), key, token, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := pool.AddConn(context.Background(), "a", "token-1", nil); !errors.Is(err, ErrConnExists) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// conn-2 失败后只重启对应的长连接
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		conn, _ := pool.GetConn("b")
+		if conn.StartResp().ConnID == "conn-5" && !conn.Health().LastHeartbeat.IsZero() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("wait restart timeout")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	healths := pool.ConnHealth()
+	if len(healths) != 4 {
+		t.Fatalf("unexpected healths %v", healths)
+	}
+	for _, health := range healths {
+		expectedRestarts := 0
+		if health.Key == "b" {
+			expectedRestarts = 1
+		}
+		if !health.Running || health.Restarts != expectedRestarts {
+			t.Fatalf("unexpected health %+v", health)
+		}
+	}
+
+	if err := pool.RemoveConn("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.RemoveConn("a"); !errors.Is(err, ErrConnNotFound) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, batch := range f.batches {
+		if len(batch) == 0 || len(batch) > 2 {
+			t.Fatalf("unexpected batch %v", batch)
+		}
+	}
+
+	auths := map[string]bool{}
+	for _, body := range f.ws.AuthBodies() {
+		auths[body] = true
+	}
+	for _, connID := range []string{"conn-1", "conn-2", "conn-3", "conn-4", "conn-5"} {
+		if !auths["auth-"+connID] {
+			t.Fatalf("conn %s should connect websocket, got %v", connID, auths)
+		}
+	}
+}
@@ -24,6 +24,7 @@
 package live
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"strconv"
@@ -32,6 +33,7 @@ import (
 	"github.com/go-resty/resty/v2"
 	"github.com/pkg/errors"
 	"github.com/vtb-link/bianka/basic"
+	ierrors "github.com/vtb-link/bianka/errors"
 )
 
 const (
@@ -43,6 +45,14 @@ type Config struct {
 	AccessKeySecret      string // access_key_secret
 	OpenPlatformHttpHost string // 开放平台 (线上环境)
 	AppID                int64  // 应用id
+
+	// RetryPolicy 请求重试策略, 为空时不重试
+	// 重试时沿用同一个 nonce, 并使用新的时间戳重新签名
+	RetryPolicy *basic.RetryPolicy
+
+	// RateLimiter 请求限流, 为空时不限制
+	// 分组见 RateLimitGroupAppStart 等, 其他接口使用请求路径作为分组
+	RateLimiter *basic.RateLimiter
 }
 
 func NewConfig(accessKey, accessKeySecret string, appID int64) *Config {
@@ -54,6 +64,27 @@ func NewConfig(accessKey, accessKeySecret string, appID int64) *Config {
 	}
 }
 
+// 限流分组, 用于 Config.RateLimiter
+const (
+	RateLimitGroupAppStart  = "app_start"
+	RateLimitGroupAppEnd    = "app_end"
+	RateLimitGroupHeartbeat = "app_heartbeat" // 包含批量心跳
+)
+
+// rateLimitGroup 请求路径对应的限流分组
+func rateLimitGroup(reqPath string) string {
+	switch reqPath {
+	case "/v2/app/start":
+		return RateLimitGroupAppStart
+	case "/v2/app/end":
+		return RateLimitGroupAppEnd
+	case "/v2/app/heartbeat", "/v2/app/batchHeartbeat":
+		return RateLimitGroupHeartbeat
+	}
+
+	return reqPath
+}
+
 type Client struct {
 	rCfg *Config
 }
@@ -66,6 +97,11 @@ func NewClient(rCfg *Config) *Client {
 
 // AppStart 启动app
 func (c *Client) AppStart(code string) (*AppStartResponse, error) {
+	return c.AppStartCtx(context.Background(), code)
+}
+
+// AppStartCtx 启动app, 支持传入 context
+func (c *Client) AppStartCtx(ctx context.Context, code string) (*AppStartResponse, error) {
 	startAppReq := AppStartRequest{
 		Code:  code,
 		AppID: c.rCfg.AppID,
@@ -76,7 +112,7 @@ func (c *Client) AppStart(code string) (*AppStartResponse, error) {
 		return nil, errors.Wrap(err, "json marshal fail")
 	}
 
-	resp, err := c.doRequest(string(reqJSON), "/v2/app/start")
+	resp, err := c.doRequest(ctx, string(reqJSON), "/v2/app/start")
 	if err != nil {
 		return nil, errors.WithMessage(err, "start app fail")
 	}
@@ -91,6 +127,11 @@ func (c *Client) AppStart(code string) (*AppStartResponse, error) {
 
 // AppEnd 关闭app
 func (c *Client) AppEnd(gameID string) error {
+	return c.AppEndCtx(context.Background(), gameID)
+}
+
+// AppEndCtx 关闭app, 支持传入 context
+func (c *Client) AppEndCtx(ctx context.Context, gameID string) error {
 	endAppReq := AppEndRequest{
 		GameID: gameID,
 		AppID:  c.rCfg.AppID,
@@ -101,7 +142,7 @@ func (c *Client) AppEnd(gameID string) error {
 		return errors.Wrap(err, "json marshal fail")
 	}
 
-	_, err = c.doRequest(string(reqJSON), "/v2/app/end")
+	_, err = c.doRequest(ctx, string(reqJSON), "/v2/app/end")
 	if err != nil {
 		return errors.WithMessage(err, "end app fail")
 	}
@@ -111,6 +152,11 @@ func (c *Client) AppEnd(gameID string) error {
 
 // AppHeartbeat 心跳
 func (c *Client) AppHeartbeat(gameID string) error {
+	return c.AppHeartbeatCtx(context.Background(), gameID)
+}
+
+// AppHeartbeatCtx 心跳, 支持传入 context
+func (c *Client) AppHeartbeatCtx(ctx context.Context, gameID string) error {
 	heartbeatReq := AppHeartbeatRequest{
 		GameID: gameID,
 	}
@@ -120,7 +166,7 @@ func (c *Client) AppHeartbeat(gameID string) error {
 		return errors.Wrap(err, "json marshal fail")
 	}
 
-	_, err = c.doRequest(string(reqJSON), "/v2/app/heartbeat")
+	_, err = c.doRequest(ctx, string(reqJSON), "/v2/app/heartbeat")
 	if err != nil {
 		return errors.WithMessage(err, "heartbeat fail")
 	}
@@ -130,6 +176,11 @@ func (c *Client) AppHeartbeat(gameID string) error {
 
 // AppBatchHeartbeat 批量心跳
 func (c *Client) AppBatchHeartbeat(gameIDs []string) (*AppBatchHeartbeatResponse, error) {
+	return c.AppBatchHeartbeatCtx(context.Background(), gameIDs)
+}
+
+// AppBatchHeartbeatCtx 批量心跳, 支持传入 context
+func (c *Client) AppBatchHeartbeatCtx(ctx context.Context, gameIDs []string) (*AppBatchHeartbeatResponse, error) {
 	heartbeatReq := AppBatchHeartbeatRequest{
 		GameIDs: gameIDs,
 	}
@@ -139,7 +190,7 @@ func (c *Client) AppBatchHeartbeat(gameIDs []string) (*AppBatchHeartbeatResponse
 		return nil, errors.Wrap(err, "json marshal fail")
 	}
 
-	resp, err := c.doRequest(string(reqJSON), "/v2/app/batchHeartbeat")
+	resp, err := c.doRequest(ctx, string(reqJSON), "/v2/app/batchHeartbeat")
 	if err != nil {
 		return nil, errors.WithMessage(err, "heartbeat fail")
 	}
@@ -176,13 +227,36 @@ func (c *Client) StartWebsocket(startResp *AppStartResponse, dispatcherHandleMap
 	return wsClient, nil
 }
 
-func (c *Client) doRequest(reqJSON, reqPath string) (*BaseResp, error) {
-	return c.DoRequest(reqJSON, reqPath, basic.RandStringBytes(32))
+func (c *Client) doRequest(ctx context.Context, reqJSON, reqPath string) (*BaseResp, error) {
+	return c.DoRequestCtx(ctx, reqJSON, reqPath, basic.RandStringBytes(32))
 }
 
 // DoRequest 发起请求
 // 用于用户自定义请求
 func (c *Client) DoRequest(reqJSON, reqPath, nonce string) (*BaseResp, error) {
+	return c.DoRequestCtx(context.Background(), reqJSON, reqPath, nonce)
+}
+
+// DoRequestCtx 发起请求, 支持传入 context
+// 用于用户自定义请求
+// 接口返回错误时 err 为 *errors.APIError, 非 success 的响应会一并返回
+// 配置了 Config.RetryPolicy 时, 可重试的错误会使用同一个 nonce 重试
+// 配置了 Config.RateLimiter 时, 每次请求前都需要获取令牌
+func (c *Client) DoRequestCtx(ctx context.Context, reqJSON, reqPath, nonce string) (*BaseResp, error) {
+	var result *BaseResp
+	group := rateLimitGroup(reqPath)
+	err := c.rCfg.RetryPolicy.Do(ctx, func(_ int) error {
+		return c.rCfg.RateLimiter.Do(ctx, group, func() (err error) {
+			result, err = c.doRequestOnce(ctx, reqJSON, reqPath, nonce)
+			return err
+		})
+	})
+
+	return result, err
+}
+
+// doRequestOnce 发起一次请求, 每次都使用新的时间戳签名
+func (c *Client) doRequestOnce(ctx context.Context, reqJSON, reqPath, nonce string) (*BaseResp, error) {
 	header := &CommonHeader{
 		ContentType:       JsonType,
 		ContentAcceptType: JsonType,
@@ -197,6 +271,7 @@ func (c *Client) DoRequest(reqJSON, reqPath, nonce string) (*BaseResp, error) {
 
 	result := BaseResp{}
 	resp, err := resty.New().R().
+		SetContext(ctx).
 		SetHeaders(header.ToMap()).
 		SetBody(reqJSON).
 		SetResult(&result).
@@ -206,15 +281,24 @@ func (c *Client) DoRequest(reqJSON, reqPath, nonce string) (*BaseResp, error) {
 		return nil, errors.Wrapf(err, "request fail, url:%s body: %s", reqPath, reqJSON)
 	}
 
-	if resp.StatusCode() >= http.StatusBadRequest {
-		return nil, errors.Wrapf(BilibiliRequestFailed, "request response not ok, url:%s req: %v code:%d", reqPath, reqJSON, resp.StatusCode())
+	if resp.StatusCode() < http.StatusBadRequest && result.Success() {
+		return &result, nil
 	}
 
-	if !result.Success() {
-		return &result, errors.Wrapf(BilibiliResponseNotSuccess, "bilbil response code not ok, url:%s  body: %s result: %v", reqPath, reqJSON, result)
+	apiErr := &ierrors.APIError{
+		Platform:   ierrors.PlatformOpenLive,
+		Endpoint:   reqPath,
+		HTTPStatus: resp.StatusCode(),
+		Code:       result.Code,
+		Message:    result.Message,
+		RequestID:  result.RequestID,
+	}
+
+	if resp.StatusCode() >= http.StatusBadRequest {
+		return nil, errors.WithStack(apiErr)
 	}
 
-	return &result, nil
+	return &result, errors.WithStack(apiErr)
 }
 
 // VerifyH5RequestSignature 验证h5请求签名
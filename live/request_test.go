@@ -24,8 +24,16 @@
 package live
 
 import (
+	"errors"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/vtb-link/bianka/basic"
 )
 
 func TestClient_VerifyH5RequestSignatureWithParams(t *testing.T) {
@@ -49,3 +57,98 @@ func TestClient_VerifyH5RequestSignatureWithParams(t *testing.T) {
 
 	t.Log("VerifyH5RequestSignatureWithParams success")
 }
+
+func TestClient_DoRequestRetry(t *testing.T) {
+	var mu sync.Mutex
+	var nonces []string
+	responses := []struct {
+		status int
+		body   string
+	}{
+		{http.StatusBadGateway, `{}`},
+		{http.StatusOK, `{"code":4003,"message":"request expired","request_id":"r1"}`},
+		{http.StatusOK, `{"code":0,"message":"0","request_id":"r2","data":{}}`},
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		header := &CommonHeader{
+			Timestamp:        r.Header.Get(BiliTimestampHeader),
+			SignatureMethod:  r.Header.Get(BiliSignatureMethodHeader),
+			SignatureVersion: r.Header.Get(BiliSignVersionHeader),
+			Nonce:            r.Header.Get(BiliSignatureNonceHeader),
+			AccessKeyID:      r.Header.Get(BiliAccessKeyIdHeader),
+			ContentMD5:       r.Header.Get(BiliContentMD5Header),
+		}
+		if header.ContentMD5 != Md5(string(body)) || header.CreateSignature("secret") != r.Header.Get(AuthorizationHeader) {
+			t.Errorf("invalid signature")
+		}
+
+		mu.Lock()
+		nonces = append(nonces, header.Nonce)
+		resp := responses[len(nonces)-1]
+		mu.Unlock()
+
+		w.Header().Set(ContentTypeHeader, JsonType)
+		w.WriteHeader(resp.status)
+		_, _ = w.Write([]byte(resp.body))
+	}))
+	defer srv.Close()
+
+	cfg := NewConfig("key", "secret", 1)
+	cfg.OpenPlatformHttpHost = srv.URL
+	cfg.RetryPolicy = &basic.RetryPolicy{Backoff: basic.Backoff{InitialInterval: time.Millisecond}, MaxAttempts: 3}
+
+	if err := NewClient(cfg).AppHeartbeat("game"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(nonces) != 3 || nonces[0] != nonces[1] || nonces[1] != nonces[2] {
+		t.Fatalf("retry should reuse the nonce, %v", nonces)
+	}
+
+	// 不可重试的错误
+	responses = append(responses, struct {
+		status int
+		body   string
+	}{http.StatusOK, `{"code":7003,"message":"game id invalid"}`})
+
+	err := NewClient(cfg).AppHeartbeat("game")
+	if !errors.Is(err, ErrGameIDInvalid) || len(nonces) != 4 {
+		t.Fatalf("unexpected result %v, requests %d", err, len(nonces))
+	}
+}
+
+func TestClient_RateLimit(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set(ContentTypeHeader, JsonType)
+		_, _ = w.Write([]byte(`{"code":0,"message":"0","data":{}}`))
+	}))
+	defer srv.Close()
+
+	cfg := NewConfig("key", "secret", 1)
+	cfg.OpenPlatformHttpHost = srv.URL
+	cfg.RateLimiter = basic.NewRateLimiter().
+		WithMode(basic.RateLimitModeFailFast).
+		WithGroupLimit(RateLimitGroupHeartbeat, 1, 1)
+
+	client := NewClient(cfg)
+	if err := client.AppHeartbeat("game"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 心跳与批量心跳共享分组
+	if _, err := client.AppBatchHeartbeat([]string{"game"}); !errors.Is(err, basic.ErrRateLimitExceeded) {
+		t.Fatalf("expected ErrRateLimitExceeded, got %v", err)
+	}
+
+	if err := client.AppEnd("game"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Fatalf("unexpected requests %d", n)
+	}
+}
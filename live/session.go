@@ -0,0 +1,549 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package live
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vtb-link/bianka/basic"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// DefaultHeartbeatInterval 项目心跳间隔
+	// see https://open-live.bilibili.com/document/eba8e2e1-847d-e908-2e5c-7a1ec7d9266f
+	DefaultHeartbeatInterval = time.Second * 20
+
+	// DefaultMaxRestarts 连续重启项目的最大次数, 心跳成功后重新计数
+	DefaultMaxRestarts = 3
+)
+
+var (
+	// ErrSessionStarted 重复启动
+	ErrSessionStarted = errors.New("session already started")
+
+	// ErrSessionTooManyRestarts 连续重启次数过多
+	ErrSessionTooManyRestarts = errors.New("session too many restarts")
+
+	// ErrSessionInteractionEnd 收到消息推送结束通知, 项目已被平台结束
+	ErrSessionInteractionEnd = errors.New("session interaction end")
+)
+
+// Session 管理一个主播身份码对应的项目生命周期
+// 包含 AppStart, 项目心跳, 长连接, 断线重连, 失效重启以及 AppEnd
+type Session struct {
+	client *Client
+	code   string
+	logger *slog.Logger
+
+	dispatcher        basic.DispatcherHandleMap
+	heartbeatInterval time.Duration
+	reconnect         *basic.ReconnectPolicy
+	maxRestarts       int
+
+	onStart func(s *Session, startResp *AppStartResponse)
+	onError func(s *Session, err error)
+	onStop  func(s *Session, err error)
+
+	mu        sync.Mutex
+	startResp *AppStartResponse
+	wsClient  *basic.WsClient
+	starting  *basic.WsClient // 正在建立的长连接, 链接成功后才会成为 wsClient
+	started   bool
+
+	restarts          int // 距离上一次心跳成功的重启次数
+	totalRestarts     int
+	pendingRestart    bool // 重启失败, 等待下一次心跳时重试
+	lastHeartbeat     time.Time
+	heartbeatFailures int // 连续心跳失败次数
+	lastErr           error
+
+	restartCh chan struct{}
+	cancel    context.CancelFunc
+	loopDone  chan struct{}
+	done      chan struct{}
+	err       error
+	stopOnce  sync.Once
+	stopErr   error
+}
+
+// NewSession 创建一个 Session
+// dispatcherHandleMap 与 basic.StartWebsocket 一致, logger 为空时使用 basic.DefaultLoggerGenerator
+func NewSession(client *Client, code string, dispatcherHandleMap basic.DispatcherHandleMap, logger *slog.Logger) *Session {
+	if logger == nil {
+		logger = basic.DefaultLoggerGenerator()
+	}
+
+	return &Session{
+		client: client,
+		code:   code,
+		logger: logger,
+
+		dispatcher:        dispatcherHandleMap,
+		heartbeatInterval: DefaultHeartbeatInterval,
+		reconnect:         basic.DefaultReconnectPolicy(),
+		maxRestarts:       DefaultMaxRestarts,
+
+		restartCh: make(chan struct{}, 1),
+		loopDone:  make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// WithHeartbeatInterval 设置项目心跳间隔
+func (s *Session) WithHeartbeatInterval(interval time.Duration) *Session {
+	s.heartbeatInterval = interval
+	return s
+}
+
+// WithReconnect 设置长连接重连策略, 为空时不自动重连, 断线后直接重启项目
+func (s *Session) WithReconnect(policy *basic.ReconnectPolicy) *Session {
+	s.reconnect = policy
+	return s
+}
+
+// WithMaxRestarts 设置连续重启项目的最大次数, 小于等于0表示不限制
+func (s *Session) WithMaxRestarts(maxRestarts int) *Session {
+	s.maxRestarts = maxRestarts
+	return s
+}
+
+// WithOnStart 项目启动回调, 每次(重新)启动项目并建立长连接后触发
+func (s *Session) WithOnStart(onStart func(s *Session, startResp *AppStartResponse)) *Session {
+	s.onStart = onStart
+	return s
+}
+
+// WithOnError 错误回调, 例如心跳失败, 重启失败
+func (s *Session) WithOnError(onError func(s *Session, err error)) *Session {
+	s.onError = onError
+	return s
+}
+
+// WithOnStop 结束回调, err 为空表示调用者主动结束
+func (s *Session) WithOnStop(onStop func(s *Session, err error)) *Session {
+	s.onStop = onStop
+	return s
+}
+
+// Code 主播身份码
+func (s *Session) Code() string {
+	return s.code
+}
+
+// StartResp 当前的项目信息
+func (s *Session) StartResp() *AppStartResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.startResp
+}
+
+// WsClient 当前的长连接
+func (s *Session) WsClient() *basic.WsClient {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.wsClient
+}
+
+// SessionHealth 运行状态
+type SessionHealth struct {
+	Code              string    `json:"code"`
+	GameID            string    `json:"game_id"`
+	Running           bool      `json:"running"`
+	PendingRestart    bool      `json:"pending_restart"`    // 重启失败, 等待重试
+	LastHeartbeat     time.Time `json:"last_heartbeat"`     // 上一次心跳成功的时间
+	HeartbeatFailures int       `json:"heartbeat_failures"` // 连续心跳失败次数
+	Restarts          int       `json:"restarts"`           // 累计重启次数
+	LastError         error     `json:"-"`
+}
+
+// Health 运行状态
+func (s *Session) Health() SessionHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	health := SessionHealth{
+		Code:              s.code,
+		Running:           s.started && !s.isDone(),
+		PendingRestart:    s.pendingRestart,
+		LastHeartbeat:     s.lastHeartbeat,
+		HeartbeatFailures: s.heartbeatFailures,
+		Restarts:          s.totalRestarts,
+		LastError:         s.lastErr,
+	}
+
+	if s.startResp != nil {
+		health.GameID = s.startResp.GameInfo.GameID
+	}
+
+	return health
+}
+
+func (s *Session) isDone() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Done 结束后关闭
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err 结束原因, 主动结束时为空
+func (s *Session) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Start 启动项目并建立长连接
+// ctx 仅用于启动过程, 之后的生命周期由 Stop 控制
+func (s *Session) Start(ctx context.Context) error {
+	loopCtx, cancel := context.WithCancel(context.Background())
+
+	s.mu.Lock()
+	if s.started {
+		s.mu.Unlock()
+		cancel()
+		return ErrSessionStarted
+	}
+	s.started = true
+	s.cancel = cancel
+	s.mu.Unlock()
+
+	if err := s.start(ctx, loopCtx); err != nil {
+		// 启动过程中可能已经被 Stop, 无论如何都需要结束等待 loopDone 的一方
+		cancel()
+		close(s.loopDone)
+
+		s.stopOnce.Do(func() {
+			_ = s.end(ctx)
+			s.finish(err)
+		})
+		return err
+	}
+
+	go s.loop(loopCtx)
+	return nil
+}
+
+// Stop 结束项目
+func (s *Session) Stop() error {
+	return s.StopCtx(context.Background())
+}
+
+// StopCtx 结束项目, ctx 用于 AppEnd 请求
+func (s *Session) StopCtx(ctx context.Context) error {
+	s.mu.Lock()
+	started, stopLoop := s.started, s.cancel
+	s.mu.Unlock()
+
+	// 未启动时不占用 stopOnce, 之后启动的 Session 仍然可以结束
+	if !started {
+		return nil
+	}
+
+	s.stopOnce.Do(func() {
+		stopLoop()
+		<-s.loopDone
+
+		s.stopErr = s.end(ctx)
+		s.finish(nil)
+	})
+
+	return s.stopErr
+}
+
+// Restart 重新启动项目
+// 会结束当前场次并重新 AppStart, 长连接会使用新的 StartResp
+func (s *Session) Restart() {
+	select {
+	case s.restartCh <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Session) loop(ctx context.Context) {
+	defer close(s.loopDone)
+
+	var tickC <-chan time.Time
+	if s.heartbeatInterval > 0 {
+		ticker := time.NewTicker(s.heartbeatInterval)
+		defer ticker.Stop()
+		tickC = ticker.C
+	}
+
+	restart := func() bool {
+		if s.tooManyRestarts() {
+			s.fail(ErrSessionTooManyRestarts)
+			return false
+		}
+
+		s.restart(ctx)
+		return true
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.restartCh:
+			if !restart() {
+				return
+			}
+		case <-tickC:
+			// 重启失败后, 下一次心跳时继续尝试重启
+			if !s.PendingRestart() && !s.heartbeat(ctx) {
+				continue
+			}
+
+			if !restart() {
+				return
+			}
+		}
+	}
+}
+
+// PendingRestart 上一次重启失败, 等待重试
+func (s *Session) PendingRestart() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.pendingRestart
+}
+
+// heartbeat 项目心跳, 返回是否需要重启项目
+func (s *Session) heartbeat(ctx context.Context) bool {
+	gameID := s.StartResp().GameInfo.GameID
+
+	err := s.client.AppHeartbeatCtx(ctx, gameID)
+	if err != nil && ctx.Err() != nil {
+		return false
+	}
+
+	return s.reportHeartbeat(err, errors.Is(err, ErrGameIDInvalid))
+}
+
+// reportHeartbeat 记录心跳结果, 返回是否需要重启项目
+// 由外部(例如 SessionPool)负责心跳时也通过此方法记录
+func (s *Session) reportHeartbeat(err error, gameIDInvalid bool) bool {
+	s.mu.Lock()
+	if err == nil {
+		s.restarts = 0
+		s.heartbeatFailures = 0
+		s.lastHeartbeat = time.Now()
+		s.mu.Unlock()
+		return false
+	}
+
+	s.heartbeatFailures++
+	s.lastErr = err
+	gameID := ""
+	if s.startResp != nil {
+		gameID = s.startResp.GameInfo.GameID
+	}
+	s.mu.Unlock()
+
+	s.logger.Error("session heartbeat fail", slog.String("game_id", gameID), slog.String("err", err.Error()))
+	s.emitError(err)
+
+	return gameIDInvalid
+}
+
+// restart 重启项目
+func (s *Session) restart(ctx context.Context) {
+	s.mu.Lock()
+	s.restarts++
+	s.totalRestarts++
+	restarts := s.restarts
+	s.mu.Unlock()
+
+	s.logger.Info("session restart", slog.Int("restarts", restarts))
+
+	if err := s.end(ctx); err != nil {
+		s.logger.Error("session end previous game fail", slog.String("err", err.Error()))
+	}
+
+	err := s.start(ctx, ctx)
+
+	s.mu.Lock()
+	s.pendingRestart = err != nil
+	if err != nil {
+		s.lastErr = err
+	}
+	s.mu.Unlock()
+
+	if err != nil && ctx.Err() == nil {
+		s.emitError(err)
+	}
+}
+
+// tooManyRestarts 距离上一次心跳成功, 重启次数是否已达上限
+func (s *Session) tooManyRestarts() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.maxRestarts > 0 && s.restarts >= s.maxRestarts
+}
+
+// start AppStart 并建立长连接, wsCtx 为长连接的生命周期
+func (s *Session) start(ctx, wsCtx context.Context) error {
+	startResp, err := s.client.AppStartCtx(ctx, s.code)
+	if err != nil {
+		return errors.WithMessage(err, "session start fail")
+	}
+
+	s.mu.Lock()
+	s.startResp = startResp
+	s.mu.Unlock()
+
+	logger := s.logger.With(
+		slog.String("game_id", startResp.GameInfo.GameID),
+		slog.Int("room_id", startResp.AnchorInfo.RoomID),
+	)
+
+	wsClient := basic.NewWsClient(startResp, s.dispatcher, logger).
+		WithOnClose(s.onWsClose)
+
+	if s.reconnect != nil {
+		policy := *s.reconnect
+		policy.RefreshStartResp = func(_ context.Context, _ basic.StartResp, _ int) (basic.StartResp, error) {
+			return s.StartResp(), nil
+		}
+		wsClient.WithReconnect(&policy)
+	}
+
+	s.mu.Lock()
+	s.starting = wsClient
+	s.mu.Unlock()
+
+	err = wsClient.StartCtx(wsCtx)
+
+	s.mu.Lock()
+	s.starting = nil
+	if err == nil {
+		s.wsClient = wsClient
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		return errors.WithMessage(err, "session start websocket fail")
+	}
+
+	s.logger.Info("session started", slog.String("game_id", startResp.GameInfo.GameID))
+	if s.onStart != nil {
+		s.onStart(s, startResp)
+	}
+
+	return nil
+}
+
+// end 关闭长连接并 AppEnd
+func (s *Session) end(ctx context.Context) error {
+	s.mu.Lock()
+	wsClient, startResp := s.wsClient, s.startResp
+	s.wsClient = nil
+	s.mu.Unlock()
+
+	if wsClient != nil {
+		_ = wsClient.Close()
+	}
+
+	if startResp == nil {
+		return nil
+	}
+
+	return s.client.AppEndCtx(ctx, startResp.GameInfo.GameID)
+}
+
+// onWsClose 长连接最终关闭(放弃重连或终止关闭)后重启项目
+// 收到消息推送结束通知时不再重启, 直接结束 Session
+func (s *Session) onWsClose(wsClient *basic.WsClient, _ basic.StartResp, closeType int) {
+	s.mu.Lock()
+	current := s.wsClient == wsClient || s.starting == wsClient
+	s.mu.Unlock()
+
+	if !current {
+		return
+	}
+
+	s.logger.Info("session websocket closed", slog.Int("close_type", closeType))
+	if closeType == basic.CloseInteractionEnd {
+		s.terminate(ErrSessionInteractionEnd)
+		return
+	}
+
+	s.Restart()
+}
+
+func (s *Session) emitError(err error) {
+	if s.onError != nil {
+		s.onError(s, err)
+	}
+}
+
+// fail 异常结束
+func (s *Session) fail(err error) {
+	s.logger.Error("session fail", slog.String("err", err.Error()))
+	s.terminate(err)
+}
+
+// terminate 异步结束 Session, Err 返回 err
+func (s *Session) terminate(err error) {
+	s.mu.Lock()
+	stopLoop := s.cancel
+	s.mu.Unlock()
+
+	go s.stopOnce.Do(func() {
+		stopLoop()
+		<-s.loopDone
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+
+		s.stopErr = s.end(ctx)
+		s.finish(err)
+	})
+}
+
+func (s *Session) finish(err error) {
+	s.err = err
+	close(s.done)
+
+	if s.onStop != nil {
+		s.onStop(s, err)
+	}
+}
@@ -0,0 +1,381 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package live
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/vtb-link/bianka/proto"
+	"golang.org/x/exp/slog"
+)
+
+// fakeOpenLive 本地的 live-open.biliapi.com 替身, 附带一个长连接服务
+type fakeOpenLive struct {
+	api *httptest.Server
+	ws  *httptest.Server
+
+	mu         sync.Mutex
+	games      int
+	heartbeats int
+	batches    [][]string
+	ended      []string
+	invalidAll bool
+	invalid    map[string]bool
+	pushes     []string // 鉴权成功后推送的消息
+
+	authBodies chan string
+}
+
+func newFakeOpenLive(t *testing.T) *fakeOpenLive {
+	f := &fakeOpenLive{
+		invalid:    map[string]bool{},
+		authBodies: make(chan string, 16),
+	}
+
+	upgrader := websocket.Upgrader{}
+	f.ws = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_, buf, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		msgList, err := proto.UnpackMessage(buf)
+		if err != nil || len(msgList) != 1 {
+			t.Errorf("unexpected auth message: %v", err)
+			return
+		}
+		f.authBodies <- string(msgList[0].Payload())
+
+		reply := proto.PackMessage(proto.HeaderDefaultSequence, proto.OperationUserAuthenticationReply, []byte(`{"code":0}`))
+		if err = conn.WriteMessage(websocket.BinaryMessage, reply.ToBytes()); err != nil {
+			return
+		}
+
+		f.mu.Lock()
+		pushes := append([]string(nil), f.pushes...)
+		f.mu.Unlock()
+
+		for _, push := range pushes {
+			msg := proto.PackMessage(proto.HeaderDefaultSequence, proto.OperationMessage, []byte(push))
+			if err = conn.WriteMessage(websocket.BinaryMessage, msg.ToBytes()); err != nil {
+				return
+			}
+		}
+
+		for {
+			if _, _, err = conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(f.ws.Close)
+
+	f.api = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			GameID  string   `json:"game_id"`
+			GameIDs []string `json:"game_ids"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		var data interface{}
+		code := 0
+		switch r.URL.Path {
+		case "/v2/app/start":
+			f.games++
+			gameID := fmt.Sprintf("game-%d", f.games)
+			data = map[string]interface{}{
+				"game_info": map[string]interface{}{"game_id": gameID},
+				"websocket_info": map[string]interface{}{
+					"auth_body": "auth-" + gameID,
+					"wss_link":  []string{"ws" + strings.TrimPrefix(f.ws.URL, "http")},
+				},
+				"anchor_info": map[string]interface{}{"room_id": 1, "uid": 1},
+			}
+		case "/v2/app/heartbeat":
+			f.heartbeats++
+			if f.invalidAll || f.invalid[req.GameID] {
+				code = CodeGameIDInvalid
+			}
+		case "/v2/app/batchHeartbeat":
+			f.batches = append(f.batches, req.GameIDs)
+			failed := []string{}
+			for _, gameID := range req.GameIDs {
+				if f.invalidAll || f.invalid[gameID] {
+					failed = append(failed, gameID)
+				}
+			}
+			data = map[string]interface{}{"failed_game_ids": failed}
+		case "/v2/app/end":
+			f.ended = append(f.ended, req.GameID)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"code": code, "message": "", "data": data})
+	}))
+	t.Cleanup(f.api.Close)
+
+	return f
+}
+
+func (f *fakeOpenLive) client() *Client {
+	cfg := NewConfig("key", "secret", 1)
+	cfg.OpenPlatformHttpHost = f.api.URL
+	return NewClient(cfg)
+}
+
+func (f *fakeOpenLive) endedGames() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.ended...)
+}
+
+func (f *fakeOpenLive) heartbeatCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.heartbeats
+}
+
+func (f *fakeOpenLive) waitAuth(t *testing.T, expected string) {
+	t.Helper()
+
+	select {
+	case body := <-f.authBodies:
+		if body != expected {
+			t.Fatalf("unexpected auth body %s, expected %s", body, expected)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatalf("wait auth %s timeout", expected)
+	}
+}
+
+func newTestSession(f *fakeOpenLive) *Session {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewSession(f.client(), "code", nil, logger).
+		WithHeartbeatInterval(time.Millisecond * 20)
+}
+
+func TestSession_StartStop(t *testing.T) {
+	f := newFakeOpenLive(t)
+
+	stopped := make(chan error, 1)
+	session := newTestSession(f).
+		WithOnStop(func(_ *Session, err error) {
+			stopped <- err
+		})
+
+	if err := session.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	f.waitAuth(t, "auth-game-1")
+
+	if err := session.Start(context.Background()); !errors.Is(err, ErrSessionStarted) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second * 5)
+	for f.heartbeatCount() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("wait heartbeat timeout")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	if err := session.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-session.Done():
+	default:
+		t.Fatal("session should be done")
+	}
+
+	if err := <-stopped; err != nil {
+		t.Fatalf("unexpected stop error %v", err)
+	}
+
+	if ended := f.endedGames(); len(ended) != 1 || ended[0] != "game-1" {
+		t.Fatalf("unexpected ended games %v", ended)
+	}
+}
+
+func TestSession_RestartOnInvalidGameID(t *testing.T) {
+	f := newFakeOpenLive(t)
+	f.invalid["game-1"] = true
+
+	started := make(chan string, 4)
+	session := newTestSession(f).
+		WithOnStart(func(_ *Session, startResp *AppStartResponse) {
+			started <- startResp.GameInfo.GameID
+		})
+
+	if err := session.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer session.Stop()
+
+	f.waitAuth(t, "auth-game-1")
+	f.waitAuth(t, "auth-game-2")
+
+	for _, expected := range []string{"game-1", "game-2"} {
+		if gameID := <-started; gameID != expected {
+			t.Fatalf("unexpected game %s, expected %s", gameID, expected)
+		}
+	}
+
+	if gameID := session.StartResp().GameInfo.GameID; gameID != "game-2" {
+		t.Fatalf("unexpected current game %s", gameID)
+	}
+
+	if ended := f.endedGames(); len(ended) != 1 || ended[0] != "game-1" {
+		t.Fatalf("unexpected ended games %v", ended)
+	}
+}
+
+func TestSession_TooManyRestarts(t *testing.T) {
+	f := newFakeOpenLive(t)
+	f.invalidAll = true
+
+	session := newTestSession(f).WithMaxRestarts(2)
+	if err := session.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-session.Done():
+	case <-time.After(time.Second * 5):
+		t.Fatal("wait session done timeout")
+	}
+
+	if err := session.Err(); !errors.Is(err, ErrSessionTooManyRestarts) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if ended := f.endedGames(); len(ended) != 3 {
+		t.Fatalf("unexpected ended games %v", ended)
+	}
+}
+
+func TestSession_InteractionEnd(t *testing.T) {
+	f := newFakeOpenLive(t)
+	f.pushes = []string{`{"cmd":"LIVE_OPEN_PLATFORM_INTERACTION_END","data":{"conn_id":"game-1","timestamp":1700000000}}`}
+
+	session := newTestSession(f)
+	if err := session.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-session.Done():
+	case <-time.After(time.Second * 5):
+		t.Fatal("wait session done timeout")
+	}
+
+	if err := session.Err(); !errors.Is(err, ErrSessionInteractionEnd) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// 不应该重启项目
+	f.waitAuth(t, "auth-game-1")
+	if len(f.authBodies) != 0 || f.games != 1 {
+		t.Fatalf("session should not restart")
+	}
+}
+
+func TestSession_StartDialFail(t *testing.T) {
+	f := newFakeOpenLive(t)
+	f.ws.Close()
+
+	session := newTestSession(f)
+	if err := session.Start(context.Background()); err == nil {
+		t.Fatal("start should fail when websocket dial fails")
+	}
+
+	select {
+	case <-session.Done():
+	default:
+		t.Fatal("session should be done")
+	}
+
+	if session.WsClient() != nil {
+		t.Fatal("failed websocket should not be kept")
+	}
+
+	if ended := f.endedGames(); len(ended) != 1 || ended[0] != "game-1" {
+		t.Fatalf("unexpected ended games %v", ended)
+	}
+}
+
+func TestSession_StartStopConcurrent(t *testing.T) {
+	f := newFakeOpenLive(t)
+
+	for i := 0; i < 10; i++ {
+		session := newTestSession(f)
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_ = session.Start(context.Background())
+		}()
+		go func() {
+			defer wg.Done()
+			_ = session.Stop()
+		}()
+		wg.Wait()
+
+		// Stop 早于 Start 时不会生效, 再次 Stop 后一定结束
+		_ = session.Stop()
+		select {
+		case <-session.Done():
+		case <-time.After(time.Second * 5):
+			t.Fatal("session should be done")
+		}
+	}
+}
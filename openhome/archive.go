@@ -24,13 +24,13 @@
 package openhome
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"strconv"
 	"time"
 
 	"github.com/go-resty/resty/v2"
-	"github.com/pkg/errors"
 )
 
 type Archive basicService
@@ -49,23 +49,22 @@ type ArchiveEditResp struct {
 }
 
 func (a *Archive) Edit(accessToken string, req ArchiveEditReq) (*ArchiveEditResp, error) {
+	return a.EditCtx(context.Background(), accessToken, req)
+}
+
+// EditCtx 同 Edit, 支持传入 context
+func (a *Archive) EditCtx(ctx context.Context, accessToken string, req ArchiveEditReq) (*ArchiveEditResp, error) {
 	result := NewBaseResp(&ArchiveEditResp{})
 
-	resp, err := resty.New().R().
-		SetResult(result).
+	r := a.app.newRequest(ctx).
 		SetHeader("Content-Type", "application/json").
 		SetQueryParams(map[string]string{
 			"client_id":    a.app.appCfg.ClientID,
 			"access_token": accessToken,
 		}).
-		SetBody(req).
-		Post(`https://member.bilibili.com/arcopen/fn/archive/edit`)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "do request fail")
-	}
+		SetBody(req)
 
-	if err = checkResp(resp, result); err != nil {
+	if err := a.app.execute(r, resty.MethodPost, a.app.memberURL("/arcopen/fn/archive/edit"), result, withScopes(ScopesArcBase)); err != nil {
 		return nil, err
 	}
 
@@ -73,10 +72,14 @@ func (a *Archive) Edit(accessToken string, req ArchiveEditReq) (*ArchiveEditResp
 }
 
 func (a *Archive) Delete(accessToken, resourceID string) error {
+	return a.DeleteCtx(context.Background(), accessToken, resourceID)
+}
+
+// DeleteCtx 同 Delete, 支持传入 context
+func (a *Archive) DeleteCtx(ctx context.Context, accessToken, resourceID string) error {
 	result := NewBaseResp(nil)
 
-	resp, err := resty.New().R().
-		SetResult(result).
+	r := a.app.newRequest(ctx).
 		SetHeader("Content-Type", "application/json").
 		SetQueryParams(map[string]string{
 			"client_id":    a.app.appCfg.ClientID,
@@ -84,14 +87,9 @@ func (a *Archive) Delete(accessToken, resourceID string) error {
 		}).
 		SetBody(map[string]string{
 			"resource_id": resourceID,
-		}).
-		Post(`https://member.bilibili.com/arcopen/fn/archive/delete`)
-
-	if err != nil {
-		return errors.Wrapf(err, "do request fail")
-	}
+		})
 
-	if err = checkResp(resp, result); err != nil {
+	if err := a.app.execute(r, resty.MethodPost, a.app.memberURL("/arcopen/fn/archive/delete"), result, withScopes(ScopesArcBase)); err != nil {
 		return err
 	}
 
@@ -124,23 +122,22 @@ type ArchiveViewResp struct {
 }
 
 func (a *Archive) View(accessToken, resourceID string) (*ArchiveViewResp, error) {
+	return a.ViewCtx(context.Background(), accessToken, resourceID)
+}
+
+// ViewCtx 同 View, 支持传入 context
+func (a *Archive) ViewCtx(ctx context.Context, accessToken, resourceID string) (*ArchiveViewResp, error) {
 	result := NewBaseResp(&ArchiveViewResp{})
 
-	resp, err := resty.New().R().
-		SetResult(result).
+	r := a.app.newRequest(ctx).
 		SetHeader("Content-Type", "application/json").
 		SetQueryParams(map[string]string{
 			"client_id":    a.app.appCfg.ClientID,
 			"access_token": accessToken,
 			"resource_id":  resourceID,
-		}).
-		Get(`https://member.bilibili.com/arcopen/fn/archive/view`)
+		})
 
-	if err != nil {
-		return nil, errors.Wrapf(err, "do request fail")
-	}
-
-	if err = checkResp(resp, result); err != nil {
+	if err := a.app.execute(r, resty.MethodGet, a.app.memberURL("/arcopen/fn/archive/view"), result, withScopes(ScopesArcBase)); err != nil {
 		return nil, err
 	}
 
@@ -170,10 +167,14 @@ type ArchiveViewListReq struct {
 }
 
 func (a *Archive) ViewList(accessToken string, req ArchiveViewListReq) (*ArchiveViewListResp, error) {
+	return a.ViewListCtx(context.Background(), accessToken, req)
+}
+
+// ViewListCtx 同 ViewList, 支持传入 context
+func (a *Archive) ViewListCtx(ctx context.Context, accessToken string, req ArchiveViewListReq) (*ArchiveViewListResp, error) {
 	result := NewBaseResp(&ArchiveViewListResp{})
 
-	resp, err := resty.New().R().
-		SetResult(result).
+	r := a.app.newRequest(ctx).
 		SetHeader("Content-Type", "application/json").
 		SetQueryParams(map[string]string{
 			"client_id":    a.app.appCfg.ClientID,
@@ -181,20 +182,26 @@ func (a *Archive) ViewList(accessToken string, req ArchiveViewListReq) (*Archive
 			"pn":           strconv.Itoa(req.PageNumber),
 			"ps":           strconv.Itoa(req.PageSize),
 			"status":       req.Status,
-		}).
-		Get(`https://member.bilibili.com/arcopen/fn/archive/view/list`)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "do request fail")
-	}
+		})
 
-	if err = checkResp(resp, result); err != nil {
+	if err := a.app.execute(r, resty.MethodGet, a.app.memberURL("/arcopen/fn/archive/view/list"), result, withScopes(ScopesArcBase)); err != nil {
 		return nil, err
 	}
 
 	return result.Data.(*ArchiveViewListResp), nil
 }
 
+// IterateList 按页遍历稿件列表, status 为 ArchiveStatusAll 等
+func (a *Archive) IterateList(ctx context.Context, accessToken, status string) *PageIterator[*ArchiveViewResp] {
+	return NewPageIterator(ctx, DefaultPageSize, func(ctx context.Context, pn, ps int) ([]*ArchiveViewResp, PageResp, error) {
+		resp, err := a.ViewListCtx(ctx, accessToken, ArchiveViewListReq{PageNumber: pn, PageSize: ps, Status: status})
+		if err != nil {
+			return nil, PageResp{}, err
+		}
+		return resp.List, resp.Page, nil
+	})
+}
+
 type ArchiveType struct {
 	ID          int    `json:"id"`
 	Parent      int    `json:"parent"`
@@ -208,22 +215,21 @@ type ArchiveTypeListResp struct {
 }
 
 func (a *Archive) TypeList(accessToken string) (*ArchiveTypeListResp, error) {
+	return a.TypeListCtx(context.Background(), accessToken)
+}
+
+// TypeListCtx 同 TypeList, 支持传入 context
+func (a *Archive) TypeListCtx(ctx context.Context, accessToken string) (*ArchiveTypeListResp, error) {
 	result := NewBaseResp(&ArchiveTypeListResp{})
 
-	resp, err := resty.New().R().
-		SetResult(result).
+	r := a.app.newRequest(ctx).
 		SetHeader("Content-Type", "application/json").
 		SetQueryParams(map[string]string{
 			"client_id":    a.app.appCfg.ClientID,
 			"access_token": accessToken,
-		}).
-		Get(`https://member.bilibili.com/arcopen/fn/archive/type/list`)
+		})
 
-	if err != nil {
-		return nil, errors.Wrapf(err, "do request fail")
-	}
-
-	if err = checkResp(resp, result); err != nil {
+	if err := a.app.execute(r, resty.MethodGet, a.app.memberURL("/arcopen/fn/archive/type/list"), result, withScopes(ScopesArcBase)); err != nil {
 		return nil, err
 	}
 
@@ -257,23 +263,22 @@ func (ui UploadInitReq) WithUType(uType int) UploadInitReq {
 }
 
 func (a *Archive) UploadInit(accessToken string, req UploadInitReq) (*UploadInitResp, error) {
+	return a.UploadInitCtx(context.Background(), accessToken, req)
+}
+
+// UploadInitCtx 同 UploadInit, 支持传入 context
+func (a *Archive) UploadInitCtx(ctx context.Context, accessToken string, req UploadInitReq) (*UploadInitResp, error) {
 	result := NewBaseResp(&UploadInitResp{})
 
-	resp, err := resty.New().R().
-		SetResult(result).
+	r := a.app.newRequest(ctx).
 		SetHeader("Content-Type", "application/json").
 		SetQueryParams(map[string]string{
 			"client_id":    a.app.appCfg.ClientID,
 			"access_token": accessToken,
 		}).
-		SetBody(req).
-		Post(`https://member.bilibili.com/arcopen/fn/archive/video/init`)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "do request fail")
-	}
+		SetBody(req)
 
-	if err = checkResp(resp, result); err != nil {
+	if err := a.app.execute(r, resty.MethodPost, a.app.memberURL("/arcopen/fn/archive/video/init"), result, withScopes(ScopesArcBase)); err != nil {
 		return nil, err
 	}
 
@@ -281,23 +286,22 @@ func (a *Archive) UploadInit(accessToken string, req UploadInitReq) (*UploadInit
 }
 
 func (a *Archive) UploadPart(uploadToken string, partNumber int, fileReader io.Reader) error {
+	return a.UploadPartCtx(context.Background(), uploadToken, partNumber, fileReader)
+}
+
+// UploadPartCtx 同 UploadPart, 支持传入 context
+func (a *Archive) UploadPartCtx(ctx context.Context, uploadToken string, partNumber int, fileReader io.Reader) error {
 	result := NewBaseResp(nil)
 
-	resp, err := resty.New().R().
-		SetResult(result).
+	r := a.app.newRequest(ctx).
 		SetHeader("Content-Type", "application/json").
 		SetQueryParams(map[string]string{
 			"upload_token": uploadToken,
 			"part_number":  strconv.Itoa(partNumber),
 		}).
-		SetFileReader("file", fmt.Sprintf("%s-%d-%d", uploadToken, partNumber, time.Now().Unix()), fileReader).
-		Post(`https://openupos.bilivideo.com/video/v2/part/upload`)
-
-	if err != nil {
-		return errors.Wrapf(err, "do request fail")
-	}
+		SetFileReader("file", fmt.Sprintf("%s-%d-%d", uploadToken, partNumber, time.Now().Unix()), fileReader)
 
-	if err = checkResp(resp, result); err != nil {
+	if err := a.app.execute(r, resty.MethodPost, a.app.uposURL("/video/v2/part/upload"), result, withBodyReader(fileReader), withIdempotent()); err != nil {
 		return err
 	}
 
@@ -305,21 +309,20 @@ func (a *Archive) UploadPart(uploadToken string, partNumber int, fileReader io.R
 }
 
 func (a *Archive) UploadComplete(uploadToken string) error {
+	return a.UploadCompleteCtx(context.Background(), uploadToken)
+}
+
+// UploadCompleteCtx 同 UploadComplete, 支持传入 context
+func (a *Archive) UploadCompleteCtx(ctx context.Context, uploadToken string) error {
 	result := NewBaseResp(nil)
 
-	resp, err := resty.New().R().
-		SetResult(result).
+	r := a.app.newRequest(ctx).
 		SetHeader("Content-Type", "application/json").
 		SetQueryParams(map[string]string{
 			"upload_token": uploadToken,
-		}).
-		Post(`https://member.bilibili.com/arcopen/fn/archive/video/complete`)
-
-	if err != nil {
-		return errors.Wrapf(err, "do request fail")
-	}
+		})
 
-	if err = checkResp(resp, result); err != nil {
+	if err := a.app.execute(r, resty.MethodPost, a.app.memberURL("/arcopen/fn/archive/video/complete"), result); err != nil {
 		return err
 	}
 	return nil
@@ -348,24 +351,23 @@ type ArchiveSubmitReq struct {
 // 稿件提交之后会存在审核过程，期间不对外开放
 // 非正式会员单日最多投递5个稿件，可在主站通过答题转为正式会员解除限制
 func (a *Archive) Submit(accessToken, uploadToken string, req ArchiveSubmitReq) (*ArchiveSubmitResp, error) {
+	return a.SubmitCtx(context.Background(), accessToken, uploadToken, req)
+}
+
+// SubmitCtx 同 Submit, 支持传入 context
+func (a *Archive) SubmitCtx(ctx context.Context, accessToken, uploadToken string, req ArchiveSubmitReq) (*ArchiveSubmitResp, error) {
 	result := NewBaseResp(&ArchiveSubmitResp{})
 
-	resp, err := resty.New().R().
-		SetResult(result).
+	r := a.app.newRequest(ctx).
 		SetHeader("Content-Type", "application/json").
 		SetQueryParams(map[string]string{
 			"client_id":    a.app.appCfg.ClientID,
 			"access_token": accessToken,
 			"upload_token": uploadToken,
 		}).
-		SetBody(req).
-		Post(`https://member.bilibili.com/arcopen/fn/archive/add-by-utoken`)
+		SetBody(req)
 
-	if err != nil {
-		return nil, errors.Wrapf(err, "do request fail")
-	}
-
-	if err = checkResp(resp, result); err != nil {
+	if err := a.app.execute(r, resty.MethodPost, a.app.memberURL("/arcopen/fn/archive/add-by-utoken"), result, withScopes(ScopesArcBase)); err != nil {
 		return nil, err
 	}
 
@@ -377,23 +379,22 @@ type ArchiveUploadCoverResp struct {
 }
 
 func (a *Archive) UploadCover(accessToken string, fileReader io.Reader) (*ArchiveUploadCoverResp, error) {
+	return a.UploadCoverCtx(context.Background(), accessToken, fileReader)
+}
+
+// UploadCoverCtx 同 UploadCover, 支持传入 context
+func (a *Archive) UploadCoverCtx(ctx context.Context, accessToken string, fileReader io.Reader) (*ArchiveUploadCoverResp, error) {
 	result := NewBaseResp(&ArchiveUploadCoverResp{})
 
-	resp, err := resty.New().R().
-		SetResult(result).
+	r := a.app.newRequest(ctx).
 		SetHeader("Content-Type", "application/json").
 		SetQueryParams(map[string]string{
 			"client_id":    a.app.appCfg.ClientID,
 			"access_token": accessToken,
 		}).
-		SetFileReader("file", fmt.Sprintf("%s-%d", accessToken, time.Now().Unix()), fileReader).
-		Post(`https://uat-member.bilibili.com/arcopen/fn/archive/cover/upload`)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "do request fail")
-	}
+		SetFileReader("file", fmt.Sprintf("%s-%d", accessToken, time.Now().Unix()), fileReader)
 
-	if err = checkResp(resp, result); err != nil {
+	if err := a.app.execute(r, resty.MethodPost, a.app.memberURL("/arcopen/fn/archive/cover/upload"), result, withBodyReader(fileReader), withScopes(ScopesArcBase)); err != nil {
 		return nil, err
 	}
 
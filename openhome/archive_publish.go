@@ -0,0 +1,251 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package openhome
+
+import (
+	"context"
+	"io"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/vtb-link/bianka/basic"
+)
+
+// 稿件提交的限制
+const (
+	ArchiveTitleMaxLength = 80  // 标题长度小于80
+	ArchiveTagMaxLength   = 200 // 标签总长度小于200
+	ArchiveDescMaxLength  = 250 // 描述长度小于250
+
+	ArchiveCopyrightOriginal = 1 // 原创
+	ArchiveCopyrightReprint  = 2 // 转载, 需要填写 Source
+)
+
+// 稿件状态 ArchiveViewResp.AdditInfo.State, 其他负数状态视为审核中
+const (
+	ArchiveStateOpen       = 0    // 开放浏览
+	ArchiveStateOrangePass = 1    // 橙色通过
+	ArchiveStateWaitAudit  = -1   // 待审
+	ArchiveStateRecycle    = -2   // 被打回
+	ArchiveStateLock       = -4   // 锁定
+	ArchiveStateXcodeFail  = -16  // 转码失败
+	ArchiveStateUserDelete = -100 // 用户删除
+)
+
+var (
+	// ErrInvalidArchive 稿件信息不符合提交要求
+	ErrInvalidArchive = errors.New("invalid archive")
+
+	// ErrArchiveRejected 稿件审核未通过
+	ErrArchiveRejected = errors.New("archive rejected")
+)
+
+// Validate 检查稿件信息是否符合提交要求
+// 长度按字符计算; Tid 与 Copyright 是提交接口的必填字段(见 ArchiveSubmitReq), 零值会被接口拒绝, 这里提前检查
+// Tid 需要由 Archive.TypeList 获取, Copyright 只能是 ArchiveCopyrightOriginal 或 ArchiveCopyrightReprint
+func (req ArchiveSubmitReq) Validate() error {
+	switch {
+	case req.Title == "":
+		return errors.Wrap(ErrInvalidArchive, "title is empty")
+	case utf8.RuneCountInString(req.Title) >= ArchiveTitleMaxLength:
+		return errors.Wrapf(ErrInvalidArchive, "title length must be less than %d", ArchiveTitleMaxLength)
+	case utf8.RuneCountInString(req.Tag) >= ArchiveTagMaxLength:
+		return errors.Wrapf(ErrInvalidArchive, "tag length must be less than %d", ArchiveTagMaxLength)
+	case utf8.RuneCountInString(req.Desc) >= ArchiveDescMaxLength:
+		return errors.Wrapf(ErrInvalidArchive, "desc length must be less than %d", ArchiveDescMaxLength)
+	case req.Tid <= 0:
+		return errors.Wrap(ErrInvalidArchive, "tid is required")
+	case req.Copyright != ArchiveCopyrightOriginal && req.Copyright != ArchiveCopyrightReprint:
+		return errors.Wrapf(ErrInvalidArchive, "invalid copyright %d", req.Copyright)
+	case req.Copyright == ArchiveCopyrightReprint && req.Source == "":
+		return errors.Wrap(ErrInvalidArchive, "source is required for reprint")
+	}
+
+	return nil
+}
+
+// PublishState 稿件发布状态
+type PublishState string
+
+const (
+	PublishStateReviewing PublishState = "reviewing" // 审核中
+	PublishStatePublished PublishState = "published" // 已发布
+	PublishStateRejected  PublishState = "rejected"  // 未通过
+)
+
+// PublishStateOf 稿件状态对应的发布状态
+func PublishStateOf(archiveState int) PublishState {
+	switch archiveState {
+	case ArchiveStateRecycle, ArchiveStateLock, ArchiveStateXcodeFail, ArchiveStateUserDelete:
+		return PublishStateRejected
+	}
+
+	if archiveState >= ArchiveStateOpen {
+		return PublishStatePublished
+	}
+
+	return PublishStateReviewing
+}
+
+// PublishEvent 稿件状态变化
+type PublishEvent struct {
+	ResourceID   string
+	State        PublishState
+	ArchiveState int    // AdditInfo.State
+	StateDesc    string // AdditInfo.StateDesc
+	RejectReason string // 未通过时的原因
+	Archive      *ArchiveViewResp
+}
+
+// DefaultReviewPoll 默认的审核状态查询间隔, 10s 起步, 1.5倍递增, 最大5分钟
+func DefaultReviewPoll() basic.Backoff {
+	return basic.Backoff{
+		InitialInterval: time.Second * 10,
+		MaxInterval:     time.Minute * 5,
+		Multiplier:      1.5,
+		Jitter:          0.1,
+	}
+}
+
+// PublishReq Archive.Publish 的参数
+type PublishReq struct {
+	VideoPath string             // 视频文件路径
+	Cover     io.Reader          // 封面, 为空时使用 Archive.Cover
+	Archive   ArchiveSubmitReq   // 稿件信息
+	Upload    *UploadFileOptions // 视频上传配置
+
+	// NoWait 提交后不等待审核结果
+	NoWait bool
+
+	// Poll 审核状态查询间隔, 为空或 InitialInterval 小于等于0时使用 DefaultReviewPoll
+	Poll *basic.Backoff
+
+	// OnEvent 稿件状态变化时调用
+	OnEvent func(event PublishEvent)
+}
+
+// PublishResp Archive.Publish 的结果
+type PublishResp struct {
+	ResourceID  string
+	UploadToken string
+	Cover       string
+	Event       *PublishEvent // 最后一次状态, NoWait 时为空
+}
+
+// Publish 发布稿件
+// 依次完成: 检查稿件信息, 上传封面, 分片上传视频, 提交稿件, 等待审核
+// 审核未通过时返回 ErrArchiveRejected, 此时 PublishResp.Event 包含原因
+func (a *Archive) Publish(ctx context.Context, accessToken string, req PublishReq) (*PublishResp, error) {
+	archive := req.Archive
+	if req.Cover == nil && archive.Cover == "" {
+		return nil, errors.Wrap(ErrInvalidArchive, "cover is required")
+	}
+
+	if err := archive.Validate(); err != nil {
+		return nil, err
+	}
+
+	resp := &PublishResp{}
+	if req.Cover != nil {
+		coverResp, err := a.UploadCoverCtx(ctx, accessToken, req.Cover)
+		if err != nil {
+			return nil, errors.WithMessage(err, "upload cover fail")
+		}
+		archive.Cover = coverResp.Url
+	}
+	resp.Cover = archive.Cover
+
+	uploadResp, err := a.UploadFile(ctx, accessToken, req.VideoPath, req.Upload)
+	if err != nil {
+		return nil, errors.WithMessage(err, "upload video fail")
+	}
+	resp.UploadToken = uploadResp.UploadToken
+
+	submitResp, err := a.SubmitCtx(ctx, accessToken, uploadResp.UploadToken, archive)
+	if err != nil {
+		return resp, errors.WithMessage(err, "submit fail")
+	}
+	resp.ResourceID = submitResp.ResourceID
+
+	if req.NoWait {
+		return resp, nil
+	}
+
+	poll := DefaultReviewPoll()
+	if req.Poll != nil {
+		poll = *req.Poll
+	}
+
+	resp.Event, err = a.WaitReview(ctx, accessToken, resp.ResourceID, poll, req.OnEvent)
+	return resp, err
+}
+
+// WaitReview 查询稿件状态直到发布或未通过, 状态变化时调用 onEvent
+// poll.InitialInterval 小于等于0时使用 DefaultReviewPoll, 避免频繁请求
+// 未通过时返回 ErrArchiveRejected
+func (a *Archive) WaitReview(ctx context.Context, accessToken, resourceID string, poll basic.Backoff, onEvent func(event PublishEvent)) (*PublishEvent, error) {
+	if poll.InitialInterval <= 0 {
+		poll = DefaultReviewPoll()
+	}
+
+	var last *PublishEvent
+	for attempt := 1; ; attempt++ {
+		view, err := a.ViewCtx(ctx, accessToken, resourceID)
+		if err != nil {
+			return last, errors.WithMessagef(err, "view archive fail, resource_id:%s", resourceID)
+		}
+
+		event := &PublishEvent{
+			ResourceID:   resourceID,
+			State:        PublishStateOf(view.AdditInfo.State),
+			ArchiveState: view.AdditInfo.State,
+			StateDesc:    view.AdditInfo.StateDesc,
+			RejectReason: view.AdditInfo.RejectReason,
+			Archive:      view,
+		}
+
+		if last == nil || last.ArchiveState != event.ArchiveState {
+			if onEvent != nil {
+				onEvent(*event)
+			}
+		}
+		last = event
+
+		switch event.State {
+		case PublishStatePublished:
+			return event, nil
+		case PublishStateRejected:
+			return event, errors.Wrapf(ErrArchiveRejected, "resource_id:%s reason:%s", resourceID, event.RejectReason)
+		}
+
+		timer := time.NewTimer(poll.Duration(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return last, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
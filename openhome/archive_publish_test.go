@@ -0,0 +1,194 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package openhome
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vtb-link/bianka/basic"
+)
+
+func TestArchiveSubmitReq_Validate(t *testing.T) {
+	valid := ArchiveSubmitReq{Title: "标题", Tid: 1, Copyright: ArchiveCopyrightOriginal}
+
+	tests := []struct {
+		name   string
+		modify func(req *ArchiveSubmitReq)
+		ok     bool
+	}{
+		{name: "valid", modify: func(req *ArchiveSubmitReq) {}, ok: true},
+		{name: "empty title", modify: func(req *ArchiveSubmitReq) { req.Title = "" }},
+		{name: "title 79 runes", modify: func(req *ArchiveSubmitReq) { req.Title = strings.Repeat("标", 79) }, ok: true},
+		{name: "title 80 runes", modify: func(req *ArchiveSubmitReq) { req.Title = strings.Repeat("标", 80) }},
+		{name: "tag too long", modify: func(req *ArchiveSubmitReq) { req.Tag = strings.Repeat("a,", 100) }},
+		{name: "desc too long", modify: func(req *ArchiveSubmitReq) { req.Desc = strings.Repeat("述", 250) }},
+		{name: "no tid", modify: func(req *ArchiveSubmitReq) { req.Tid = 0 }},
+		{name: "invalid copyright", modify: func(req *ArchiveSubmitReq) { req.Copyright = 0 }},
+		{name: "reprint without source", modify: func(req *ArchiveSubmitReq) { req.Copyright = ArchiveCopyrightReprint }},
+		{name: "reprint with source", modify: func(req *ArchiveSubmitReq) {
+			req.Copyright = ArchiveCopyrightReprint
+			req.Source = "https://example.com"
+		}, ok: true},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid
+			tt.modify(&req)
+
+			err := req.Validate()
+			if tt.ok != (err == nil) || (err != nil && !errors.Is(err, ErrInvalidArchive)) {
+				t.Fatalf("unexpected err %v", err)
+			}
+		})
+	}
+}
+
+func newPublishServer(t *testing.T, states []string) (*fakeUposServer, *httptest.Server) {
+	fs := newFakeUposServer(t)
+
+	var mu sync.Mutex
+	views := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/arcopen/fn/archive/cover/upload":
+			_, _ = w.Write([]byte(`{"code":0,"message":"0","data":{"url":"https://i0.hdslb.com/cover.jpg"}}`))
+		case "/arcopen/fn/archive/add-by-utoken":
+			body, _ := io.ReadAll(r.Body)
+			if r.URL.Query().Get("upload_token") != "utoken-1" || !strings.Contains(string(body), "cover.jpg") {
+				t.Errorf("unexpected submit %s %s", r.URL.RawQuery, body)
+			}
+			_, _ = w.Write([]byte(`{"code":0,"message":"0","data":{"resource_id":"BV1"}}`))
+		case "/arcopen/fn/archive/view":
+			mu.Lock()
+			state := states[views]
+			if views < len(states)-1 {
+				views++
+			}
+			mu.Unlock()
+			_, _ = w.Write([]byte(`{"code":0,"message":"0","data":{"resource_id":"BV1","addit_info":` + state + `}}`))
+		default:
+			fs.Config.Handler.ServeHTTP(w, r)
+		}
+	}))
+
+	return fs, srv
+}
+
+func TestArchive_Publish(t *testing.T) {
+	fs, srv := newPublishServer(t, []string{
+		`{"state":-30,"state_desc":"审核中"}`,
+		`{"state":-30,"state_desc":"审核中"}`,
+		`{"state":-1,"state_desc":"待审"}`,
+		`{"state":0,"state_desc":"开放浏览"}`,
+	})
+	defer fs.Close()
+	defer srv.Close()
+
+	app := NewAppClient(&AppConfig{ClientID: "cid", MemberHost: srv.URL, UposHost: srv.URL})
+	path, _ := writeTempFile(t, 30)
+
+	archive := ArchiveSubmitReq{Title: "标题", Tid: 1, Copyright: ArchiveCopyrightOriginal}
+	if _, err := app.Archive.Publish(context.Background(), "token", PublishReq{VideoPath: path, Archive: archive}); !errors.Is(err, ErrInvalidArchive) {
+		t.Fatalf("cover should be required, got %v", err)
+	}
+
+	var events []PublishEvent
+	resp, err := app.Archive.Publish(context.Background(), "token", PublishReq{
+		VideoPath: path,
+		Cover:     strings.NewReader("cover"),
+		Archive:   archive,
+		Upload:    &UploadFileOptions{PartSize: 10, Storage: basic.NewMapStorage()},
+		Poll:      &basic.Backoff{InitialInterval: time.Millisecond},
+		OnEvent: func(event PublishEvent) {
+			events = append(events, event)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.ResourceID != "BV1" || resp.UploadToken != "utoken-1" || resp.Cover != "https://i0.hdslb.com/cover.jpg" || resp.Event.State != PublishStatePublished {
+		t.Fatalf("unexpected resp %+v", resp)
+	}
+
+	// 状态不变时不会重复通知
+	if len(events) != 3 || events[0].State != PublishStateReviewing || events[1].ArchiveState != ArchiveStateWaitAudit || events[2].State != PublishStatePublished {
+		t.Fatalf("unexpected events %+v", events)
+	}
+}
+
+func TestArchive_WaitReviewRejected(t *testing.T) {
+	fs, srv := newPublishServer(t, []string{
+		`{"state":-1,"state_desc":"待审"}`,
+		`{"state":-2,"state_desc":"被打回","reject_reason":"封面违规"}`,
+	})
+	defer fs.Close()
+	defer srv.Close()
+
+	app := NewAppClient(&AppConfig{ClientID: "cid", MemberHost: srv.URL})
+
+	event, err := app.Archive.WaitReview(context.Background(), "token", "BV1", basic.Backoff{InitialInterval: time.Millisecond}, nil)
+	if !errors.Is(err, ErrArchiveRejected) || event.State != PublishStateRejected || event.RejectReason != "封面违规" {
+		t.Fatalf("unexpected result %+v, %v", event, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+	defer cancel()
+
+	fs2, srv2 := newPublishServer(t, []string{`{"state":-1,"state_desc":"待审"}`})
+	defer fs2.Close()
+	defer srv2.Close()
+
+	app = NewAppClient(&AppConfig{ClientID: "cid", MemberHost: srv2.URL})
+	if _, err = app.Archive.WaitReview(ctx, "token", "BV1", basic.Backoff{InitialInterval: time.Millisecond * 5}, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestArchive_WaitReviewZeroPoll(t *testing.T) {
+	fs, srv := newPublishServer(t, []string{`{"state":-1,"state_desc":"待审"}`, `{"state":0,"state_desc":"开放浏览"}`})
+	defer fs.Close()
+	defer srv.Close()
+
+	app := NewAppClient(&AppConfig{ClientID: "cid", MemberHost: srv.URL})
+
+	// 零值间隔使用 DefaultReviewPoll, 不会立即再次查询
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	if _, err := app.Archive.WaitReview(ctx, "token", "BV1", basic.Backoff{}, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,348 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package openhome
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/vtb-link/bianka/basic"
+	errors2 "github.com/vtb-link/bianka/errors"
+)
+
+const (
+	DefaultUploadPartSize       = 8 << 20                   // 默认分片大小 8MB
+	DefaultUploadConcurrency    = 3                         // 默认并发上传的分片数
+	DefaultUploadStateKeyPrefix = "bianka:openhome:upload:" // 断点续传状态默认的 key 前缀
+)
+
+// UploadProgress 上传进度
+type UploadProgress struct {
+	UploadToken    string
+	PartNumber     int   // 刚完成的分片, 从1开始
+	CompletedParts int   // 已完成的分片数, 包含续传前已完成的
+	TotalParts     int   // 总分片数
+	UploadedBytes  int64 // 已上传的字节数, 包含续传前已完成的
+	TotalBytes     int64 // 文件大小
+}
+
+// UploadFileOptions Archive.UploadFile 的配置, 零值使用默认值
+type UploadFileOptions struct {
+	Name        string // UploadInit 的文件名, 默认使用文件名
+	PartSize    int64  // 分片大小, 默认 DefaultUploadPartSize
+	Concurrency int    // 并发上传的分片数, 默认 DefaultUploadConcurrency
+
+	// PartRetry 单个分片的重试策略, 与 AppConfig.RetryPolicy 叠加, 分片失败时整个上传才会失败
+	// 默认在 AppConfig.RetryPolicy 为空时使用 basic.DefaultRetryPolicy, 否则不额外重试
+	PartRetry *basic.RetryPolicy
+
+	// OnProgress 每个分片完成后调用, 同一时间只会有一个调用
+	OnProgress func(progress UploadProgress)
+
+	// Storage 保存 upload_token 与已完成的分片, 用于进程退出后续传
+	// 默认使用 AppConfig.TokenStorage, 上传完成后删除
+	Storage basic.Storage
+
+	// StateKey 断点续传状态的 key, 默认由 DefaultUploadStateKeyPrefix 与文件路径生成
+	StateKey string
+}
+
+// UploadFileResp Archive.UploadFile 的结果
+type UploadFileResp struct {
+	UploadToken string // 用于 Archive.Submit
+	TotalParts  int
+	Resumed     bool // 是否从上一次中断处续传
+}
+
+// uploadState 断点续传状态, 文件大小或修改时间变化后失效
+type uploadState struct {
+	UploadToken string `json:"upload_token"`
+	FileSize    int64  `json:"file_size"`
+	ModTime     int64  `json:"mod_time"`
+	PartSize    int64  `json:"part_size"`
+	Parts       []int  `json:"parts"` // 已完成的分片
+}
+
+func (st *uploadState) match(other *uploadState) bool {
+	return st.UploadToken != "" && st.FileSize == other.FileSize && st.ModTime == other.ModTime && st.PartSize == other.PartSize
+}
+
+func (opts *UploadFileOptions) withDefault(a *Archive, path string) *UploadFileOptions {
+	o := UploadFileOptions{}
+	if opts != nil {
+		o = *opts
+	}
+
+	if o.Name == "" {
+		o.Name = filepath.Base(path)
+	}
+	if o.PartSize <= 0 {
+		o.PartSize = DefaultUploadPartSize
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultUploadConcurrency
+	}
+	if o.PartRetry == nil && a.app.appCfg.RetryPolicy == nil {
+		o.PartRetry = basic.DefaultRetryPolicy()
+	}
+	if o.Storage == nil {
+		o.Storage = a.app.Tokens.storage
+	}
+	if o.StateKey == "" {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		o.StateKey = DefaultUploadStateKeyPrefix + basic.Md5(path)
+	}
+
+	return &o
+}
+
+// UploadFile 分片上传视频文件
+// 按 PartSize 切分后并发上传, 每个分片独立重试, 全部完成后调用 UploadComplete
+// 进度保存在 Storage 中, 中断后使用相同的参数再次调用会跳过已完成的分片
+// 续传的 upload_token 已失效时, 删除进度并重新 UploadInit 后从头上传
+// 返回的 upload_token 用于 Archive.Submit
+func (a *Archive) UploadFile(ctx context.Context, accessToken, path string, opts *UploadFileOptions) (*UploadFileResp, error) {
+	o := opts.withDefault(a, path)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "open file fail")
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "stat file fail")
+	}
+
+	if info.Size() == 0 {
+		return nil, errors.Errorf("file is empty, path:%s", path)
+	}
+
+	state := &uploadState{
+		FileSize: info.Size(),
+		ModTime:  info.ModTime().UnixNano(),
+		PartSize: o.PartSize,
+	}
+
+	resp := &UploadFileResp{
+		TotalParts: int((state.FileSize + o.PartSize - 1) / o.PartSize),
+	}
+
+	saved, err := loadUploadState(o.Storage, o.StateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if saved != nil && saved.match(state) {
+		state = saved
+		resp.Resumed = true
+	} else if err = a.initUpload(ctx, accessToken, state, o); err != nil {
+		return nil, err
+	}
+
+	err = a.uploadAndComplete(ctx, file, state, resp.TotalParts, o)
+	if err != nil && resp.Resumed && isUploadTokenInvalid(err) {
+		// 续传的 upload_token 已失效, 之前完成的分片不可用, 重新开始
+		if err = o.Storage.Del(o.StateKey); err != nil {
+			return nil, errors.Wrap(err, "delete upload state fail")
+		}
+
+		state.UploadToken = ""
+		state.Parts = nil
+		resp.Resumed = false
+		if err = a.initUpload(ctx, accessToken, state, o); err != nil {
+			return nil, err
+		}
+
+		err = a.uploadAndComplete(ctx, file, state, resp.TotalParts, o)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp.UploadToken = state.UploadToken
+
+	if err = o.Storage.Del(o.StateKey); err != nil {
+		return nil, errors.Wrap(err, "delete upload state fail")
+	}
+
+	return resp, nil
+}
+
+// initUpload 获取新的 upload_token 并保存进度
+func (a *Archive) initUpload(ctx context.Context, accessToken string, state *uploadState, o *UploadFileOptions) error {
+	initResp, err := a.UploadInitCtx(ctx, accessToken, NewUploadInitReq(o.Name).WithUType(UploadUTypePart))
+	if err != nil {
+		return errors.WithMessage(err, "upload init fail")
+	}
+
+	state.UploadToken = initResp.UploadToken
+	return saveUploadState(o.Storage, o.StateKey, state)
+}
+
+// uploadAndComplete 上传未完成的分片后调用 UploadComplete
+func (a *Archive) uploadAndComplete(ctx context.Context, file io.ReaderAt, state *uploadState, totalParts int, o *UploadFileOptions) error {
+	if err := a.uploadParts(ctx, file, state, totalParts, o); err != nil {
+		return err
+	}
+
+	return errors.WithMessage(a.UploadCompleteCtx(ctx, state.UploadToken), "upload complete fail")
+}
+
+// isUploadTokenInvalid upload_token 是否已失效(过期或不存在)
+// 接口没有单独的错误码, 续传时分片上传或合并返回资源不存在/参数错误视为失效
+func isUploadTokenInvalid(err error) bool {
+	return errors.Is(err, errors2.ErrNotFound) || errors.Is(err, errors2.ErrInvalidParams)
+}
+
+// uploadParts 并发上传未完成的分片
+func (a *Archive) uploadParts(ctx context.Context, file io.ReaderAt, state *uploadState, totalParts int, o *UploadFileOptions) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(map[int]bool, len(state.Parts))
+	for _, part := range state.Parts {
+		done[part] = true
+	}
+
+	partSize := func(part int) int64 {
+		offset := int64(part-1) * o.PartSize
+		if remain := state.FileSize - offset; remain < o.PartSize {
+			return remain
+		}
+		return o.PartSize
+	}
+
+	progress := UploadProgress{
+		UploadToken: state.UploadToken,
+		TotalParts:  totalParts,
+		TotalBytes:  state.FileSize,
+	}
+	for part := range done {
+		progress.CompletedParts++
+		progress.UploadedBytes += partSize(part)
+	}
+
+	parts := make(chan int)
+	go func() {
+		defer close(parts)
+		for part := 1; part <= totalParts; part++ {
+			if done[part] {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case parts <- part:
+			}
+		}
+	}()
+
+	var mu sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+
+	for i := 0; i < o.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for part := range parts {
+				size := partSize(part)
+				err := o.PartRetry.Do(ctx, func(_ int) error {
+					reader := io.NewSectionReader(file, int64(part-1)*o.PartSize, size)
+					return a.UploadPartCtx(ctx, state.UploadToken, part, reader)
+				})
+
+				mu.Lock()
+				if err == nil {
+					state.Parts = append(state.Parts, part)
+					sort.Ints(state.Parts)
+					err = saveUploadState(o.Storage, o.StateKey, state)
+
+					progress.PartNumber = part
+					progress.CompletedParts++
+					progress.UploadedBytes += size
+					if o.OnProgress != nil {
+						o.OnProgress(progress)
+					}
+				} else {
+					err = errors.WithMessagef(err, "upload part %d fail", part)
+				}
+
+				if err != nil && firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	return ctx.Err()
+}
+
+func loadUploadState(storage basic.Storage, key string) (*uploadState, error) {
+	val, err := storage.Get(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "get upload state fail")
+	}
+
+	if len(val) == 0 {
+		return nil, nil
+	}
+
+	state := &uploadState{}
+	if err = json.Unmarshal(val, state); err != nil {
+		return nil, errors.Wrapf(err, "json unmarshal fail, data:%s", val)
+	}
+
+	return state, nil
+}
+
+func saveUploadState(storage basic.Storage, key string, state *uploadState) error {
+	val, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "json marshal fail")
+	}
+
+	return errors.Wrapf(storage.Set(key, val), "save upload state fail, key:%s", key)
+}
@@ -0,0 +1,287 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package openhome
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vtb-link/bianka/basic"
+)
+
+// fakeUposServer 模拟分片上传, 记录收到的分片
+type fakeUposServer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	inits     int
+	parts     map[int][]byte
+	attempts  map[int]int
+	failOnce  map[int]bool    // 第一次请求失败, 可重试
+	rejected  map[int]bool    // 一直失败, 不可重试
+	broken    map[int]bool    // 一直返回 5xx, 可重试
+	expired   map[string]bool // 已失效的 upload_token
+	completed []byte
+}
+
+func newFakeUposServer(t *testing.T) *fakeUposServer {
+	fs := &fakeUposServer{
+		parts:    map[int][]byte{},
+		attempts: map[int]int{},
+		failOnce: map[int]bool{},
+		rejected: map[int]bool{},
+		broken:   map[int]bool{},
+		expired:  map[string]bool{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/arcopen/fn/archive/video/init", func(w http.ResponseWriter, r *http.Request) {
+		fs.mu.Lock()
+		fs.inits++
+		n := fs.inits
+		fs.mu.Unlock()
+		_, _ = w.Write([]byte(`{"code":0,"message":"0","data":{"upload_token":"utoken-` + strconv.Itoa(n) + `"}}`))
+	})
+	mux.HandleFunc("/video/v2/part/upload", func(w http.ResponseWriter, r *http.Request) {
+		part, _ := strconv.Atoi(r.URL.Query().Get("part_number"))
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("read part fail: %v", err)
+			return
+		}
+		data, _ := io.ReadAll(file)
+
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+
+		fs.attempts[part]++
+		switch {
+		case fs.expired[r.URL.Query().Get("upload_token")]:
+			_, _ = w.Write([]byte(`{"code":-404,"message":"啥都木有"}`))
+		case fs.broken[part]:
+			w.WriteHeader(http.StatusBadGateway)
+		case fs.rejected[part]:
+			_, _ = w.Write([]byte(`{"code":-400,"message":"请求错误"}`))
+		case fs.failOnce[part] && fs.attempts[part] == 1:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			fs.parts[part] = data
+			_, _ = w.Write([]byte(`{"code":0,"message":"0"}`))
+		}
+	})
+	mux.HandleFunc("/arcopen/fn/archive/video/complete", func(w http.ResponseWriter, r *http.Request) {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
+
+		fs.completed = nil
+		for i := 1; i <= len(fs.parts); i++ {
+			fs.completed = append(fs.completed, fs.parts[i]...)
+		}
+		_, _ = w.Write([]byte(`{"code":0,"message":"0"}`))
+	})
+
+	fs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, r)
+	}))
+
+	return fs
+}
+
+func writeTempFile(t *testing.T, size int) (string, []byte) {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte('a' + i%26)
+	}
+
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path, content
+}
+
+func TestArchive_UploadFile(t *testing.T) {
+	fs := newFakeUposServer(t)
+	defer fs.Close()
+
+	app := NewAppClient(&AppConfig{ClientID: "cid", MemberHost: fs.URL, UposHost: fs.URL})
+	path, content := writeTempFile(t, 105)
+	fs.failOnce[2] = true
+
+	var progress []UploadProgress
+	resp, err := app.Archive.UploadFile(context.Background(), "token", path, &UploadFileOptions{
+		PartSize:    10,
+		Concurrency: 4,
+		PartRetry:   &basic.RetryPolicy{Backoff: basic.Backoff{InitialInterval: time.Millisecond}, MaxAttempts: 3},
+		OnProgress: func(p UploadProgress) {
+			progress = append(progress, p)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.UploadToken != "utoken-1" || resp.TotalParts != 11 || resp.Resumed {
+		t.Fatalf("unexpected resp %+v", resp)
+	}
+
+	if !bytes.Equal(fs.completed, content) || fs.attempts[2] != 2 {
+		t.Fatalf("unexpected upload, attempts %v", fs.attempts)
+	}
+
+	last := progress[len(progress)-1]
+	if len(progress) != 11 || last.CompletedParts != 11 || last.UploadedBytes != 105 || last.TotalBytes != 105 {
+		t.Fatalf("unexpected progress %+v", last)
+	}
+
+	// 完成后删除断点续传状态
+	if state, _ := loadUploadState(app.Tokens.storage, DefaultUploadStateKeyPrefix+basic.Md5(path)); state != nil {
+		t.Fatalf("upload state should be deleted, %+v", state)
+	}
+}
+
+func TestArchive_UploadFileResume(t *testing.T) {
+	fs := newFakeUposServer(t)
+	defer fs.Close()
+
+	app := NewAppClient(&AppConfig{ClientID: "cid", MemberHost: fs.URL, UposHost: fs.URL})
+	path, content := writeTempFile(t, 50)
+	storage := basic.NewMapStorage()
+	opts := &UploadFileOptions{
+		PartSize:    10,
+		Concurrency: 1,
+		Storage:     storage,
+		StateKey:    "upload",
+	}
+
+	fs.rejected[3] = true
+	if _, err := app.Archive.UploadFile(context.Background(), "token", path, opts); err == nil {
+		t.Fatal("rejected part should fail the upload")
+	}
+
+	state, err := loadUploadState(storage, "upload")
+	if err != nil || state == nil || state.UploadToken != "utoken-1" || len(state.Parts) != 2 {
+		t.Fatalf("unexpected state %+v, %v", state, err)
+	}
+
+	fs.rejected[3] = false
+	var first UploadProgress
+	opts.OnProgress = func(p UploadProgress) {
+		if first.PartNumber == 0 {
+			first = p
+		}
+	}
+
+	resp, err := app.Archive.UploadFile(context.Background(), "token", path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !resp.Resumed || resp.UploadToken != "utoken-1" || fs.inits != 1 {
+		t.Fatalf("upload should resume, %+v inits %d", resp, fs.inits)
+	}
+
+	// 已完成的分片不会重新上传
+	if fs.attempts[1] != 1 || fs.attempts[2] != 1 || !bytes.Equal(fs.completed, content) {
+		t.Fatalf("unexpected attempts %v", fs.attempts)
+	}
+
+	if first.PartNumber != 3 || first.CompletedParts != 3 || first.UploadedBytes != 30 {
+		t.Fatalf("unexpected progress %+v", first)
+	}
+}
+
+func TestArchive_UploadFileResumeExpired(t *testing.T) {
+	fs := newFakeUposServer(t)
+	defer fs.Close()
+
+	app := NewAppClient(&AppConfig{ClientID: "cid", MemberHost: fs.URL, UposHost: fs.URL})
+	path, content := writeTempFile(t, 50)
+	storage := basic.NewMapStorage()
+	opts := &UploadFileOptions{
+		PartSize:    10,
+		Concurrency: 1,
+		Storage:     storage,
+		StateKey:    "upload",
+	}
+
+	fs.rejected[3] = true
+	if _, err := app.Archive.UploadFile(context.Background(), "token", path, opts); err == nil {
+		t.Fatal("rejected part should fail the upload")
+	}
+
+	// 续传时 upload_token 已失效, 重新初始化并从头上传
+	fs.rejected[3] = false
+	fs.expired["utoken-1"] = true
+	resp, err := app.Archive.UploadFile(context.Background(), "token", path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Resumed || resp.UploadToken != "utoken-2" || fs.inits != 2 {
+		t.Fatalf("upload should restart, %+v inits %d", resp, fs.inits)
+	}
+
+	if fs.attempts[1] != 2 || !bytes.Equal(fs.completed, content) {
+		t.Fatalf("unexpected attempts %v", fs.attempts)
+	}
+
+	if state, _ := loadUploadState(storage, "upload"); state != nil {
+		t.Fatalf("upload state should be deleted, %+v", state)
+	}
+}
+
+func TestArchive_UploadFilePartRetry(t *testing.T) {
+	fs := newFakeUposServer(t)
+	defer fs.Close()
+
+	// AppConfig.RetryPolicy 不为空时, 分片默认不再额外重试
+	app := NewAppClient(&AppConfig{
+		ClientID:    "cid",
+		MemberHost:  fs.URL,
+		UposHost:    fs.URL,
+		RetryPolicy: &basic.RetryPolicy{Backoff: basic.Backoff{InitialInterval: time.Millisecond}, MaxAttempts: 2},
+	})
+	path, _ := writeTempFile(t, 20)
+
+	fs.broken[1] = true
+	if _, err := app.Archive.UploadFile(context.Background(), "token", path, &UploadFileOptions{PartSize: 10, Concurrency: 1}); err == nil {
+		t.Fatal("broken part should fail the upload")
+	}
+
+	if fs.attempts[1] != 2 {
+		t.Fatalf("unexpected attempts %v", fs.attempts)
+	}
+}
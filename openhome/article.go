@@ -0,0 +1,313 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package openhome
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/go-resty/resty/v2"
+)
+
+type Article basicService
+
+const (
+	ArticleTemplateDefault = 4 // 默认模板
+
+	ArticleOriginalNo  = 0 // 非原创
+	ArticleOriginalYes = 1 // 原创
+)
+
+type ArticleCategory struct {
+	ID       int    `json:"id"`
+	ParentID int    `json:"parent_id"`
+	Name     string `json:"name"`
+}
+
+type ArticleStats struct {
+	View     int `json:"view"`
+	Favorite int `json:"favorite"`
+	Like     int `json:"like"`
+	Dislike  int `json:"dislike"`
+	Reply    int `json:"reply"`
+	Share    int `json:"share"`
+	Coin     int `json:"coin"`
+}
+
+// ArticleListInfo 文章所属的文集
+type ArticleListInfo struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	ImageUrl    string `json:"image_url"`
+	UpdateTime  int    `json:"update_time"`
+	Ctime       int    `json:"ctime"`
+	PublishTime int    `json:"publish_time"`
+	Summary     string `json:"summary"`
+	Words       int    `json:"words"`
+}
+
+type ArticleAddReq struct {
+	Title       string   `json:"title"`                  // 标题
+	Category    int      `json:"category"`               // 分类id, 由 Article.Categories 获取
+	TemplateID  int      `json:"template_id"`            // 模板id, 默认 ArticleTemplateDefault
+	Summary     string   `json:"summary"`                // 摘要
+	Content     string   `json:"content"`                // 正文, html 格式
+	BannerUrl   string   `json:"banner_url,omitempty"`   // 头图
+	ImageUrls   []string `json:"image_urls,omitempty"`   // 封面图片
+	Tags        string   `json:"tags,omitempty"`         // 标签, 多个标签用英文逗号分隔
+	Original    int      `json:"original"`               // 是否原创 ArticleOriginalYes / ArticleOriginalNo
+	ListID      int      `json:"list_id,omitempty"`      // 文集id
+	PublishTime int      `json:"publish_time,omitempty"` // 定时发布的时间戳, 0 表示立即发布
+	TopVideo    string   `json:"top_video_bvid,omitempty"`
+}
+
+type ArticleAddResp struct {
+	ID int `json:"id"`
+}
+
+// Add 提交文章
+func (a *Article) Add(accessToken string, req ArticleAddReq) (*ArticleAddResp, error) {
+	return a.AddCtx(context.Background(), accessToken, req)
+}
+
+// AddCtx 同 Add, 支持传入 context
+func (a *Article) AddCtx(ctx context.Context, accessToken string, req ArticleAddReq) (*ArticleAddResp, error) {
+	if req.TemplateID == 0 {
+		req.TemplateID = ArticleTemplateDefault
+	}
+
+	result := NewBaseResp(&ArticleAddResp{})
+
+	r := a.newRequest(ctx, accessToken).
+		SetHeader("Content-Type", "application/json").
+		SetBody(req)
+
+	if err := a.app.execute(r, resty.MethodPost, a.app.memberURL("/arcopen/fn/article/add"), result, withScopes(ScopesAtcBase)); err != nil {
+		return nil, err
+	}
+
+	return result.Data.(*ArticleAddResp), nil
+}
+
+type ArticleEditReq struct {
+	ID int `json:"id"`
+	ArticleAddReq
+}
+
+// Edit 编辑文章
+func (a *Article) Edit(accessToken string, req ArticleEditReq) error {
+	return a.EditCtx(context.Background(), accessToken, req)
+}
+
+// EditCtx 同 Edit, 支持传入 context
+func (a *Article) EditCtx(ctx context.Context, accessToken string, req ArticleEditReq) error {
+	if req.TemplateID == 0 {
+		req.TemplateID = ArticleTemplateDefault
+	}
+
+	result := NewBaseResp(nil)
+
+	r := a.newRequest(ctx, accessToken).
+		SetHeader("Content-Type", "application/json").
+		SetBody(req)
+
+	return a.app.execute(r, resty.MethodPost, a.app.memberURL("/arcopen/fn/article/edit"), result, withScopes(ScopesAtcBase))
+}
+
+// Delete 删除文章
+func (a *Article) Delete(accessToken string, id int) error {
+	return a.DeleteCtx(context.Background(), accessToken, id)
+}
+
+// DeleteCtx 同 Delete, 支持传入 context
+func (a *Article) DeleteCtx(ctx context.Context, accessToken string, id int) error {
+	result := NewBaseResp(nil)
+
+	r := a.newRequest(ctx, accessToken).
+		SetHeader("Content-Type", "application/json").
+		SetBody(map[string]int{
+			"id": id,
+		})
+
+	return a.app.execute(r, resty.MethodPost, a.app.memberURL("/arcopen/fn/article/delete"), result, withScopes(ScopesAtcBase))
+}
+
+type ArticleViewResp struct {
+	ID           int             `json:"id"`
+	Category     ArticleCategory `json:"category"`
+	Title        string          `json:"title"`
+	Summary      string          `json:"summary"`
+	Content      string          `json:"content"`
+	BannerUrl    string          `json:"banner_url"`
+	TemplateID   int             `json:"template_id"`
+	State        int             `json:"state"`
+	ImageUrls    []string        `json:"image_urls"`
+	Tags         []string        `json:"tags"`
+	PublishTime  int             `json:"publish_time"`
+	Ctime        int             `json:"ctime"`
+	Stats        ArticleStats    `json:"stats"`
+	Reason       string          `json:"reason"` // 未通过审核的原因
+	Words        int             `json:"words"`
+	List         ArticleListInfo `json:"list"`
+	TopVideoBvid string          `json:"top_video_bvid"`
+}
+
+// View 查询文章详情
+func (a *Article) View(accessToken string, id int) (*ArticleViewResp, error) {
+	return a.ViewCtx(context.Background(), accessToken, id)
+}
+
+// ViewCtx 同 View, 支持传入 context
+func (a *Article) ViewCtx(ctx context.Context, accessToken string, id int) (*ArticleViewResp, error) {
+	result := NewBaseResp(&ArticleViewResp{})
+
+	r := a.newRequest(ctx, accessToken).
+		SetQueryParam("id", strconv.Itoa(id))
+
+	if err := a.app.execute(r, resty.MethodGet, a.app.memberURL("/arcopen/fn/article/detail"), result, withScopes(ScopesAtcBase)); err != nil {
+		return nil, err
+	}
+
+	return result.Data.(*ArticleViewResp), nil
+}
+
+type ArticleListResp struct {
+	Page PageResp           `json:"page"`
+	List []*ArticleViewResp `json:"list"`
+}
+
+func (l ArticleListResp) IsEmpty() bool {
+	return len(l.List) == 0
+}
+
+type ArticleListReq struct {
+	PageNumber int `json:"pn"`
+	PageSize   int `json:"ps"`
+}
+
+// List 查询文章列表
+func (a *Article) List(accessToken string, req ArticleListReq) (*ArticleListResp, error) {
+	return a.ListCtx(context.Background(), accessToken, req)
+}
+
+// ListCtx 同 List, 支持传入 context
+func (a *Article) ListCtx(ctx context.Context, accessToken string, req ArticleListReq) (*ArticleListResp, error) {
+	result := NewBaseResp(&ArticleListResp{})
+
+	r := a.newRequest(ctx, accessToken).
+		SetQueryParams(map[string]string{
+			"pn": strconv.Itoa(req.PageNumber),
+			"ps": strconv.Itoa(req.PageSize),
+		})
+
+	if err := a.app.execute(r, resty.MethodGet, a.app.memberURL("/arcopen/fn/article/list"), result, withScopes(ScopesAtcBase)); err != nil {
+		return nil, err
+	}
+
+	return result.Data.(*ArticleListResp), nil
+}
+
+// IterateList 按页遍历文章列表
+func (a *Article) IterateList(ctx context.Context, accessToken string) *PageIterator[*ArticleViewResp] {
+	return NewPageIterator(ctx, DefaultPageSize, func(ctx context.Context, pn, ps int) ([]*ArticleViewResp, PageResp, error) {
+		resp, err := a.ListCtx(ctx, accessToken, ArticleListReq{PageNumber: pn, PageSize: ps})
+		if err != nil {
+			return nil, PageResp{}, err
+		}
+		return resp.List, resp.Page, nil
+	})
+}
+
+type ArticleCategoryResp struct {
+	ArticleCategory
+	Children []*ArticleCategory `json:"children"`
+}
+
+// Categories 查询专栏分类
+func (a *Article) Categories(accessToken string) ([]*ArticleCategoryResp, error) {
+	return a.CategoriesCtx(context.Background(), accessToken)
+}
+
+// CategoriesCtx 同 Categories, 支持传入 context
+func (a *Article) CategoriesCtx(ctx context.Context, accessToken string) ([]*ArticleCategoryResp, error) {
+	categories := make([]*ArticleCategoryResp, 0)
+	result := NewBaseResp(&categories)
+
+	r := a.newRequest(ctx, accessToken)
+
+	if err := a.app.execute(r, resty.MethodGet, a.app.memberURL("/arcopen/fn/article/category/list"), result, withScopes(ScopesAtcBase)); err != nil {
+		return nil, err
+	}
+
+	return categories, nil
+}
+
+type ArticleCard struct {
+	ID          int          `json:"id"`
+	Title       string       `json:"title"`
+	Summary     string       `json:"summary"`
+	BannerUrl   string       `json:"banner_url"`
+	ImageUrls   []string     `json:"image_urls"`
+	PublishTime int          `json:"publish_time"`
+	Stats       ArticleStats `json:"stats"`
+	Author      struct {
+		Mid  int64  `json:"mid"`
+		Name string `json:"name"`
+		Face string `json:"face"`
+	} `json:"author"`
+}
+
+// ArticleCardResp key 为文章id
+type ArticleCardResp map[string]ArticleCard
+
+// Cards 批量查询文章卡片信息, 可用于在正文中引用其他文章
+func (a *Article) Cards(accessToken string, ids []string) (ArticleCardResp, error) {
+	return a.CardsCtx(context.Background(), accessToken, ids)
+}
+
+// CardsCtx 同 Cards, 支持传入 context
+func (a *Article) CardsCtx(ctx context.Context, accessToken string, ids []string) (ArticleCardResp, error) {
+	cards := ArticleCardResp{}
+	result := NewBaseResp(&cards)
+
+	r := a.newRequest(ctx, accessToken).
+		SetQueryParam("ids", strings.Join(ids, ","))
+
+	if err := a.app.execute(r, resty.MethodGet, a.app.memberURL("/arcopen/fn/article/card"), result, withScopes(ScopesAtcBase)); err != nil {
+		return nil, err
+	}
+
+	return cards, nil
+}
+
+// newRequest 专栏接口的公共参数
+func (a *Article) newRequest(ctx context.Context, accessToken string) *resty.Request {
+	return a.app.newRequest(ctx).
+		SetHeader("x1-bilispy-color", "article-open").
+		SetQueryParams(map[string]string{
+			"client_id":    a.app.appCfg.ClientID,
+			"access_token": accessToken,
+		})
+}
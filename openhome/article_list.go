@@ -0,0 +1,285 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package openhome
+
+import (
+	"context"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/pkg/errors"
+)
+
+// ArticleList 文集管理
+type ArticleList basicService
+
+// 文集的限制
+const (
+	ArticleListNameMaxLength    = 20  // 名称不超过20个字符
+	ArticleListSummaryMaxLength = 200 // 简介不超过200个字符
+)
+
+// ErrInvalidArticleList 文集信息不符合要求
+var ErrInvalidArticleList = errors.New("invalid article list")
+
+type ArticleListAddReq struct {
+	Name     string `json:"name"`                // 名称
+	Summary  string `json:"summary,omitempty"`   // 简介
+	ImageUrl string `json:"image_url,omitempty"` // 封面
+}
+
+// Validate 检查文集信息, 长度按字符计算
+func (req ArticleListAddReq) Validate() error {
+	switch {
+	case req.Name == "":
+		return errors.Wrap(ErrInvalidArticleList, "name is empty")
+	case utf8.RuneCountInString(req.Name) > ArticleListNameMaxLength:
+		return errors.Wrapf(ErrInvalidArticleList, "name length must not exceed %d", ArticleListNameMaxLength)
+	case utf8.RuneCountInString(req.Summary) > ArticleListSummaryMaxLength:
+		return errors.Wrapf(ErrInvalidArticleList, "summary length must not exceed %d", ArticleListSummaryMaxLength)
+	}
+
+	return nil
+}
+
+type ArticleListAddResp struct {
+	ID int `json:"id"`
+}
+
+// Add 创建文集
+func (al *ArticleList) Add(accessToken string, req ArticleListAddReq) (*ArticleListAddResp, error) {
+	return al.AddCtx(context.Background(), accessToken, req)
+}
+
+// AddCtx 同 Add, 支持传入 context
+func (al *ArticleList) AddCtx(ctx context.Context, accessToken string, req ArticleListAddReq) (*ArticleListAddResp, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	result := NewBaseResp(&ArticleListAddResp{})
+
+	r := (*Article)(al).newRequest(ctx, accessToken).
+		SetHeader("Content-Type", "application/json").
+		SetBody(req)
+
+	if err := al.app.execute(r, resty.MethodPost, al.app.memberURL("/arcopen/fn/article/anthology/add"), result, withScopes(ScopesAtcBase)); err != nil {
+		return nil, err
+	}
+
+	return result.Data.(*ArticleListAddResp), nil
+}
+
+type ArticleListEditReq struct {
+	ID int `json:"id"`
+	ArticleListAddReq
+}
+
+// Edit 编辑文集
+func (al *ArticleList) Edit(accessToken string, req ArticleListEditReq) error {
+	return al.EditCtx(context.Background(), accessToken, req)
+}
+
+// EditCtx 同 Edit, 支持传入 context
+func (al *ArticleList) EditCtx(ctx context.Context, accessToken string, req ArticleListEditReq) error {
+	if req.ID <= 0 {
+		return errors.Wrap(ErrInvalidArticleList, "id is required")
+	}
+
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	result := NewBaseResp(nil)
+
+	r := (*Article)(al).newRequest(ctx, accessToken).
+		SetHeader("Content-Type", "application/json").
+		SetBody(req)
+
+	return al.app.execute(r, resty.MethodPost, al.app.memberURL("/arcopen/fn/article/anthology/edit"), result, withScopes(ScopesAtcBase))
+}
+
+// Delete 删除文集, 文集中的文章不会被删除
+func (al *ArticleList) Delete(accessToken string, id int) error {
+	return al.DeleteCtx(context.Background(), accessToken, id)
+}
+
+// DeleteCtx 同 Delete, 支持传入 context
+func (al *ArticleList) DeleteCtx(ctx context.Context, accessToken string, id int) error {
+	result := NewBaseResp(nil)
+
+	r := (*Article)(al).newRequest(ctx, accessToken).
+		SetHeader("Content-Type", "application/json").
+		SetBody(map[string]int{
+			"id": id,
+		})
+
+	return al.app.execute(r, resty.MethodPost, al.app.memberURL("/arcopen/fn/article/anthology/delete"), result, withScopes(ScopesAtcBase))
+}
+
+type ArticleListViewResp struct {
+	List     ArticleListInfo    `json:"list"`
+	Articles []*ArticleViewResp `json:"articles"` // 按文集中的顺序
+}
+
+// View 查询文集详情及其中的文章
+func (al *ArticleList) View(accessToken string, id int) (*ArticleListViewResp, error) {
+	return al.ViewCtx(context.Background(), accessToken, id)
+}
+
+// ViewCtx 同 View, 支持传入 context
+func (al *ArticleList) ViewCtx(ctx context.Context, accessToken string, id int) (*ArticleListViewResp, error) {
+	result := NewBaseResp(&ArticleListViewResp{})
+
+	r := (*Article)(al).newRequest(ctx, accessToken).
+		SetQueryParam("id", strconv.Itoa(id))
+
+	if err := al.app.execute(r, resty.MethodGet, al.app.memberURL("/arcopen/fn/article/anthology/detail"), result, withScopes(ScopesAtcBase)); err != nil {
+		return nil, err
+	}
+
+	return result.Data.(*ArticleListViewResp), nil
+}
+
+type ArticleListsResp struct {
+	Page PageResp           `json:"page"`
+	List []*ArticleListInfo `json:"list"`
+}
+
+func (l ArticleListsResp) IsEmpty() bool {
+	return len(l.List) == 0
+}
+
+type ArticleListsReq struct {
+	PageNumber int `json:"pn"`
+	PageSize   int `json:"ps"`
+}
+
+// List 查询文集列表
+func (al *ArticleList) List(accessToken string, req ArticleListsReq) (*ArticleListsResp, error) {
+	return al.ListCtx(context.Background(), accessToken, req)
+}
+
+// ListCtx 同 List, 支持传入 context
+func (al *ArticleList) ListCtx(ctx context.Context, accessToken string, req ArticleListsReq) (*ArticleListsResp, error) {
+	result := NewBaseResp(&ArticleListsResp{})
+
+	r := (*Article)(al).newRequest(ctx, accessToken).
+		SetQueryParams(map[string]string{
+			"pn": strconv.Itoa(req.PageNumber),
+			"ps": strconv.Itoa(req.PageSize),
+		})
+
+	if err := al.app.execute(r, resty.MethodGet, al.app.memberURL("/arcopen/fn/article/anthology/list"), result, withScopes(ScopesAtcBase)); err != nil {
+		return nil, err
+	}
+
+	return result.Data.(*ArticleListsResp), nil
+}
+
+// IterateList 按页遍历文集列表
+func (al *ArticleList) IterateList(ctx context.Context, accessToken string) *PageIterator[*ArticleListInfo] {
+	return NewPageIterator(ctx, DefaultPageSize, func(ctx context.Context, pn, ps int) ([]*ArticleListInfo, PageResp, error) {
+		resp, err := al.ListCtx(ctx, accessToken, ArticleListsReq{PageNumber: pn, PageSize: ps})
+		if err != nil {
+			return nil, PageResp{}, err
+		}
+		return resp.List, resp.Page, nil
+	})
+}
+
+// SetArticles 设置文集中的文章及顺序, 不在 articleIDs 中的文章会被移出文集
+func (al *ArticleList) SetArticles(accessToken string, id int, articleIDs []int) error {
+	return al.SetArticlesCtx(context.Background(), accessToken, id, articleIDs)
+}
+
+// SetArticlesCtx 同 SetArticles, 支持传入 context
+func (al *ArticleList) SetArticlesCtx(ctx context.Context, accessToken string, id int, articleIDs []int) error {
+	if id <= 0 {
+		return errors.Wrap(ErrInvalidArticleList, "id is required")
+	}
+
+	seen := make(map[int]bool, len(articleIDs))
+	for _, articleID := range articleIDs {
+		if articleID <= 0 {
+			return errors.Wrapf(ErrInvalidArticleList, "invalid article id %d", articleID)
+		}
+		if seen[articleID] {
+			return errors.Wrapf(ErrInvalidArticleList, "duplicate article id %d", articleID)
+		}
+		seen[articleID] = true
+	}
+
+	result := NewBaseResp(nil)
+
+	r := (*Article)(al).newRequest(ctx, accessToken).
+		SetHeader("Content-Type", "application/json").
+		SetBody(map[string]interface{}{
+			"id":          id,
+			"article_ids": articleIDs,
+		})
+
+	return al.app.execute(r, resty.MethodPost, al.app.memberURL("/arcopen/fn/article/anthology/articles/edit"), result, withScopes(ScopesAtcBase))
+}
+
+// AddArticles 将文章追加到文集末尾, 已在文集中的文章保持原来的位置
+// 通过 View 获取当前文章后调用 SetArticles 整体设置, 不是原子操作:
+// 两次请求之间其他地方对文集文章的修改会被覆盖, 并发修改同一个文集时需要调用者自行加锁
+// articleIDs 为空或全部已在文集中时不会调用 SetArticles
+func (al *ArticleList) AddArticles(accessToken string, id int, articleIDs ...int) error {
+	return al.AddArticlesCtx(context.Background(), accessToken, id, articleIDs...)
+}
+
+// AddArticlesCtx 同 AddArticles, 支持传入 context
+func (al *ArticleList) AddArticlesCtx(ctx context.Context, accessToken string, id int, articleIDs ...int) error {
+	if len(articleIDs) == 0 {
+		return nil
+	}
+
+	view, err := al.ViewCtx(ctx, accessToken, id)
+	if err != nil {
+		return errors.WithMessage(err, "view article list fail")
+	}
+
+	ids := make([]int, 0, len(view.Articles)+len(articleIDs))
+	exists := make(map[int]bool, cap(ids))
+	for _, article := range view.Articles {
+		ids = append(ids, article.ID)
+		exists[article.ID] = true
+	}
+
+	for _, articleID := range articleIDs {
+		if !exists[articleID] {
+			ids = append(ids, articleID)
+			exists[articleID] = true
+		}
+	}
+
+	if len(ids) == len(view.Articles) {
+		return nil
+	}
+
+	return al.SetArticlesCtx(ctx, accessToken, id, ids)
+}
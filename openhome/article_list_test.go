@@ -0,0 +1,170 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package openhome
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestArticleListAddReq_Validate(t *testing.T) {
+	tests := []struct {
+		req ArticleListAddReq
+		ok  bool
+	}{
+		{req: ArticleListAddReq{Name: "文集"}, ok: true},
+		{req: ArticleListAddReq{}},
+		{req: ArticleListAddReq{Name: strings.Repeat("文", ArticleListNameMaxLength)}, ok: true},
+		{req: ArticleListAddReq{Name: strings.Repeat("文", ArticleListNameMaxLength+1)}},
+		{req: ArticleListAddReq{Name: "文集", Summary: strings.Repeat("简", ArticleListSummaryMaxLength+1)}},
+	}
+
+	for i, tt := range tests {
+		err := tt.req.Validate()
+		if tt.ok != (err == nil) || (err != nil && !errors.Is(err, ErrInvalidArticleList)) {
+			t.Errorf("case %d: unexpected err %v", i, err)
+		}
+	}
+}
+
+func TestArticleList(t *testing.T) {
+	var articleIDs []interface{}
+	srv := newArticleServer(t, map[string]http.HandlerFunc{
+		"POST /arcopen/fn/article/anthology/add": func(w http.ResponseWriter, r *http.Request) {
+			if body := decodeBody(t, r); body["name"] != "文集" || body["summary"] != "简介" {
+				t.Errorf("unexpected body %v", body)
+			}
+			_, _ = w.Write([]byte(`{"code":0,"message":"0","data":{"id":3}}`))
+		},
+		"POST /arcopen/fn/article/anthology/edit": func(w http.ResponseWriter, r *http.Request) {
+			if body := decodeBody(t, r); body["id"] != float64(3) || body["name"] != "新文集" {
+				t.Errorf("unexpected body %v", body)
+			}
+			_, _ = w.Write([]byte(`{"code":0,"message":"0"}`))
+		},
+		"POST /arcopen/fn/article/anthology/delete": func(w http.ResponseWriter, r *http.Request) {
+			if body := decodeBody(t, r); body["id"] != float64(3) {
+				t.Errorf("unexpected body %v", body)
+			}
+			_, _ = w.Write([]byte(`{"code":0,"message":"0"}`))
+		},
+		"GET /arcopen/fn/article/anthology/detail": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("id") != "3" {
+				t.Errorf("unexpected query %s", r.URL.RawQuery)
+			}
+			_, _ = w.Write([]byte(`{"code":0,"message":"0","data":{"list":{"id":3,"name":"文集","words":100},"articles":[{"id":7},{"id":8}]}}`))
+		},
+		"GET /arcopen/fn/article/anthology/list": func(w http.ResponseWriter, r *http.Request) {
+			pn, _ := strconv.Atoi(r.URL.Query().Get("pn"))
+			_, _ = fmt.Fprintf(w, `{"code":0,"message":"0","data":{"page":{"pn":%d,"ps":1,"total":2},"list":[{"id":%d,"name":"文集"}]}}`, pn, pn)
+		},
+		"POST /arcopen/fn/article/anthology/articles/edit": func(w http.ResponseWriter, r *http.Request) {
+			body := decodeBody(t, r)
+			if body["id"] != float64(3) {
+				t.Errorf("unexpected body %v", body)
+			}
+			articleIDs, _ = body["article_ids"].([]interface{})
+			_, _ = w.Write([]byte(`{"code":0,"message":"0"}`))
+		},
+	})
+	defer srv.Close()
+
+	app := NewAppClient(&AppConfig{ClientID: "cid", MemberHost: srv.URL})
+
+	addResp, err := app.ArticleList.Add("token", ArticleListAddReq{Name: "文集", Summary: "简介"})
+	if err != nil || addResp.ID != 3 {
+		t.Fatalf("add fail %+v %v", addResp, err)
+	}
+
+	if err = app.ArticleList.Edit("token", ArticleListEditReq{ID: 3, ArticleListAddReq: ArticleListAddReq{Name: "新文集"}}); err != nil {
+		t.Fatalf("edit fail %v", err)
+	}
+
+	view, err := app.ArticleList.View("token", 3)
+	if err != nil || view.List.Words != 100 || len(view.Articles) != 2 {
+		t.Fatalf("view fail %+v %v", view, err)
+	}
+
+	lists, err := app.ArticleList.IterateList(context.Background(), "token").All()
+	if err != nil || len(lists) != 2 || lists[1].ID != 2 {
+		t.Fatalf("list fail %v %v", lists, err)
+	}
+
+	if err = app.ArticleList.SetArticles("token", 3, []int{8, 7}); err != nil || fmt.Sprint(articleIDs) != "[8 7]" {
+		t.Fatalf("set articles fail %v %v", articleIDs, err)
+	}
+
+	// 已有的文章保持原来的位置
+	if err = app.ArticleList.AddArticles("token", 3, 8, 9); err != nil || fmt.Sprint(articleIDs) != "[7 8 9]" {
+		t.Fatalf("add articles fail %v %v", articleIDs, err)
+	}
+
+	// 没有需要追加的文章时不会整体设置
+	articleIDs = nil
+	if err = app.ArticleList.AddArticles("token", 3); err != nil || articleIDs != nil {
+		t.Fatalf("empty add should be skipped %v %v", articleIDs, err)
+	}
+	if err = app.ArticleList.AddArticles("token", 3, 7, 8); err != nil || articleIDs != nil {
+		t.Fatalf("existing articles should be skipped %v %v", articleIDs, err)
+	}
+
+	if err = app.ArticleList.Delete("token", 3); err != nil {
+		t.Fatalf("delete fail %v", err)
+	}
+}
+
+func TestArticleList_ValidateBeforeRequest(t *testing.T) {
+	var requests int32
+	srv := newArticleServer(t, map[string]http.HandlerFunc{})
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	})
+	defer srv.Close()
+
+	app := NewAppClient(&AppConfig{ClientID: "cid", MemberHost: srv.URL})
+
+	errs := []error{
+		func() error { _, err := app.ArticleList.Add("token", ArticleListAddReq{}); return err }(),
+		app.ArticleList.Edit("token", ArticleListEditReq{ArticleListAddReq: ArticleListAddReq{Name: "文集"}}),
+		app.ArticleList.SetArticles("token", 3, []int{7, 7}),
+		app.ArticleList.SetArticles("token", 3, []int{0}),
+		app.ArticleList.SetArticles("token", 0, []int{7}),
+	}
+
+	for i, err := range errs {
+		if !errors.Is(err, ErrInvalidArticleList) {
+			t.Errorf("case %d: expected ErrInvalidArticleList, got %v", i, err)
+		}
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 0 {
+		t.Fatalf("invalid request should not be sent, got %d", n)
+	}
+}
@@ -0,0 +1,152 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package openhome
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// newArticleServer 模拟专栏接口, 校验公共参数后交给 handlers 处理
+func newArticleServer(t *testing.T, handlers map[string]http.HandlerFunc) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("client_id") != "cid" || query.Get("access_token") != "token" || r.Header.Get("x1-bilispy-color") != "article-open" {
+			t.Errorf("unexpected request %s %s", r.URL, r.Header)
+		}
+
+		handler, ok := handlers[r.Method+" "+r.URL.Path]
+		if !ok {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		handler(w, r)
+	}))
+}
+
+func decodeBody(t *testing.T, r *http.Request) map[string]interface{} {
+	body := map[string]interface{}{}
+	raw, _ := io.ReadAll(r.Body)
+	if err := json.Unmarshal(raw, &body); err != nil {
+		t.Errorf("invalid body %s", raw)
+	}
+	return body
+}
+
+func TestArticle(t *testing.T) {
+	const detail = `{"id":7,"title":"标题","category":{"id":2,"parent_id":1,"name":"游戏"},"stats":{"view":10},"list":{"id":3,"name":"文集"},"tags":["a"]}`
+
+	srv := newArticleServer(t, map[string]http.HandlerFunc{
+		"POST /arcopen/fn/article/add": func(w http.ResponseWriter, r *http.Request) {
+			body := decodeBody(t, r)
+			if body["title"] != "标题" || body["template_id"] != float64(ArticleTemplateDefault) || body["original"] != float64(ArticleOriginalYes) {
+				t.Errorf("unexpected body %v", body)
+			}
+			_, _ = w.Write([]byte(`{"code":0,"message":"0","data":{"id":7}}`))
+		},
+		"POST /arcopen/fn/article/edit": func(w http.ResponseWriter, r *http.Request) {
+			body := decodeBody(t, r)
+			if body["id"] != float64(7) || body["title"] != "新标题" {
+				t.Errorf("unexpected body %v", body)
+			}
+			_, _ = w.Write([]byte(`{"code":0,"message":"0"}`))
+		},
+		"POST /arcopen/fn/article/delete": func(w http.ResponseWriter, r *http.Request) {
+			if body := decodeBody(t, r); body["id"] != float64(7) {
+				t.Errorf("unexpected body %v", body)
+			}
+			_, _ = w.Write([]byte(`{"code":0,"message":"0"}`))
+		},
+		"GET /arcopen/fn/article/detail": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("id") != "7" {
+				t.Errorf("unexpected query %s", r.URL.RawQuery)
+			}
+			_, _ = w.Write([]byte(`{"code":0,"message":"0","data":` + detail + `}`))
+		},
+		"GET /arcopen/fn/article/list": func(w http.ResponseWriter, r *http.Request) {
+			pn, _ := strconv.Atoi(r.URL.Query().Get("pn"))
+			_, _ = fmt.Fprintf(w, `{"code":0,"message":"0","data":{"page":{"pn":%d,"ps":1,"total":2},"list":[{"id":%d}]}}`, pn, pn)
+		},
+		"GET /arcopen/fn/article/category/list": func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"code":0,"message":"0","data":[{"id":1,"name":"游戏","children":[{"id":2,"parent_id":1,"name":"单机"}]}]}`))
+		},
+		"GET /arcopen/fn/article/card": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("ids") != "7,8" {
+				t.Errorf("unexpected query %s", r.URL.RawQuery)
+			}
+			_, _ = w.Write([]byte(`{"code":0,"message":"0","data":{"7":{"id":7,"title":"标题","author":{"mid":1,"name":"bianka"}}}}`))
+		},
+	})
+	defer srv.Close()
+
+	app := NewAppClient(&AppConfig{ClientID: "cid", MemberHost: srv.URL})
+	article := ArticleAddReq{Title: "标题", Category: 2, Content: "<p>正文</p>", Original: ArticleOriginalYes}
+
+	addResp, err := app.Article.Add("token", article)
+	if err != nil || addResp.ID != 7 {
+		t.Fatalf("add fail %+v %v", addResp, err)
+	}
+
+	article.Title = "新标题"
+	if err = app.Article.Edit("token", ArticleEditReq{ID: 7, ArticleAddReq: article}); err != nil {
+		t.Fatalf("edit fail %v", err)
+	}
+
+	view, err := app.Article.View("token", 7)
+	if err != nil || view.Title != "标题" || view.Category.Name != "游戏" || view.Stats.View != 10 || view.List.ID != 3 {
+		t.Fatalf("view fail %+v %v", view, err)
+	}
+
+	list, err := app.Article.List("token", ArticleListReq{PageNumber: 1, PageSize: 1})
+	if err != nil || list.IsEmpty() || list.Page.Total != 2 {
+		t.Fatalf("list fail %+v %v", list, err)
+	}
+
+	all, err := app.Article.IterateList(context.Background(), "token").All()
+	if err != nil || len(all) != 2 || all[1].ID != 2 {
+		t.Fatalf("iterate fail %v %v", all, err)
+	}
+
+	categories, err := app.Article.Categories("token")
+	if err != nil || len(categories) != 1 || categories[0].Children[0].Name != "单机" {
+		t.Fatalf("categories fail %+v %v", categories, err)
+	}
+
+	cards, err := app.Article.Cards("token", []string{"7", "8"})
+	if err != nil || cards["7"].Author.Name != "bianka" {
+		t.Fatalf("cards fail %+v %v", cards, err)
+	}
+
+	if err = app.Article.Delete("token", 7); err != nil {
+		t.Fatalf("delete fail %v", err)
+	}
+}
@@ -24,17 +24,64 @@
 package openhome
 
 import (
+	"context"
+	"io"
 	"math/rand"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/pkg/errors"
+	"github.com/vtb-link/bianka/basic"
 	errors2 "github.com/vtb-link/bianka/errors"
 )
 
 var _random = rand.New(rand.NewSource(time.Now().UnixNano()))
 
+const (
+	HostMember    = "https://member.bilibili.com"     // 开放平台接口 (线上环境)
+	HostUatMember = "https://uat-member.bilibili.com" // 开放平台接口 (测试环境)
+	HostApi       = "https://api.bilibili.com"        // 授权接口
+	HostUpos      = "https://openupos.bilivideo.com"  // 视频分片上传
+	HostAccount   = "https://account.bilibili.com"    // 授权页面
+)
+
+// 限流分组, 用于 AppConfig.RateLimiter
+const (
+	RateLimitGroupOAuth   = "oauth"   // 授权
+	RateLimitGroupUser    = "user"    // 用户
+	RateLimitGroupLive    = "live"    // 直播
+	RateLimitGroupArchive = "archive" // 稿件
+	RateLimitGroupUpload  = "upload"  // 视频分片及封面上传
+	RateLimitGroupData    = "data"    // 数据
+	RateLimitGroupArticle = "article" // 专栏
+	RateLimitGroupOther   = "other"   // 其他
+)
+
+// rateLimitGroup 请求地址对应的限流分组
+func rateLimitGroup(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return RateLimitGroupOther
+	}
+
+	switch {
+	case strings.HasPrefix(u.Path, "/x/account-oauth2/"):
+		return RateLimitGroupOAuth
+	case strings.HasPrefix(u.Path, "/video/"), u.Path == "/arcopen/fn/archive/cover/upload":
+		return RateLimitGroupUpload
+	case strings.HasPrefix(u.Path, "/arcopen/fn/"):
+		switch group, _, _ := strings.Cut(strings.TrimPrefix(u.Path, "/arcopen/fn/"), "/"); group {
+		case RateLimitGroupUser, RateLimitGroupLive, RateLimitGroupArchive, RateLimitGroupData, RateLimitGroupArticle:
+			return group
+		}
+	}
+
+	return RateLimitGroupOther
+}
+
 type PageResp struct {
 	PageNumber int `json:"pn"`
 	PageSize   int `json:"ps"`
@@ -65,20 +112,73 @@ type basicService struct {
 type AppConfig struct {
 	ClientID     string `json:"client_id"`     // 应用id
 	ClientSecret string `json:"client_secret"` // 应用密钥
+
+	// 以下为可选配置, 为空时使用默认值
+	MemberHost  string `json:"member_host"`  // 开放平台接口地址 默认 HostMember
+	ApiHost     string `json:"api_host"`     // 授权接口地址 默认 HostApi
+	UposHost    string `json:"upos_host"`    // 视频分片上传地址 默认 HostUpos
+	AccountHost string `json:"account_host"` // 授权页面地址 默认 HostAccount
+
+	HttpClient  *http.Client  `json:"-"` // 共享的 http.Client, 可用于复用链接, 设置代理等
+	RestyClient *resty.Client `json:"-"` // 共享的 resty.Client, 优先于 HttpClient
+
+	RetryPolicy *basic.RetryPolicy `json:"-"` // 请求重试策略, 为空时不重试
+	RateLimiter *basic.RateLimiter `json:"-"` // 请求限流, 为空时不限制, 分组见 RateLimitGroupOAuth 等
+
+	TokenStorage basic.Storage `json:"-"` // AppClient.Tokens 使用的存储, 为空时使用 basic.MapStorage
+
+	// CheckScopes 请求前检查用户是否授权了接口需要的权限, 未授权时返回 *MissingScopeError
+	// 使用 OpenIDToken 时使用授权时保存的权限, 否则通过 User.GetAccountScopes 查询并缓存 ScopeCacheTTL
+	CheckScopes   bool          `json:"check_scopes"`
+	ScopeCacheTTL time.Duration `json:"scope_cache_ttl"` // 默认 DefaultScopeCacheTTL
+}
+
+// withDefault 填充默认值
+func (cfg AppConfig) withDefault() *AppConfig {
+	if cfg.MemberHost == "" {
+		cfg.MemberHost = HostMember
+	}
+	if cfg.ApiHost == "" {
+		cfg.ApiHost = HostApi
+	}
+	if cfg.UposHost == "" {
+		cfg.UposHost = HostUpos
+	}
+	if cfg.AccountHost == "" {
+		cfg.AccountHost = HostAccount
+	}
+
+	return &cfg
 }
 
 type AppClient struct {
 	appCfg *AppConfig
+	rc     *resty.Client // 所有请求共享
+	scopes scopeCache    // AppConfig.CheckScopes 使用
+
+	OAuth       *OAuth
+	User        *User
+	Live        *Live
+	Archive     *Archive
+	Data        *Data
+	Article     *Article
+	ArticleList *ArticleList
 
-	OAuth   *OAuth
-	User    *User
-	Live    *Live
-	Archive *Archive
+	Tokens *TokenManager // 按 openid 管理 access_token, 见 OpenIDToken
 }
 
 func NewAppClient(cfg *AppConfig) *AppClient {
 	app := &AppClient{
-		appCfg: cfg,
+		appCfg: cfg.withDefault(),
+	}
+
+	switch {
+	case cfg.RestyClient != nil:
+		app.rc = cfg.RestyClient
+	case cfg.HttpClient != nil:
+		app.rc = resty.NewWithClient(cfg.HttpClient)
+	default:
+		app.rc = resty.New()
 	}
 
 	bs := &basicService{
@@ -89,18 +189,179 @@ func NewAppClient(cfg *AppConfig) *AppClient {
 	app.User = (*User)(bs)
 	app.Live = (*Live)(bs)
 	app.Archive = (*Archive)(bs)
+	app.Data = (*Data)(bs)
+	app.Article = (*Article)(bs)
+	app.ArticleList = (*ArticleList)(bs)
+
+	app.Tokens = NewTokenManager(app.OAuth, cfg.TokenStorage)
 
 	return app
 }
 
+func (app *AppClient) memberURL(path string) string {
+	return app.appCfg.MemberHost + path
+}
+
+func (app *AppClient) apiURL(path string) string {
+	return app.appCfg.ApiHost + path
+}
+
+func (app *AppClient) uposURL(path string) string {
+	return app.appCfg.UposHost + path
+}
+
+func (app *AppClient) newRequest(ctx context.Context) *resty.Request {
+	return app.rc.R().SetContext(ctx)
+}
+
+type executeOptions struct {
+	scopes     []string // 接口需要的权限
+	noRetry    bool
+	idempotent bool // 重复请求不会产生副作用
+	rewind     []io.Seeker
+	offsets    []int64
+}
+
+type executeOption func(opts *executeOptions)
+
+// withIdempotent 声明接口是幂等的, 非幂等方法(POST)也按照完整的重试策略重试
+func withIdempotent() executeOption {
+	return func(opts *executeOptions) {
+		opts.idempotent = true
+	}
+}
+
+// isIdempotentMethod 按照 HTTP 语义判断方法是否幂等
+func isIdempotentMethod(method string) bool {
+	switch method {
+	case resty.MethodGet, resty.MethodHead, resty.MethodOptions, resty.MethodPut, resty.MethodDelete:
+		return true
+	}
+
+	return false
+}
+
+// withBodyReader 请求体包含 reader 时使用
+// 实现了 io.Seeker 的 reader 会在重试前回到初始位置, 否则不重试
+func withBodyReader(reader io.Reader) executeOption {
+	return func(opts *executeOptions) {
+		seeker, ok := reader.(io.Seeker)
+		if !ok {
+			opts.noRetry = true
+			return
+		}
+
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			opts.noRetry = true
+			return
+		}
+
+		opts.rewind = append(opts.rewind, seeker)
+		opts.offsets = append(opts.offsets, offset)
+	}
+}
+
+// execute 发起请求并检查响应, 按照 AppConfig.RetryPolicy 重试, 每次请求前按照 AppConfig.RateLimiter 限流
+// 非幂等的请求只重试服务端没有处理的错误(建立链接失败, 限流), 见 basic.NonIdempotentRetryable
+// access_token 为 OpenIDToken 时通过 AppClient.Tokens 获取, 接口返回 access_token 无效时刷新后重试一次
+// 开启 AppConfig.CheckScopes 时, 请求前检查 withScopes 声明的权限
+func (app *AppClient) execute(r *resty.Request, method, url string, result *BaseResp, opts ...executeOption) error {
+	options := &executeOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	policy := app.appCfg.RetryPolicy
+	switch {
+	case options.noRetry:
+		policy = nil
+	case !options.idempotent && !isIdempotentMethod(method):
+		policy = policy.NonIdempotent()
+	}
+
+	openid, byOpenID := ParseOpenIDToken(r.QueryParam.Get("access_token"))
+	group := rateLimitGroup(url)
+	sent := false
+
+	checkScopes := app.appCfg.CheckScopes && len(options.scopes) > 0
+	do := func() error {
+		accessToken := r.QueryParam.Get("access_token")
+		var token *Token
+		if byOpenID {
+			var err error
+			if token, err = app.Tokens.Token(r.Context(), openid); err != nil {
+				return err
+			}
+			accessToken = token.AccessToken.AccessToken
+			r.QueryParam.Set("access_token", accessToken)
+		}
+
+		if checkScopes {
+			if err := app.checkScopes(r.Context(), accessToken, token, options.scopes); err != nil {
+				return err
+			}
+		}
+
+		return policy.Do(r.Context(), func(_ int) error {
+			if sent {
+				for i, seeker := range options.rewind {
+					if _, err := seeker.Seek(options.offsets[i], io.SeekStart); err != nil {
+						return errors.Wrap(err, "rewind body fail")
+					}
+				}
+			}
+
+			return app.appCfg.RateLimiter.Do(r.Context(), group, func() error {
+				sent = true
+				resp, err := r.SetResult(result).Execute(method, url)
+				if err != nil {
+					return errors.Wrapf(err, "do request fail")
+				}
+
+				return checkResp(resp, result)
+			})
+		})
+	}
+
+	err := do()
+	if _, isAPIErr := errors2.AsAPIError(err); checkScopes && isAPIErr && errors.Is(err, errors2.ErrPermissionDenied) {
+		// 接口返回权限不足, 用户可能取消了授权; 本地检查出的 MissingScopeError 不需要清理
+		app.scopes.del(r.QueryParam.Get("access_token"))
+	}
+
+	if byOpenID && !options.noRetry && errors.Is(err, errors2.ErrTokenExpired) {
+		if _, refreshErr := app.Tokens.Refresh(r.Context(), openid); refreshErr != nil {
+			return errors.WithMessagef(err, "refresh token fail: %v", refreshErr)
+		}
+		err = do()
+	}
+
+	return err
+}
+
+// checkResp 检查响应, 失败时返回 *errors.APIError
 func checkResp(resp *resty.Response, result *BaseResp) error {
-	if resp.StatusCode() != http.StatusOK {
-		return errors.Wrapf(errors2.BilibiliRequestFailed, "do request fail, resp: %v", resp)
+	if resp.StatusCode() == http.StatusOK && result.IsSuccess() {
+		return nil
 	}
 
-	if !result.IsSuccess() {
-		return errors.Wrapf(errors2.BilibiliResponseNotSuccess, "request fail: %d %s", result.Code, result.Message)
+	apiErr := &errors2.APIError{
+		Platform:   errors2.PlatformOpenHome,
+		HTTPStatus: resp.StatusCode(),
+		Code:       int64(result.Code),
+		Message:    result.Message,
+	}
+
+	if resp.RawResponse != nil && resp.RawResponse.Request != nil {
+		apiErr.Endpoint = resp.RawResponse.Request.URL.Path
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		// 非200时 result 不会被解析
+		apiErr.Code = 0
+		apiErr.Message = resp.Status()
 	}
 
-	return nil
+	return errors.WithStack(apiErr)
 }
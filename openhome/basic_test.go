@@ -0,0 +1,240 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package openhome
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vtb-link/bianka/basic"
+	errors2 "github.com/vtb-link/bianka/errors"
+)
+
+type countingTransport struct {
+	n int32
+}
+
+func (ct *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&ct.n, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestAppClient_CustomHostAndHttpClient(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/arcopen/fn/user/account/info", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("client_id") != "cid" || r.URL.Query().Get("access_token") != "token" {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+		_, _ = w.Write([]byte(`{"code":0,"message":"0","data":{"name":"bianka","openid":"oid"}}`))
+	})
+	mux.HandleFunc("/x/account-oauth2/v1/token", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":0,"message":"0","data":{"access_token":"token","scopes":["USER_INFO"]}}`))
+	})
+	mux.HandleFunc("/video/v2/part/upload", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":0,"message":"0"}`))
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	transport := &countingTransport{}
+	app := NewAppClient(&AppConfig{
+		ClientID:    "cid",
+		MemberHost:  srv.URL,
+		ApiHost:     srv.URL,
+		UposHost:    srv.URL,
+		AccountHost: srv.URL,
+		HttpClient:  &http.Client{Transport: transport},
+	})
+
+	info, err := app.User.GetAccountInfo("token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Openid != "oid" {
+		t.Fatalf("unexpected openid %s", info.Openid)
+	}
+
+	tokenResp, err := app.OAuth.Code2AccessToken("code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokenResp.AccessToken.AccessToken != "token" {
+		t.Fatalf("unexpected access token %s", tokenResp.AccessToken.AccessToken)
+	}
+
+	if err = app.Archive.UploadPart("utoken", 1, strings.NewReader("part")); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := atomic.LoadInt32(&transport.n); n != 3 {
+		t.Fatalf("shared http client should be used, got %d requests", n)
+	}
+
+	if u := app.OAuth.GetOAuthGenerator().GenerateAuthorizationURL(); !strings.HasPrefix(u, srv.URL+"/pc/account-pc/auth/oauth?") {
+		t.Fatalf("unexpected authorization url %s", u)
+	}
+}
+
+func TestAppClient_Retry(t *testing.T) {
+	var requests int32
+	var parts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.URL.Path == "/video/v2/part/upload" {
+			file, _, err := r.FormFile("file")
+			if err != nil {
+				t.Errorf("read file fail: %v", err)
+				return
+			}
+			part, _ := io.ReadAll(file)
+			parts = append(parts, string(part))
+		}
+
+		// 第一次请求限流, 之后成功
+		if atomic.AddInt32(&requests, 1)%2 == 1 {
+			_, _ = w.Write([]byte(`{"code":-509,"message":"请求过于频繁"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":0,"message":"0","data":{"name":"bianka","openid":"oid"}}`))
+	}))
+	defer srv.Close()
+
+	app := NewAppClient(&AppConfig{
+		ClientID:    "cid",
+		MemberHost:  srv.URL,
+		UposHost:    srv.URL,
+		RetryPolicy: &basic.RetryPolicy{Backoff: basic.Backoff{InitialInterval: time.Millisecond}, MaxAttempts: 2},
+	})
+
+	info, err := app.User.GetAccountInfo("token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Openid != "oid" || atomic.LoadInt32(&requests) != 2 {
+		t.Fatalf("unexpected result %+v, requests %d", info, requests)
+	}
+
+	// 可以 Seek 的 reader 重试时回到初始位置
+	if err = app.Archive.UploadPart("utoken", 1, bytes.NewReader([]byte("part"))); err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 2 || parts[0] != "part" || parts[1] != "part" {
+		t.Fatalf("unexpected parts %v", parts)
+	}
+
+	// 不能 Seek 的 reader 不重试
+	err = app.Archive.UploadPart("utoken", 1, io.MultiReader(strings.NewReader("part")))
+	if !errors.Is(err, errors2.ErrRateLimited) || len(parts) != 3 {
+		t.Fatalf("unexpected result %v, parts %v", err, parts)
+	}
+}
+
+func TestAppClient_RetryNonIdempotent(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte(`{"code":-500,"message":"服务器错误"}`))
+	}))
+	defer srv.Close()
+
+	app := NewAppClient(&AppConfig{
+		ClientID:    "cid",
+		MemberHost:  srv.URL,
+		RetryPolicy: &basic.RetryPolicy{Backoff: basic.Backoff{InitialInterval: time.Millisecond}, MaxAttempts: 2},
+	})
+
+	// POST 可能已经被处理, 5xx 不重试
+	if err := app.Archive.Delete("token", "resource"); !errors.Is(err, errors2.ErrServerError) || atomic.LoadInt32(&requests) != 1 {
+		t.Fatalf("unexpected result %v, requests %d", err, requests)
+	}
+
+	// GET 按照完整策略重试
+	if _, err := app.User.GetAccountInfo("token"); !errors.Is(err, errors2.ErrServerError) || atomic.LoadInt32(&requests) != 3 {
+		t.Fatalf("unexpected result %v, requests %d", err, requests)
+	}
+}
+
+func TestRateLimitGroup(t *testing.T) {
+	tests := map[string]string{
+		HostApi + "/x/account-oauth2/v1/token":            RateLimitGroupOAuth,
+		HostMember + "/arcopen/fn/user/account/info":      RateLimitGroupUser,
+		HostMember + "/arcopen/fn/live/room/ws-heartbeat": RateLimitGroupLive,
+		HostMember + "/arcopen/fn/archive/view/list":      RateLimitGroupArchive,
+		HostMember + "/arcopen/fn/archive/cover/upload":   RateLimitGroupUpload,
+		HostUpos + "/video/v2/part/upload":                RateLimitGroupUpload,
+		HostMember + "/arcopen/fn/data/user/stat":         RateLimitGroupData,
+		HostMember + "/arcopen/fn/article/list":           RateLimitGroupArticle,
+		HostMember + "/arcopen/fn/unknown/path":           RateLimitGroupOther,
+		HostAccount + "/pc/account-pc/auth/oauth":         RateLimitGroupOther,
+	}
+
+	for rawURL, want := range tests {
+		if got := rateLimitGroup(rawURL); got != want {
+			t.Errorf("rateLimitGroup(%s) = %s, want %s", rawURL, got, want)
+		}
+	}
+}
+
+func TestAppClient_RateLimit(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		atomic.AddInt32(&requests, 1)
+		_, _ = w.Write([]byte(`{"code":-509,"message":"请求过于频繁"}`))
+	}))
+	defer srv.Close()
+
+	app := NewAppClient(&AppConfig{
+		ClientID:    "cid",
+		MemberHost:  srv.URL,
+		RateLimiter: basic.NewRateLimiter().WithMode(basic.RateLimitModeFailFast),
+	})
+
+	if _, err := app.User.GetAccountInfo("token"); !errors.Is(err, errors2.ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+
+	// 收到限流错误后该分组暂停, 不会发出请求
+	if _, err := app.User.GetAccountInfo("token"); !errors.Is(err, basic.ErrRateLimitExceeded) {
+		t.Fatalf("expected ErrRateLimitExceeded, got %v", err)
+	}
+
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatalf("paused group should not send requests, got %d", n)
+	}
+}
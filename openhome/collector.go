@@ -0,0 +1,285 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package openhome
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vtb-link/bianka/basic"
+	"golang.org/x/exp/slog"
+)
+
+// DefaultCollectInterval 默认采集间隔
+const DefaultCollectInterval = time.Hour
+
+// 采集的数据类型, 对应 Data 的接口
+const (
+	DataMetricUserStat    = "user_stat"
+	DataMetricArcStat     = "arc_stat"
+	DataMetricArcIncStats = "arc_inc_stats"
+	DataMetricArtStat     = "art_stat"
+	DataMetricArtIncStats = "art_inc_stats"
+)
+
+// DataTarget 采集目标, 一个授权用户及其需要采集的数据
+type DataTarget struct {
+	// AccessToken 用户的 access_token, 推荐使用 OpenIDToken 以便自动刷新
+	AccessToken string
+
+	// Key 写入快照的标识, 为空时使用 OpenIDToken 中的 openid
+	Key string
+
+	UserStat    bool     // 采集 UserStat
+	ArcIncStats bool     // 采集 ArcIncStats
+	ArtIncStats bool     // 采集 ArtIncStats
+	ArcIDs      []string // 采集 ArcStat 的稿件 resource_id
+	ArtIDs      []string // 采集 ArtStat 的文章 id
+}
+
+func (t DataTarget) key() string {
+	if t.Key != "" {
+		return t.Key
+	}
+
+	openid, _ := ParseOpenIDToken(t.AccessToken)
+	return openid
+}
+
+// DataSnapshot 一次采集的数据
+type DataSnapshot struct {
+	Time       time.Time        `json:"time"`
+	Key        string           `json:"key"`
+	Metric     string           `json:"metric"`                // DataMetricUserStat 等
+	ResourceID string           `json:"resource_id,omitempty"` // ArcStat / ArtStat 的资源 id
+	Values     map[string]int64 `json:"values"`                // 数值字段, 字段名同接口返回
+}
+
+// DataSink 快照的写入目标
+type DataSink interface {
+	Write(snapshots []DataSnapshot) error
+}
+
+// DataSinkFunc 函数形式的 DataSink
+type DataSinkFunc func(snapshots []DataSnapshot) error
+
+func (f DataSinkFunc) Write(snapshots []DataSnapshot) error {
+	return f(snapshots)
+}
+
+// DataCollector 定时采集授权用户的数据, 写入 DataSink
+// 单个接口失败时记录日志并跳过, 不影响其他数据
+type DataCollector struct {
+	data     *Data
+	sink     DataSink
+	logger   *slog.Logger
+	interval time.Duration
+
+	mu      sync.Mutex
+	targets map[string]DataTarget
+}
+
+// NewCollector 创建数据采集器, logger 为空时使用 basic.DefaultLoggerGenerator
+func (d *Data) NewCollector(sink DataSink, logger *slog.Logger) *DataCollector {
+	if logger == nil {
+		logger = basic.DefaultLoggerGenerator()
+	}
+
+	return &DataCollector{
+		data:     d,
+		sink:     sink,
+		logger:   logger,
+		interval: DefaultCollectInterval,
+		targets:  map[string]DataTarget{},
+	}
+}
+
+// WithInterval 设置采集间隔, 小于等于0时使用 DefaultCollectInterval
+func (c *DataCollector) WithInterval(interval time.Duration) *DataCollector {
+	if interval <= 0 {
+		interval = DefaultCollectInterval
+	}
+
+	c.interval = interval
+	return c
+}
+
+// AddTarget 添加或替换采集目标, 按 Key 区分
+func (c *DataCollector) AddTarget(target DataTarget) error {
+	key := target.key()
+	if key == "" {
+		return errors.New("target key is empty")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.targets[key] = target
+	return nil
+}
+
+// RemoveTarget 移除采集目标
+func (c *DataCollector) RemoveTarget(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.targets, key)
+}
+
+func (c *DataCollector) snapshotTargets() []DataTarget {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	targets := make([]DataTarget, 0, len(c.targets))
+	for _, target := range c.targets {
+		targets = append(targets, target)
+	}
+
+	return targets
+}
+
+// Run 立即采集一次, 之后按照间隔采集, 直到 ctx 结束
+func (c *DataCollector) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.Collect(ctx); err != nil {
+			c.logger.Error("data collector write fail", slog.String("err", err.Error()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Collect 采集所有目标一次并写入 sink, 只返回写入的错误
+func (c *DataCollector) Collect(ctx context.Context) error {
+	var snapshots []DataSnapshot
+	for _, target := range c.snapshotTargets() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		snapshots = append(snapshots, c.collectTarget(ctx, target)...)
+	}
+
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	return errors.WithMessage(c.sink.Write(snapshots), "write snapshots fail")
+}
+
+func (c *DataCollector) collectTarget(ctx context.Context, target DataTarget) []DataSnapshot {
+	now := time.Now()
+	key := target.key()
+
+	var snapshots []DataSnapshot
+	add := func(metric, resourceID string, resp interface{}, err error) {
+		if err != nil {
+			c.logger.Warn("data collector request fail",
+				slog.String("key", key), slog.String("metric", metric), slog.String("resource_id", resourceID), slog.String("err", err.Error()))
+			return
+		}
+
+		values, skipped, err := numericValues(resp)
+		if err != nil {
+			c.logger.Warn("data collector decode fail", slog.String("key", key), slog.String("metric", metric), slog.String("err", err.Error()))
+			return
+		}
+
+		if len(skipped) > 0 {
+			c.logger.Debug("data collector skip non-integer fields",
+				slog.String("key", key), slog.String("metric", metric), slog.Any("fields", skipped))
+		}
+
+		snapshots = append(snapshots, DataSnapshot{Time: now, Key: key, Metric: metric, ResourceID: resourceID, Values: values})
+	}
+
+	if target.UserStat {
+		resp, err := c.data.UserStatCtx(ctx, target.AccessToken)
+		add(DataMetricUserStat, "", resp, err)
+	}
+
+	if target.ArcIncStats {
+		resp, err := c.data.ArcIncStatsCtx(ctx, target.AccessToken)
+		add(DataMetricArcIncStats, "", resp, err)
+	}
+
+	if target.ArtIncStats {
+		resp, err := c.data.ArtIncStatsCtx(ctx, target.AccessToken)
+		add(DataMetricArtIncStats, "", resp, err)
+	}
+
+	for _, id := range target.ArcIDs {
+		resp, err := c.data.ArcStatCtx(ctx, target.AccessToken, id)
+		add(DataMetricArcStat, id, resp, err)
+	}
+
+	if len(target.ArtIDs) > 0 {
+		resp, err := c.data.ArtStatCtx(ctx, target.AccessToken, target.ArtIDs)
+		if err != nil {
+			add(DataMetricArtStat, "", nil, err)
+		} else {
+			for id, art := range *resp {
+				add(DataMetricArtStat, id, art.Stats, nil)
+			}
+		}
+	}
+
+	return snapshots
+}
+
+// numericValues 提取 resp 中的整数字段, skipped 为跳过的非整数字段(按名称排序)
+func numericValues(resp interface{}) (values map[string]int64, skipped []string, err error) {
+	raw, err := json.Marshal(resp)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "json marshal fail")
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err = json.Unmarshal(raw, &fields); err != nil {
+		return nil, nil, errors.Wrapf(err, "json unmarshal fail, data:%s", raw)
+	}
+
+	values = make(map[string]int64, len(fields))
+	for name, field := range fields {
+		var v int64
+		if json.Unmarshal(field, &v) != nil {
+			skipped = append(skipped, name)
+			continue
+		}
+		values[name] = v
+	}
+	sort.Strings(skipped)
+
+	return values, skipped, nil
+}
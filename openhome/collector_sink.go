@@ -0,0 +1,117 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package openhome
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// csvHeader CSVSink 的表头, 每个数值字段一行
+var csvHeader = []string{"time", "key", "metric", "resource_id", "field", "value"}
+
+// CSVSink 以 CSV 格式写入快照
+// 每个数值字段写一行, 便于导入表格或时序数据库
+type CSVSink struct {
+	mu         sync.Mutex
+	w          *csv.Writer
+	withHeader bool
+	wroteHead  bool
+}
+
+// NewCSVSink 创建 CSVSink, 第一次写入时输出表头
+func NewCSVSink(w io.Writer) *CSVSink {
+	return &CSVSink{
+		w:          csv.NewWriter(w),
+		withHeader: true,
+	}
+}
+
+// WithoutHeader 不输出表头, 例如追加到已有文件时
+func (s *CSVSink) WithoutHeader() *CSVSink {
+	s.withHeader = false
+	return s
+}
+
+func (s *CSVSink) Write(snapshots []DataSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.withHeader && !s.wroteHead {
+		if err := s.w.Write(csvHeader); err != nil {
+			return errors.Wrap(err, "write csv header fail")
+		}
+		s.wroteHead = true
+	}
+
+	for _, snapshot := range snapshots {
+		fields := make([]string, 0, len(snapshot.Values))
+		for field := range snapshot.Values {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		ts := snapshot.Time.Format(time.RFC3339)
+		for _, field := range fields {
+			record := []string{ts, snapshot.Key, snapshot.Metric, snapshot.ResourceID, field, strconv.FormatInt(snapshot.Values[field], 10)}
+			if err := s.w.Write(record); err != nil {
+				return errors.Wrap(err, "write csv record fail")
+			}
+		}
+	}
+
+	s.w.Flush()
+	return errors.Wrap(s.w.Error(), "flush csv fail")
+}
+
+// JSONLSink 以 JSON Lines 格式写入快照, 每个快照一行
+type JSONLSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONLSink 创建 JSONLSink
+func NewJSONLSink(w io.Writer) *JSONLSink {
+	return &JSONLSink{enc: json.NewEncoder(w)}
+}
+
+func (s *JSONLSink) Write(snapshots []DataSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, snapshot := range snapshots {
+		if err := s.enc.Encode(snapshot); err != nil {
+			return errors.Wrap(err, "write json line fail")
+		}
+	}
+
+	return nil
+}
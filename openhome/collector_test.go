@@ -0,0 +1,222 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package openhome
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newDataServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/arcopen/fn/data/user/stat", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":0,"message":"0","data":{"following":1,"follower":100,"arc_passed_total":3}}`))
+	})
+	mux.HandleFunc("/arcopen/fn/data/arc/stat", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("resource_id") == "BVbad" {
+			_, _ = w.Write([]byte(`{"code":-404,"message":"稿件不存在"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":0,"message":"0","data":{"view":10,"like":2}}`))
+	})
+	mux.HandleFunc("/arcopen/fn/data/art/stat", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":0,"message":"0","data":{"7":{"id":7,"title":"t","stats":{"view":5,"like":1}}}}`))
+	})
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("access_token") != "token" {
+			t.Errorf("unexpected access token %s", r.URL.Query().Get("access_token"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, r)
+	}))
+}
+
+func TestDataCollector_Collect(t *testing.T) {
+	srv := newDataServer(t)
+	defer srv.Close()
+
+	app := NewAppClient(&AppConfig{ClientID: "cid", MemberHost: srv.URL})
+
+	var snapshots []DataSnapshot
+	collector := app.Data.NewCollector(DataSinkFunc(func(s []DataSnapshot) error {
+		snapshots = append(snapshots, s...)
+		return nil
+	}), nil)
+
+	if err := collector.AddTarget(DataTarget{AccessToken: "token"}); err == nil {
+		t.Fatal("target without key should be rejected")
+	}
+
+	err := collector.AddTarget(DataTarget{
+		AccessToken: "token",
+		Key:         "oid",
+		UserStat:    true,
+		ArcIDs:      []string{"BV1", "BVbad"},
+		ArtIDs:      []string{"7"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = collector.Collect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// 失败的稿件被跳过
+	if len(snapshots) != 3 {
+		t.Fatalf("unexpected snapshots %+v", snapshots)
+	}
+
+	got := map[string]DataSnapshot{}
+	for _, s := range snapshots {
+		if s.Key != "oid" {
+			t.Fatalf("unexpected key %s", s.Key)
+		}
+		got[s.Metric+s.ResourceID] = s
+	}
+
+	if got[DataMetricUserStat].Values["follower"] != 100 || got[DataMetricArcStat+"BV1"].Values["view"] != 10 || got[DataMetricArtStat+"7"].Values["view"] != 5 {
+		t.Fatalf("unexpected values %+v", got)
+	}
+}
+
+func TestDataCollector_Run(t *testing.T) {
+	srv := newDataServer(t)
+	defer srv.Close()
+
+	app := NewAppClient(&AppConfig{ClientID: "cid", MemberHost: srv.URL})
+
+	rounds := make(chan int, 10)
+	collector := app.Data.NewCollector(DataSinkFunc(func(s []DataSnapshot) error {
+		rounds <- len(s)
+		return nil
+	}), nil).WithInterval(time.Millisecond * 10)
+
+	_ = collector.AddTarget(DataTarget{AccessToken: OpenIDToken("oid"), UserStat: true})
+	collector.RemoveTarget("oid")
+	_ = collector.AddTarget(DataTarget{AccessToken: "token", Key: "oid", UserStat: true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- collector.Run(ctx)
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case n := <-rounds:
+			if n != 1 {
+				t.Fatalf("unexpected snapshots %d", n)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("collector should run periodically")
+		}
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("unexpected err %v", err)
+	}
+}
+
+func TestDataCollector_WithInterval(t *testing.T) {
+	app := NewAppClient(&AppConfig{ClientID: "cid"})
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if c := app.Data.NewCollector(nil, nil).WithInterval(interval); c.interval != DefaultCollectInterval {
+			t.Fatalf("non-positive interval %s should fall back to default, got %s", interval, c.interval)
+		}
+	}
+}
+
+func TestNumericValues(t *testing.T) {
+	values, skipped, err := numericValues(map[string]interface{}{"view": 10, "rate": 0.5, "title": "t", "like": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(values) != 2 || values["view"] != 10 || values["like"] != 3 {
+		t.Fatalf("unexpected values %v", values)
+	}
+	if len(skipped) != 2 || skipped[0] != "rate" || skipped[1] != "title" {
+		t.Fatalf("unexpected skipped fields %v", skipped)
+	}
+}
+
+func TestSinks(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	snapshots := []DataSnapshot{
+		{Time: ts, Key: "oid", Metric: DataMetricUserStat, Values: map[string]int64{"follower": 100, "following": 1}},
+		{Time: ts, Key: "oid", Metric: DataMetricArcStat, ResourceID: "BV1", Values: map[string]int64{"view": 10}},
+	}
+
+	buf := &bytes.Buffer{}
+	sink := NewCSVSink(buf)
+	if err := sink.Write(snapshots[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Write(snapshots[1:]); err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.Join([]string{
+		"time,key,metric,resource_id,field,value",
+		"2024-01-02T03:04:05Z,oid,user_stat,,follower,100",
+		"2024-01-02T03:04:05Z,oid,user_stat,,following,1",
+		"2024-01-02T03:04:05Z,oid,arc_stat,BV1,view,10",
+	}, "\n") + "\n"
+	if buf.String() != want {
+		t.Fatalf("unexpected csv:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := NewJSONLSink(buf).Write(snapshots); err != nil {
+		t.Fatal(err)
+	}
+
+	scanner := bufio.NewScanner(buf)
+	lines := 0
+	for scanner.Scan() {
+		s := DataSnapshot{}
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			t.Fatal(err)
+		}
+		if !s.Time.Equal(ts) || s.Values == nil {
+			t.Fatalf("unexpected snapshot %+v", s)
+		}
+		lines++
+	}
+
+	if lines != 2 {
+		t.Fatalf("unexpected lines %d", lines)
+	}
+}
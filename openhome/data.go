@@ -24,10 +24,10 @@
 package openhome
 
 import (
+	"context"
 	"strings"
 
 	"github.com/go-resty/resty/v2"
-	"github.com/pkg/errors"
 )
 
 type Data basicService
@@ -39,21 +39,20 @@ type UserStatResp struct {
 }
 
 func (d *Data) UserStat(accessToken string) (*UserStatResp, error) {
+	return d.UserStatCtx(context.Background(), accessToken)
+}
+
+// UserStatCtx 同 UserStat, 支持传入 context
+func (d *Data) UserStatCtx(ctx context.Context, accessToken string) (*UserStatResp, error) {
 	result := NewBaseResp(&UserStatResp{})
 
-	resp, err := resty.New().R().
-		SetResult(result).
+	r := d.app.newRequest(ctx).
 		SetQueryParams(map[string]string{
 			"client_id":    d.app.appCfg.ClientID,
 			"access_token": accessToken,
-		}).
-		Get(`https://member.bilibili.com/arcopen/fn/data/user/stat`)
+		})
 
-	if err != nil {
-		return nil, errors.Wrapf(err, "do request fail")
-	}
-
-	if err = checkResp(resp, result); err != nil {
+	if err := d.app.execute(r, resty.MethodGet, d.app.memberURL("/arcopen/fn/data/user/stat"), result, withScopes(ScopesUserdata)); err != nil {
 		return nil, err
 	}
 
@@ -71,22 +70,21 @@ type ArcStatResp struct {
 }
 
 func (d *Data) ArcStat(accessToken, resourceID string) (*ArcStatResp, error) {
+	return d.ArcStatCtx(context.Background(), accessToken, resourceID)
+}
+
+// ArcStatCtx 同 ArcStat, 支持传入 context
+func (d *Data) ArcStatCtx(ctx context.Context, accessToken, resourceID string) (*ArcStatResp, error) {
 	result := NewBaseResp(&ArcStatResp{})
 
-	resp, err := resty.New().R().
-		SetResult(result).
+	r := d.app.newRequest(ctx).
 		SetQueryParams(map[string]string{
 			"client_id":    d.app.appCfg.ClientID,
 			"access_token": accessToken,
 			"resource_id":  resourceID,
-		}).
-		Get(`https://member.bilibili.com/arcopen/fn/data/arc/stat`)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "do request fail")
-	}
+		})
 
-	if err = checkResp(resp, result); err != nil {
+	if err := d.app.execute(r, resty.MethodGet, d.app.memberURL("/arcopen/fn/data/arc/stat"), result, withScopes(ScopesArcData)); err != nil {
 		return nil, err
 	}
 
@@ -105,21 +103,20 @@ type ArcIncStatsResp struct {
 }
 
 func (d *Data) ArcIncStats(accessToken string) (*ArcIncStatsResp, error) {
+	return d.ArcIncStatsCtx(context.Background(), accessToken)
+}
+
+// ArcIncStatsCtx 同 ArcIncStats, 支持传入 context
+func (d *Data) ArcIncStatsCtx(ctx context.Context, accessToken string) (*ArcIncStatsResp, error) {
 	result := NewBaseResp(&ArcIncStatsResp{})
 
-	resp, err := resty.New().R().
-		SetResult(result).
+	r := d.app.newRequest(ctx).
 		SetQueryParams(map[string]string{
 			"client_id":    d.app.appCfg.ClientID,
 			"access_token": accessToken,
-		}).
-		Get(`https://member.bilibili.com/arcopen/fn/data/arc/inc-stats`)
+		})
 
-	if err != nil {
-		return nil, errors.Wrapf(err, "do request fail")
-	}
-
-	if err = checkResp(resp, result); err != nil {
+	if err := d.app.execute(r, resty.MethodGet, d.app.memberURL("/arcopen/fn/data/arc/inc-stats"), result, withScopes(ScopesArcData)); err != nil {
 		return nil, err
 	}
 
@@ -168,10 +165,14 @@ type ArtStartData struct {
 type ArtStatResp map[string]ArtStartData
 
 func (d *Data) ArtStat(accessToken string, ids []string) (*ArtStatResp, error) {
+	return d.ArtStatCtx(context.Background(), accessToken, ids)
+}
+
+// ArtStatCtx 同 ArtStat, 支持传入 context
+func (d *Data) ArtStatCtx(ctx context.Context, accessToken string, ids []string) (*ArtStatResp, error) {
 	result := NewBaseResp(&ArtStatResp{})
 
-	resp, err := resty.New().R().
-		SetResult(result).
+	r := d.app.newRequest(ctx).
 		SetHeader("x1-bilispy-color", "article-open").
 		SetQueryParams(map[string]string{
 			"client_id":    d.app.appCfg.ClientID,
@@ -179,14 +180,9 @@ func (d *Data) ArtStat(accessToken string, ids []string) (*ArtStatResp, error) {
 		}).
 		SetFormData(map[string]string{
 			"ids": strings.Join(ids, ","),
-		}).
-		Get(`https://member.bilibili.com/arcopen/fn/data/art/stat`)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "do request fail")
-	}
+		})
 
-	if err = checkResp(resp, result); err != nil {
+	if err := d.app.execute(r, resty.MethodGet, d.app.memberURL("/arcopen/fn/data/art/stat"), result, withScopes(ScopesAtcData)); err != nil {
 		return nil, err
 	}
 
@@ -203,22 +199,21 @@ type ArtIncStatsResp struct {
 }
 
 func (d *Data) ArtIncStats(accessToken string) (*ArtIncStatsResp, error) {
+	return d.ArtIncStatsCtx(context.Background(), accessToken)
+}
+
+// ArtIncStatsCtx 同 ArtIncStats, 支持传入 context
+func (d *Data) ArtIncStatsCtx(ctx context.Context, accessToken string) (*ArtIncStatsResp, error) {
 	result := NewBaseResp(&ArtIncStatsResp{})
 
-	resp, err := resty.New().R().
-		SetResult(result).
+	r := d.app.newRequest(ctx).
 		SetHeader("x1-bilispy-color", "article-open").
 		SetQueryParams(map[string]string{
 			"client_id":    d.app.appCfg.ClientID,
 			"access_token": accessToken,
-		}).
-		Get(`https://member.bilibili.com/arcopen/fn/data/art/inc-stats`)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "do request fail")
-	}
+		})
 
-	if err = checkResp(resp, result); err != nil {
+	if err := d.app.execute(r, resty.MethodGet, d.app.memberURL("/arcopen/fn/data/art/inc-stats"), result, withScopes(ScopesAtcData)); err != nil {
 		return nil, err
 	}
 
@@ -24,8 +24,9 @@
 package openhome
 
 import (
+	"context"
+
 	"github.com/go-resty/resty/v2"
-	"github.com/pkg/errors"
 )
 
 type Live basicService
@@ -43,21 +44,20 @@ func (ri RoomInfoResp) IsNotEnable() bool {
 }
 
 func (l *Live) GetRoomInfo(accessToken string) (*RoomInfoResp, error) {
+	return l.GetRoomInfoCtx(context.Background(), accessToken)
+}
+
+// GetRoomInfoCtx 同 GetRoomInfo, 支持传入 context
+func (l *Live) GetRoomInfoCtx(ctx context.Context, accessToken string) (*RoomInfoResp, error) {
 	result := NewBaseResp(&RoomInfoResp{})
 
-	resp, err := resty.New().R().
-		SetResult(result).
+	r := l.app.newRequest(ctx).
 		SetQueryParams(map[string]string{
 			"client_id":    l.app.appCfg.ClientID,
 			"access_token": accessToken,
-		}).
-		Get(`https://member.bilibili.com/arcopen/fn/live/room/info`)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "do request fail")
-	}
+		})
 
-	if err = checkResp(resp, result); err != nil {
+	if err := l.app.execute(r, resty.MethodGet, l.app.memberURL("/arcopen/fn/live/room/info"), result, withScopes(ScopesLiveRoomData)); err != nil {
 		return nil, err
 	}
 
@@ -81,21 +81,20 @@ func (wr *WsStartResp) GetLinks() []string {
 }
 
 func (l *Live) WsStart(accessToken string) (*WsStartResp, error) {
+	return l.WsStartCtx(context.Background(), accessToken)
+}
+
+// WsStartCtx 同 WsStart, 支持传入 context
+func (l *Live) WsStartCtx(ctx context.Context, accessToken string) (*WsStartResp, error) {
 	result := NewBaseResp(&WsStartResp{})
 
-	resp, err := resty.New().R().
-		SetResult(result).
+	r := l.app.newRequest(ctx).
 		SetQueryParams(map[string]string{
 			"client_id":    l.app.appCfg.ClientID,
 			"access_token": accessToken,
-		}).
-		Post(`https://member.bilibili.com/arcopen/fn/live/room/ws-start`)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "do request fail")
-	}
+		})
 
-	if err = checkResp(resp, result); err != nil {
+	if err := l.app.execute(r, resty.MethodPost, l.app.memberURL("/arcopen/fn/live/room/ws-start"), result, withScopes(ScopesLiveRoomData)); err != nil {
 		return nil, err
 	}
 
@@ -103,10 +102,14 @@ func (l *Live) WsStart(accessToken string) (*WsStartResp, error) {
 }
 
 func (l *Live) WsHeartbeat(accessToken, connID string) error {
+	return l.WsHeartbeatCtx(context.Background(), accessToken, connID)
+}
+
+// WsHeartbeatCtx 同 WsHeartbeat, 支持传入 context
+func (l *Live) WsHeartbeatCtx(ctx context.Context, accessToken, connID string) error {
 	result := NewBaseResp(&WsStartResp{})
 
-	resp, err := resty.New().R().
-		SetResult(result).
+	r := l.app.newRequest(ctx).
 		SetHeader("Content-Type", "application/json").
 		SetQueryParams(map[string]string{
 			"client_id":    l.app.appCfg.ClientID,
@@ -114,14 +117,9 @@ func (l *Live) WsHeartbeat(accessToken, connID string) error {
 		}).
 		SetBody(map[string]string{
 			"conn_id": connID,
-		}).
-		Post(`https://member.bilibili.com/arcopen/fn/live/room/ws-heartbeat`)
-
-	if err != nil {
-		return errors.Wrapf(err, "do request fail")
-	}
+		})
 
-	if err = checkResp(resp, result); err != nil {
+	if err := l.app.execute(r, resty.MethodPost, l.app.memberURL("/arcopen/fn/live/room/ws-heartbeat"), result, withScopes(ScopesLiveRoomData), withIdempotent()); err != nil {
 		return err
 	}
 
@@ -133,10 +131,14 @@ type WsBatchHeartbeatResp struct {
 }
 
 func (l *Live) WsBatchHeartbeat(accessToken string, connIDs ...string) (*WsBatchHeartbeatResp, error) {
+	return l.WsBatchHeartbeatCtx(context.Background(), accessToken, connIDs...)
+}
+
+// WsBatchHeartbeatCtx 同 WsBatchHeartbeat, 支持传入 context
+func (l *Live) WsBatchHeartbeatCtx(ctx context.Context, accessToken string, connIDs ...string) (*WsBatchHeartbeatResp, error) {
 	result := NewBaseResp(&WsBatchHeartbeatResp{})
 
-	resp, err := resty.New().R().
-		SetResult(result).
+	r := l.app.newRequest(ctx).
 		SetHeader("Content-Type", "application/json").
 		SetQueryParams(map[string]string{
 			"client_id":    l.app.appCfg.ClientID,
@@ -144,14 +146,9 @@ func (l *Live) WsBatchHeartbeat(accessToken string, connIDs ...string) (*WsBatch
 		}).
 		SetBody(map[string]interface{}{
 			"conn_ids": connIDs,
-		}).
-		Post(`https://member.bilibili.com/arcopen/fn/live/room/ws-batch-heartbeat`)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "do request fail")
-	}
+		})
 
-	if err = checkResp(resp, result); err != nil {
+	if err := l.app.execute(r, resty.MethodPost, l.app.memberURL("/arcopen/fn/live/room/ws-batch-heartbeat"), result, withScopes(ScopesLiveRoomData), withIdempotent()); err != nil {
 		return nil, err
 	}
 
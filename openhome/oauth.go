@@ -24,12 +24,12 @@
 package openhome
 
 import (
+	"context"
 	"net/url"
 	"strconv"
 	"time"
 
 	"github.com/go-resty/resty/v2"
-	"github.com/pkg/errors"
 )
 
 const (
@@ -47,6 +47,7 @@ const (
 )
 
 type OAuthGenerator struct {
+	accountHost string // 授权页面地址
 	clientID    string // 应用id
 	mobileUI    bool   // 移动端UI 默认pc
 	callbackURL string // 回调地址
@@ -135,9 +136,9 @@ func (og *OAuthGenerator) GenerateAuthorizationURL() string {
 
 	params := url.Values{}
 
-	basicURL := "https://account.bilibili.com/pc/account-pc/auth/oauth"
+	basicURL := og.accountHost + "/pc/account-pc/auth/oauth"
 	if og.mobileUI {
-		basicURL = "https://account.bilibili.com/h5/account-h5/auth/oauth"
+		basicURL = og.accountHost + "/h5/account-h5/auth/oauth"
 		params.Add("navhide", og.getNavHide())
 		params.Add("callback", og.getCallbackType())
 	}
@@ -156,7 +157,8 @@ type OAuth basicService
 
 func (o *OAuth) GetOAuthGenerator() *OAuthGenerator {
 	return &OAuthGenerator{
-		clientID: o.app.appCfg.ClientID,
+		accountHost: o.app.appCfg.AccountHost,
+		clientID:    o.app.appCfg.ClientID,
 	}
 }
 
@@ -166,6 +168,11 @@ type AccessToken struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
+// ExpiresAt 过期时间, ExpiresIn 为秒级时间戳
+func (at AccessToken) ExpiresAt() time.Time {
+	return time.Unix(int64(at.ExpiresIn), 0)
+}
+
 func (at AccessToken) IsExpired() bool {
 	return int64(at.ExpiresIn) <= time.Now().Unix()
 }
@@ -176,28 +183,33 @@ type Code2AccessTokenResp struct {
 }
 
 func (o *OAuth) Code2AccessToken(code string) (*Code2AccessTokenResp, error) {
+	return o.Code2AccessTokenCtx(context.Background(), code)
+}
+
+// Code2AccessTokenCtx 同 Code2AccessToken, 支持传入 context
+func (o *OAuth) Code2AccessTokenCtx(ctx context.Context, code string) (*Code2AccessTokenResp, error) {
 	result := NewBaseResp(&Code2AccessTokenResp{})
 
-	resp, err := resty.New().R().
-		SetResult(result).
+	r := o.app.newRequest(ctx).
 		SetHeader("Content-Type", "application/x-www-form-urlencoded").
 		SetFormData(map[string]string{
 			"client_id":     o.app.appCfg.ClientID,
 			"client_secret": o.app.appCfg.ClientSecret,
 			"grant_type":    "authorization_code",
 			"code":          code,
-		}).
-		Post(`https://api.bilibili.com/x/account-oauth2/v1/token`)
+		})
 
-	if err != nil {
-		return nil, errors.Wrapf(err, "do request fail")
+	if err := o.app.execute(r, resty.MethodPost, o.app.apiURL("/x/account-oauth2/v1/token"), result); err != nil {
+		return nil, err
 	}
 
-	if err = checkResp(resp, result); err != nil {
-		return nil, err
+	resp := result.Data.(*Code2AccessTokenResp)
+	if o.app.appCfg.CheckScopes {
+		// 授权时返回的权限可以直接用于检查, 不需要再查询
+		o.app.scopes.set(resp.AccessToken.AccessToken, resp.Scopes, o.app.appCfg.scopeCacheTTL())
 	}
 
-	return result.Data.(*Code2AccessTokenResp), nil
+	return resp, nil
 }
 
 type RefreshTokenResp struct {
@@ -205,24 +217,23 @@ type RefreshTokenResp struct {
 }
 
 func (o *OAuth) RefreshToken(refreshToken string) (*RefreshTokenResp, error) {
-	result := NewBaseResp(&Code2AccessTokenResp{})
+	return o.RefreshTokenCtx(context.Background(), refreshToken)
+}
+
+// RefreshTokenCtx 同 RefreshToken, 支持传入 context
+func (o *OAuth) RefreshTokenCtx(ctx context.Context, refreshToken string) (*RefreshTokenResp, error) {
+	result := NewBaseResp(&RefreshTokenResp{})
 
-	resp, err := resty.New().R().
-		SetResult(result).
+	r := o.app.newRequest(ctx).
 		SetHeader("Content-Type", "application/x-www-form-urlencoded").
 		SetFormData(map[string]string{
 			"client_id":     o.app.appCfg.ClientID,
 			"client_secret": o.app.appCfg.ClientSecret,
 			"grant_type":    "refresh_token",
 			"refresh_token": refreshToken,
-		}).
-		Post(`https://api.bilibili.com/x/account-oauth2/v1/refresh_token`)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "do request fail")
-	}
+		})
 
-	if err = checkResp(resp, result); err != nil {
+	if err := o.app.execute(r, resty.MethodPost, o.app.apiURL("/x/account-oauth2/v1/refresh_token"), result); err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,348 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package openhome
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vtb-link/bianka/basic"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	DefaultOAuthStateTTL       = time.Minute * 10               // state 默认有效期
+	DefaultOAuthStateKeyPrefix = "bianka:openhome:oauth_state:" // state 默认的 key 前缀
+	DefaultOAuthStateCookie    = "bianka_oauth_state"           // state 默认的 cookie 名称
+)
+
+// ErrOAuthStateInvalid state 不存在, 已使用或已过期
+var ErrOAuthStateInvalid = errors.New("oauth state invalid")
+
+// OAuthSuccessFunc 授权成功回调, token 已经保存到 AppClient.Tokens
+type OAuthSuccessFunc func(w http.ResponseWriter, r *http.Request, openid string, scopes []string)
+
+// OAuthErrorFunc 授权失败回调
+type OAuthErrorFunc func(w http.ResponseWriter, r *http.Request, err error)
+
+// OAuthHandler 授权流程的 http 处理
+// LoginHandler 生成 state 写入 HttpOnly cookie 并跳转到授权页面
+// CallbackHandler 校验 state 与发起登录的浏览器一致后换取 token 并保存
+type OAuthHandler struct {
+	oauth       *OAuth
+	callbackURL string
+
+	storage    basic.Storage
+	keyPrefix  string
+	stateTTL   time.Duration
+	cookieName string
+	generator  func(og *OAuthGenerator) *OAuthGenerator
+
+	onSuccess OAuthSuccessFunc
+	onError   OAuthErrorFunc
+	logger    *slog.Logger
+
+	mu      sync.Mutex
+	pending map[string]int64 // 本实例生成且未使用的 state 及其过期时间, 用于清理未完成的授权
+}
+
+type oauthState struct {
+	ExpiresAt int64 `json:"expires_at"` // 毫秒时间戳
+}
+
+// NewHandler 创建授权流程的 http 处理, callbackURL 为 CallbackHandler 的访问地址
+// state 默认与 token 使用同一个 storage
+func (o *OAuth) NewHandler(callbackURL string) *OAuthHandler {
+	h := &OAuthHandler{
+		oauth:       o,
+		callbackURL: callbackURL,
+		storage:     o.app.Tokens.storage,
+		keyPrefix:   DefaultOAuthStateKeyPrefix,
+		stateTTL:    DefaultOAuthStateTTL,
+		cookieName:  DefaultOAuthStateCookie,
+		pending:     map[string]int64{},
+		onSuccess: func(w http.ResponseWriter, r *http.Request, openid string, scopes []string) {
+			_, _ = w.Write([]byte("授权成功"))
+		},
+		logger: basic.DefaultLoggerGenerator(),
+	}
+	h.onError = h.defaultOnError
+
+	return h
+}
+
+// defaultOnError 默认的授权失败处理, 内部错误只记录日志, 不把详情返回给浏览器
+func (h *OAuthHandler) defaultOnError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrOAuthStateInvalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.logger.Error("oauth handler fail", slog.String("path", r.URL.Path), slog.String("err", err.Error()))
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+// WithStorage 设置 state 的存储
+// basic.Storage 不支持过期, 过期时间记录在值中, 校验时判断, 过期未使用的 state 在之后登录时删除
+func (h *OAuthHandler) WithStorage(storage basic.Storage) *OAuthHandler {
+	h.storage = storage
+	return h
+}
+
+// WithKeyPrefix 设置 state 的 key 前缀
+func (h *OAuthHandler) WithKeyPrefix(prefix string) *OAuthHandler {
+	h.keyPrefix = prefix
+	return h
+}
+
+// WithStateTTL 设置 state 的有效期
+func (h *OAuthHandler) WithStateTTL(ttl time.Duration) *OAuthHandler {
+	h.stateTTL = ttl
+	return h
+}
+
+// WithCookieName 设置保存 state 的 cookie 名称
+func (h *OAuthHandler) WithCookieName(name string) *OAuthHandler {
+	h.cookieName = name
+	return h
+}
+
+// WithGenerator 自定义授权页面参数, 例如 WithEnableMobileUI
+// state 与 callbackURL 由 OAuthHandler 设置
+func (h *OAuthHandler) WithGenerator(fn func(og *OAuthGenerator) *OAuthGenerator) *OAuthHandler {
+	h.generator = fn
+	return h
+}
+
+// WithOnSuccess 设置授权成功回调, 默认返回 "授权成功"
+func (h *OAuthHandler) WithOnSuccess(fn OAuthSuccessFunc) *OAuthHandler {
+	h.onSuccess = fn
+	return h
+}
+
+// WithLogger 设置默认授权失败处理使用的 logger
+func (h *OAuthHandler) WithLogger(logger *slog.Logger) *OAuthHandler {
+	h.logger = logger
+	return h
+}
+
+// WithOnError 设置授权失败回调, 默认 state 无效时返回 400, 其他错误返回 500
+func (h *OAuthHandler) WithOnError(fn OAuthErrorFunc) *OAuthHandler {
+	h.onError = fn
+	return h
+}
+
+// LoginHandler 跳转到授权页面
+func (h *OAuthHandler) LoginHandler() http.Handler {
+	return http.HandlerFunc(h.login)
+}
+
+// CallbackHandler 授权回调
+func (h *OAuthHandler) CallbackHandler() http.Handler {
+	return http.HandlerFunc(h.callback)
+}
+
+func (h *OAuthHandler) login(w http.ResponseWriter, r *http.Request) {
+	state, err := h.newState()
+	if err != nil {
+		h.onError(w, r, err)
+		return
+	}
+
+	og := h.oauth.GetOAuthGenerator()
+	if h.generator != nil {
+		og = h.generator(og)
+	}
+
+	// 回调由授权页面跳转而来, 需要 SameSite=Lax 才会携带 cookie
+	http.SetCookie(w, &http.Cookie{
+		Name:     h.cookieName,
+		Value:    state,
+		Path:     "/",
+		MaxAge:   int(h.stateTTL / time.Second),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.callbackURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	authURL := og.WithCallbackURL(h.callbackURL).WithState(state).GenerateAuthorizationURL()
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (h *OAuthHandler) callback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	state := query.Get("state")
+
+	// 无论结果如何都清除 cookie, state 只能使用一次
+	http.SetCookie(w, &http.Cookie{
+		Name:     h.cookieName,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	if err := h.checkCookie(r, state); err != nil {
+		h.onError(w, r, err)
+		return
+	}
+
+	if err := h.verifyState(state); err != nil {
+		h.onError(w, r, err)
+		return
+	}
+
+	code := query.Get("code")
+	if code == "" {
+		h.onError(w, r, errors.New("code is empty"))
+		return
+	}
+
+	token, err := h.oauth.app.Tokens.Exchange(r.Context(), code)
+	if err != nil {
+		h.onError(w, r, err)
+		return
+	}
+
+	h.onSuccess(w, r, token.OpenID, token.Scopes)
+}
+
+// checkCookie 校验 state 与发起登录时写入 cookie 的一致, 防止 login CSRF
+func (h *OAuthHandler) checkCookie(r *http.Request, state string) error {
+	cookie, err := r.Cookie(h.cookieName)
+	if err != nil || cookie.Value == "" {
+		return errors.Wrap(ErrOAuthStateInvalid, "state cookie not found")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		return errors.Wrap(ErrOAuthStateInvalid, "state does not match cookie")
+	}
+
+	return nil
+}
+
+// newState 生成随机 state 并保存
+func (h *OAuthHandler) newState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "generate state fail")
+	}
+	state := hex.EncodeToString(b)
+
+	val, err := json.Marshal(oauthState{ExpiresAt: time.Now().Add(h.stateTTL).UnixMilli()})
+	if err != nil {
+		return "", errors.Wrap(err, "json marshal fail")
+	}
+
+	h.cleanExpired()
+
+	if err = h.storage.Set(h.keyPrefix+state, val); err != nil {
+		return "", errors.Wrap(err, "save state fail")
+	}
+
+	h.mu.Lock()
+	h.pending[state] = time.Now().Add(h.stateTTL).UnixMilli()
+	h.mu.Unlock()
+
+	return state, nil
+}
+
+// cleanExpired 删除过期且未使用的 state, 例如用户没有完成授权
+func (h *OAuthHandler) cleanExpired() {
+	now := time.Now().UnixMilli()
+
+	h.mu.Lock()
+	var expired []string
+	for state, expiresAt := range h.pending {
+		if expiresAt <= now {
+			expired = append(expired, state)
+			delete(h.pending, state)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, state := range expired {
+		_ = h.storage.Del(h.keyPrefix + state)
+	}
+}
+
+// verifyState 校验 state, 每个 state 只能使用一次
+func (h *OAuthHandler) verifyState(state string) error {
+	if state == "" {
+		return errors.Wrap(ErrOAuthStateInvalid, "state is empty")
+	}
+
+	val, err := h.takeState(state)
+	if err != nil {
+		return err
+	}
+
+	if len(val) == 0 {
+		return errors.Wrapf(ErrOAuthStateInvalid, "state:%s", state)
+	}
+
+	st := oauthState{}
+	if err = json.Unmarshal(val, &st); err != nil {
+		return errors.Wrapf(err, "json unmarshal fail, data:%s", val)
+	}
+
+	if st.ExpiresAt <= time.Now().UnixMilli() {
+		return errors.Wrapf(ErrOAuthStateInvalid, "state expired, state:%s", state)
+	}
+
+	return nil
+}
+
+// takeState 读取并删除 state
+// Get 和 Del 在 h.mu 中执行, 只能保证单实例内同一个 state 不会被并发使用两次
+// 多实例共享 storage 时需要 storage 自身提供原子的读取并删除 (例如 redis GETDEL)
+func (h *OAuthHandler) takeState(state string) ([]byte, error) {
+	key := h.keyPrefix + state
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.pending, state)
+
+	val, err := h.storage.Get(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "get state fail")
+	}
+
+	if len(val) == 0 {
+		return nil, nil
+	}
+
+	if err = h.storage.Del(key); err != nil {
+		return nil, errors.Wrap(err, "delete state fail")
+	}
+
+	return val, nil
+}
@@ -0,0 +1,212 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package openhome
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vtb-link/bianka/basic"
+	"golang.org/x/exp/slog"
+)
+
+func TestOAuthHandler(t *testing.T) {
+	fs := newFakeOAuthServer(t)
+	defer fs.Close()
+
+	storage := basic.NewMapStorage()
+	app := fs.app(storage)
+
+	var openid string
+	var scopes []string
+	var lastErr error
+	h := app.OAuth.NewHandler("https://example.com/callback").
+		WithGenerator(func(og *OAuthGenerator) *OAuthGenerator {
+			return og.WithEnableMobileUI()
+		}).
+		WithOnSuccess(func(w http.ResponseWriter, r *http.Request, oid string, s []string) {
+			openid, scopes = oid, s
+		}).
+		WithOnError(func(w http.ResponseWriter, r *http.Request, err error) {
+			lastErr = err
+			w.WriteHeader(http.StatusBadRequest)
+		})
+
+	login := func() (string, *http.Cookie) {
+		rec := httptest.NewRecorder()
+		h.LoginHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/login", nil))
+		if rec.Code != http.StatusFound {
+			t.Fatalf("unexpected status %d", rec.Code)
+		}
+
+		u, err := url.Parse(rec.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.Path != "/h5/account-h5/auth/oauth" || u.Query().Get("gourl") != "https://example.com/callback" {
+			t.Fatalf("unexpected location %s", u)
+		}
+
+		cookies := rec.Result().Cookies()
+		if len(cookies) != 1 || !cookies[0].HttpOnly || !cookies[0].Secure || cookies[0].Value != u.Query().Get("state") {
+			t.Fatalf("unexpected cookies %v", cookies)
+		}
+
+		return u.Query().Get("state"), cookies[0]
+	}
+
+	callback := func(state string, cookie *http.Cookie) int {
+		lastErr = nil
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/callback?code=code&state="+state, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		h.CallbackHandler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	state, cookie := login()
+	if len(state) != 32 {
+		t.Fatalf("unexpected state %s", state)
+	}
+
+	// 没有 cookie 或 cookie 不一致时拒绝, 例如攻击者诱导用户打开自己的回调地址
+	if code := callback(state, nil); code != http.StatusBadRequest || !errors.Is(lastErr, ErrOAuthStateInvalid) {
+		t.Fatalf("missing cookie should be rejected, %d %v", code, lastErr)
+	}
+	other, _ := login()
+	if code := callback(other, cookie); code != http.StatusBadRequest || !errors.Is(lastErr, ErrOAuthStateInvalid) {
+		t.Fatalf("mismatched cookie should be rejected, %d %v", code, lastErr)
+	}
+
+	if code := callback(state, cookie); code != http.StatusOK || openid != "oid" || len(scopes) != 1 {
+		t.Fatalf("unexpected result %d, openid %s scopes %v err %v", code, openid, scopes, lastErr)
+	}
+
+	if _, err := app.Tokens.Get("oid"); err != nil {
+		t.Fatal(err)
+	}
+
+	// state 只能使用一次
+	if code := callback(state, cookie); code != http.StatusBadRequest || !errors.Is(lastErr, ErrOAuthStateInvalid) {
+		t.Fatalf("reused state should be rejected, %d %v", code, lastErr)
+	}
+
+	if code := callback("unknown", &http.Cookie{Name: DefaultOAuthStateCookie, Value: "unknown"}); code != http.StatusBadRequest || !errors.Is(lastErr, ErrOAuthStateInvalid) {
+		t.Fatalf("unknown state should be rejected, %d %v", code, lastErr)
+	}
+
+	h.WithStateTTL(time.Millisecond)
+	state, cookie = login()
+	time.Sleep(time.Millisecond * 5)
+	if code := callback(state, cookie); code != http.StatusBadRequest || !errors.Is(lastErr, ErrOAuthStateInvalid) {
+		t.Fatalf("expired state should be rejected, %d %v", code, lastErr)
+	}
+
+	// 未完成授权的 state 过期后在下一次登录时删除
+	abandoned, _ := login()
+	time.Sleep(time.Millisecond * 5)
+	login()
+	if val, _ := storage.Get(DefaultOAuthStateKeyPrefix + abandoned); len(val) != 0 {
+		t.Fatal("abandoned state should be deleted after expired")
+	}
+}
+
+func TestOAuthHandler_DefaultError(t *testing.T) {
+	app := NewAppClient(&AppConfig{ClientID: "cid"})
+
+	rec := httptest.NewRecorder()
+	app.OAuth.NewHandler("https://example.com/callback").
+		CallbackHandler().
+		ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/callback?code=code", nil))
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status %d", rec.Code)
+	}
+}
+
+type failStorage struct{}
+
+func (failStorage) Get(key string) ([]byte, error)   { return nil, errors.New("storage secret detail") }
+func (failStorage) Set(key string, val []byte) error { return errors.New("storage secret detail") }
+func (failStorage) Del(key string) error             { return errors.New("storage secret detail") }
+
+func TestOAuthHandler_DefaultInternalError(t *testing.T) {
+	app := NewAppClient(&AppConfig{ClientID: "cid"})
+
+	var buf bytes.Buffer
+	rec := httptest.NewRecorder()
+	app.OAuth.NewHandler("https://example.com/callback").
+		WithStorage(failStorage{}).
+		WithLogger(slog.New(slog.NewTextHandler(&buf, nil))).
+		LoginHandler().
+		ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/login", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("unexpected status %d", rec.Code)
+	}
+	// 内部错误只记录日志, 不返回给浏览器
+	if strings.Contains(rec.Body.String(), "secret") {
+		t.Fatalf("internal error should not be exposed: %s", rec.Body.String())
+	}
+	if !strings.Contains(buf.String(), "storage secret detail") {
+		t.Fatalf("internal error should be logged: %s", buf.String())
+	}
+}
+
+func TestOAuthHandler_VerifyStateConcurrent(t *testing.T) {
+	app := NewAppClient(&AppConfig{ClientID: "cid"})
+	h := app.OAuth.NewHandler("https://example.com/callback").WithStorage(basic.NewMapStorage())
+
+	state, err := h.newState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ok int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if h.verifyState(state) == nil {
+				atomic.AddInt32(&ok, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if ok != 1 {
+		t.Fatalf("state should be used only once, got %d", ok)
+	}
+}
@@ -0,0 +1,173 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package openhome
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultPageSize 分页迭代默认的每页数量
+const DefaultPageSize = 10
+
+// PageFetcher 获取第 pn 页(从1开始), 返回当前页的数据与分页信息
+type PageFetcher[T any] func(ctx context.Context, pn, ps int) ([]T, PageResp, error)
+
+type page[T any] struct {
+	items []T
+	err   error
+}
+
+// PageIterator 分页接口的迭代器, 在后台预取下一页
+// 使用方式同 bufio.Scanner:
+//
+//	it := app.Archive.IterateList(ctx, accessToken, openhome.ArchiveStatusAll)
+//	defer it.Close()
+//	for it.Next() {
+//		item := it.Item()
+//	}
+//	if err := it.Err(); err != nil {}
+//
+// 获取到 PageResp.Total 条数据或返回空页后结束, 提前退出时需要调用 Close
+type PageIterator[T any] struct {
+	cancel    context.CancelFunc
+	pages     chan page[T]
+	closeOnce sync.Once
+	closed    bool
+	doneErr   error // 预取因 ctx 结束而停止时的错误, pages 关闭后可读
+
+	items []T
+	index int
+	item  T
+	err   error
+}
+
+// NewPageIterator 创建分页迭代器, pageSize 小于等于0时使用 DefaultPageSize
+func NewPageIterator[T any](ctx context.Context, pageSize int, fetch PageFetcher[T]) *PageIterator[T] {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	it := &PageIterator[T]{
+		cancel: cancel,
+		// 缓冲一页, 当前页处理时预取下一页
+		pages: make(chan page[T], 1),
+	}
+
+	go it.prefetch(ctx, pageSize, fetch)
+	return it
+}
+
+func (it *PageIterator[T]) prefetch(ctx context.Context, pageSize int, fetch PageFetcher[T]) {
+	defer close(it.pages)
+
+	fetched := 0
+	for pn := 1; ; pn++ {
+		items, pageResp, err := fetch(ctx, pn, pageSize)
+		if err == nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+
+		select {
+		case <-ctx.Done():
+			// 缓冲区可能已满, 通过 doneErr 传递, 避免被当作正常结束
+			it.doneErr = ctx.Err()
+			return
+		case it.pages <- page[T]{items: items, err: err}:
+		}
+
+		fetched += len(items)
+		if err != nil || len(items) == 0 || fetched >= pageResp.Total {
+			return
+		}
+	}
+}
+
+// Next 移动到下一条数据, 没有更多数据或出错时返回 false
+func (it *PageIterator[T]) Next() bool {
+	if it.closed {
+		return false
+	}
+
+	for it.index >= len(it.items) {
+		if it.err != nil {
+			return false
+		}
+
+		p, ok := <-it.pages
+		if !ok {
+			it.err = it.doneErr
+			return false
+		}
+
+		if p.err != nil {
+			it.err = p.err
+			return false
+		}
+
+		if len(p.items) == 0 {
+			return false
+		}
+
+		it.items, it.index = p.items, 0
+	}
+
+	it.item = it.items[it.index]
+	it.index++
+	return true
+}
+
+// Item 当前数据
+func (it *PageIterator[T]) Item() T {
+	return it.item
+}
+
+// Err 迭代过程中的错误, 正常结束时为空
+func (it *PageIterator[T]) Err() error {
+	return it.err
+}
+
+// Close 停止预取, 之后 Next 返回 false, 可以重复调用
+func (it *PageIterator[T]) Close() {
+	it.closeOnce.Do(func() {
+		it.closed = true
+		it.cancel()
+		// 等待预取结束, 丢弃未读取的数据
+		for range it.pages {
+		}
+	})
+}
+
+// All 读取剩余的全部数据并关闭迭代器
+func (it *PageIterator[T]) All() ([]T, error) {
+	defer it.Close()
+
+	var items []T
+	for it.Next() {
+		items = append(items, it.Item())
+	}
+
+	return items, it.Err()
+}
@@ -0,0 +1,198 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package openhome
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func numberFetcher(total int, calls *int32, pageFetched chan<- int) PageFetcher[int] {
+	return func(ctx context.Context, pn, ps int) ([]int, PageResp, error) {
+		atomic.AddInt32(calls, 1)
+		if pageFetched != nil {
+			pageFetched <- pn
+		}
+
+		var items []int
+		for i := (pn - 1) * ps; i < pn*ps && i < total; i++ {
+			items = append(items, i)
+		}
+		return items, PageResp{PageNumber: pn, PageSize: ps, Total: total}, nil
+	}
+}
+
+func TestPageIterator(t *testing.T) {
+	var calls int32
+	items, err := NewPageIterator(context.Background(), 10, numberFetcher(25, &calls, nil)).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 25 || items[24] != 24 || atomic.LoadInt32(&calls) != 3 {
+		t.Fatalf("unexpected items %v, calls %d", items, calls)
+	}
+
+	// 没有数据
+	calls = 0
+	items, err = NewPageIterator(context.Background(), 10, numberFetcher(0, &calls, nil)).All()
+	if err != nil || len(items) != 0 || calls != 1 {
+		t.Fatalf("unexpected result %v %v, calls %d", items, err, calls)
+	}
+}
+
+func TestPageIterator_Prefetch(t *testing.T) {
+	var calls int32
+	fetched := make(chan int, 10)
+	it := NewPageIterator(context.Background(), 2, numberFetcher(100, &calls, fetched))
+
+	if !it.Next() || it.Item() != 0 {
+		t.Fatal("unexpected first item")
+	}
+
+	// 处理第一页时预取第二页
+	for _, want := range []int{1, 2} {
+		select {
+		case pn := <-fetched:
+			if pn != want {
+				t.Fatalf("unexpected page %d", pn)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("page %d should be prefetched", want)
+		}
+	}
+
+	it.Close()
+	it.Close()
+
+	if it.Next() {
+		t.Fatal("closed iterator should stop")
+	}
+
+	if n := atomic.LoadInt32(&calls); n > 4 {
+		t.Fatalf("closed iterator should stop fetching, calls %d", n)
+	}
+}
+
+func TestPageIterator_Error(t *testing.T) {
+	fetchErr := errors.New("fetch fail")
+	it := NewPageIterator(context.Background(), 2, func(ctx context.Context, pn, ps int) ([]int, PageResp, error) {
+		if pn == 2 {
+			return nil, PageResp{}, fetchErr
+		}
+		return []int{1, 2}, PageResp{Total: 10}, nil
+	})
+	defer it.Close()
+
+	n := 0
+	for it.Next() {
+		n++
+	}
+
+	if n != 2 || !errors.Is(it.Err(), fetchErr) {
+		t.Fatalf("unexpected result %d, %v", n, it.Err())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := NewPageIterator(ctx, 2, func(ctx context.Context, pn, ps int) ([]int, PageResp, error) {
+		return []int{1, 2}, PageResp{Total: 10}, ctx.Err()
+	}).All()
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected err %v", err)
+	}
+}
+
+func TestPageIterator_Cancel(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		fetched := make(chan int, 100)
+		it := NewPageIterator(ctx, 2, func(ctx context.Context, pn, ps int) ([]int, PageResp, error) {
+			if err := ctx.Err(); err != nil {
+				return nil, PageResp{}, err
+			}
+			fetched <- pn
+			return []int{pn, pn}, PageResp{Total: 1000}, nil
+		})
+
+		if !it.Next() {
+			t.Fatal("unexpected end")
+		}
+
+		// 等待预取的下一页进入缓冲区后取消
+		<-fetched
+		<-fetched
+		cancel()
+
+		n := 1
+		for it.Next() {
+			n++
+		}
+
+		// 取消后不能被当作正常结束
+		if !errors.Is(it.Err(), context.Canceled) || n >= 1000 {
+			t.Fatalf("unexpected result %d, %v", n, it.Err())
+		}
+		it.Close()
+	}
+}
+
+func TestArchive_IterateList(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pn, _ := strconv.Atoi(r.URL.Query().Get("pn"))
+		if r.URL.Query().Get("status") != ArchiveStatusPubed || r.URL.Query().Get("ps") != strconv.Itoa(DefaultPageSize) {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+
+		list := ""
+		for i := (pn - 1) * DefaultPageSize; i < pn*DefaultPageSize && i < 13; i++ {
+			if list != "" {
+				list += ","
+			}
+			list += fmt.Sprintf(`{"resource_id":"BV%d"}`, i)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"code":0,"message":"0","data":{"page":{"pn":%d,"ps":%d,"total":13},"list":[%s]}}`, pn, DefaultPageSize, list)
+	}))
+	defer srv.Close()
+
+	app := NewAppClient(&AppConfig{ClientID: "cid", MemberHost: srv.URL})
+	archives, err := app.Archive.IterateList(context.Background(), "token", ArchiveStatusPubed).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(archives) != 13 || archives[12].ResourceID != "BV12" {
+		t.Fatalf("unexpected archives %d", len(archives))
+	}
+}
@@ -0,0 +1,176 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package openhome
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	errors2 "github.com/vtb-link/bianka/errors"
+)
+
+// DefaultScopeCacheTTL 默认的授权权限缓存时间
+const DefaultScopeCacheTTL = time.Minute * 10
+
+// MissingScopeError 用户没有授权接口需要的权限
+// 开启 AppConfig.CheckScopes 后在请求前返回, 可以通过 errors.Is 判断 errors.ErrPermissionDenied
+type MissingScopeError struct {
+	OpenID   string   // 使用 OpenIDToken 时有值
+	Required []string // 接口需要的权限
+	Missing  []string // 未授权的权限
+}
+
+func (e *MissingScopeError) Error() string {
+	msg := "missing scopes: " + strings.Join(e.Missing, ",")
+	if e.OpenID != "" {
+		msg += ", openid:" + e.OpenID
+	}
+	return msg
+}
+
+func (e *MissingScopeError) Unwrap() error {
+	return errors2.ErrPermissionDenied
+}
+
+// AsMissingScopeError 从错误链中获取 *MissingScopeError
+func AsMissingScopeError(err error) (*MissingScopeError, bool) {
+	var scopeErr *MissingScopeError
+	if errors.As(err, &scopeErr) {
+		return scopeErr, true
+	}
+	return nil, false
+}
+
+func (cfg *AppConfig) scopeCacheTTL() time.Duration {
+	if cfg.ScopeCacheTTL <= 0 {
+		return DefaultScopeCacheTTL
+	}
+	return cfg.ScopeCacheTTL
+}
+
+// withScopes 声明接口需要的权限
+func withScopes(scopes ...string) executeOption {
+	return func(opts *executeOptions) {
+		opts.scopes = append(opts.scopes, scopes...)
+	}
+}
+
+type scopeCacheEntry struct {
+	scopes    []string
+	expiresAt time.Time
+}
+
+// scopeCache 按 access_token 缓存 User.GetAccountScopes 的结果
+type scopeCache struct {
+	mu      sync.Mutex
+	entries map[string]scopeCacheEntry
+}
+
+func (sc *scopeCache) get(accessToken string) ([]string, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	entry, ok := sc.entries[accessToken]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+
+	return entry.scopes, true
+}
+
+func (sc *scopeCache) set(accessToken string, scopes []string, ttl time.Duration) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	now := time.Now()
+	if sc.entries == nil {
+		sc.entries = map[string]scopeCacheEntry{}
+	}
+
+	// 顺便清理过期的 access_token
+	for key, entry := range sc.entries {
+		if now.After(entry.expiresAt) {
+			delete(sc.entries, key)
+		}
+	}
+
+	sc.entries[accessToken] = scopeCacheEntry{scopes: scopes, expiresAt: now.Add(ttl)}
+}
+
+func (sc *scopeCache) del(accessToken string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	delete(sc.entries, accessToken)
+}
+
+// checkScopes 检查用户是否授权了 required 中的权限
+// 优先使用 token 中保存的授权权限, 否则通过 User.GetAccountScopes 查询并缓存
+func (app *AppClient) checkScopes(ctx context.Context, accessToken string, token *Token, required []string) error {
+	var granted []string
+	switch cached, ok := app.scopes.get(accessToken); {
+	case token != nil && len(token.Scopes) > 0:
+		granted = token.Scopes
+	case ok:
+		granted = cached
+	default:
+		resp, err := app.User.GetAccountScopesCtx(ctx, accessToken)
+		if err != nil {
+			return err
+		}
+
+		granted = resp.Scopes
+		app.scopes.set(accessToken, granted, app.appCfg.scopeCacheTTL())
+	}
+
+	var missing []string
+	for _, scope := range required {
+		if !containsScope(granted, scope) {
+			missing = append(missing, scope)
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	scopeErr := &MissingScopeError{Required: required, Missing: missing}
+	if token != nil {
+		scopeErr.OpenID = token.OpenID
+	}
+
+	return scopeErr
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
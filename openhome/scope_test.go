@@ -0,0 +1,160 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package openhome
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	errors2 "github.com/vtb-link/bianka/errors"
+)
+
+func TestAppClient_CheckScopes(t *testing.T) {
+	var scopeRequests, roomRequests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/arcopen/fn/user/account/scopes":
+			atomic.AddInt32(&scopeRequests, 1)
+			_, _ = w.Write([]byte(`{"code":0,"message":"0","data":{"scopes":["USER_INFO","LIVE_ROOM_DATA"],"openid":"oid"}}`))
+		case "/arcopen/fn/live/room/info":
+			atomic.AddInt32(&roomRequests, 1)
+			_, _ = w.Write([]byte(`{"code":0,"message":"0","data":{"room_id":1}}`))
+		case "/x/account-oauth2/v1/token":
+			_, _ = w.Write([]byte(`{"code":0,"message":"0","data":{"access_token":"granted","scopes":["USER_INFO"]}}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	app := NewAppClient(&AppConfig{
+		ClientID:    "cid",
+		MemberHost:  srv.URL,
+		ApiHost:     srv.URL,
+		CheckScopes: true,
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, err := app.Live.GetRoomInfo("token"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 权限查询会被缓存
+	if atomic.LoadInt32(&scopeRequests) != 1 || atomic.LoadInt32(&roomRequests) != 2 {
+		t.Fatalf("unexpected requests, scopes %d room %d", scopeRequests, roomRequests)
+	}
+
+	_, err := app.Archive.TypeList("token")
+	scopeErr, ok := AsMissingScopeError(err)
+	if !ok || len(scopeErr.Missing) != 1 || scopeErr.Missing[0] != ScopesArcBase {
+		t.Fatalf("expected MissingScopeError, got %v", err)
+	}
+	if !errors.Is(err, errors2.ErrPermissionDenied) {
+		t.Fatalf("MissingScopeError should match ErrPermissionDenied")
+	}
+
+	// 授权时返回的权限直接用于检查
+	if _, err = app.OAuth.Code2AccessToken("code"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = app.Live.GetRoomInfo("granted"); !errors.Is(err, errors2.ErrPermissionDenied) {
+		t.Fatalf("expected ErrPermissionDenied, got %v", err)
+	}
+
+	if atomic.LoadInt32(&scopeRequests) != 1 || atomic.LoadInt32(&roomRequests) != 2 {
+		t.Fatalf("missing scope should not send requests, scopes %d room %d", scopeRequests, roomRequests)
+	}
+}
+
+func TestAppClient_CheckScopesOpenID(t *testing.T) {
+	fs := newFakeOAuthServer(t)
+	defer fs.Close()
+
+	app := fs.app(nil)
+	app.appCfg.CheckScopes = true
+
+	if _, err := app.Tokens.Exchange(context.Background(), "code"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := app.User.GetAccountInfo(OpenIDToken("oid")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := app.Live.WsStart(OpenIDToken("oid"))
+	scopeErr, ok := AsMissingScopeError(err)
+	if !ok || scopeErr.OpenID != "oid" || scopeErr.Missing[0] != ScopesLiveRoomData {
+		t.Fatalf("expected MissingScopeError, got %v", err)
+	}
+}
+
+func TestAppClient_CheckScopesEvict(t *testing.T) {
+	var scopeRequests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/arcopen/fn/user/account/scopes":
+			atomic.AddInt32(&scopeRequests, 1)
+			_, _ = w.Write([]byte(`{"code":0,"message":"0","data":{"scopes":["USER_INFO","LIVE_ROOM_DATA"],"openid":"oid"}}`))
+		case "/arcopen/fn/live/room/info":
+			_, _ = w.Write([]byte(`{"code":-403,"message":"访问权限不足"}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	app := NewAppClient(&AppConfig{
+		ClientID:    "cid",
+		MemberHost:  srv.URL,
+		ApiHost:     srv.URL,
+		CheckScopes: true,
+	})
+
+	// 本地检查出的权限不足不清理缓存
+	for i := 0; i < 2; i++ {
+		if _, err := app.Archive.TypeList("token"); !errors.Is(err, errors2.ErrPermissionDenied) {
+			t.Fatalf("expected ErrPermissionDenied, got %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(&scopeRequests); n != 1 {
+		t.Fatalf("missing scope should keep cache, scope requests %d", n)
+	}
+
+	// 接口返回权限不足时清理缓存, 下次请求重新查询
+	for i := 0; i < 2; i++ {
+		if _, err := app.Live.GetRoomInfo("token"); !errors.Is(err, errors2.ErrPermissionDenied) {
+			t.Fatalf("expected ErrPermissionDenied, got %v", err)
+		}
+	}
+	if n := atomic.LoadInt32(&scopeRequests); n != 2 {
+		t.Fatalf("api permission denied should evict cache, scope requests %d", n)
+	}
+}
@@ -0,0 +1,287 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package openhome
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vtb-link/bianka/basic"
+)
+
+const (
+	DefaultTokenKeyPrefix      = "bianka:openhome:token:" // TokenManager 默认的 key 前缀
+	DefaultTokenRefreshAhead   = time.Minute * 5          // TokenManager 默认提前刷新的时间
+	DefaultTokenRefreshTimeout = time.Second * 30         // TokenManager 默认单次刷新的超时时间
+
+	openIDTokenPrefix = "openid:"
+)
+
+// ErrTokenNotFound openid 没有保存的 token
+var ErrTokenNotFound = errors.New("token not found")
+
+// OpenIDToken 生成 openid 引用, 可以代替 access_token 传入各接口
+// 请求时通过 AppClient.Tokens 获取该 openid 的 access_token, 即将过期时自动刷新
+func OpenIDToken(openid string) string {
+	return openIDTokenPrefix + openid
+}
+
+// ParseOpenIDToken 解析 OpenIDToken 生成的引用
+func ParseOpenIDToken(accessToken string) (openid string, ok bool) {
+	if !strings.HasPrefix(accessToken, openIDTokenPrefix) {
+		return "", false
+	}
+
+	return strings.TrimPrefix(accessToken, openIDTokenPrefix), true
+}
+
+// Token 保存在 basic.Storage 中的授权信息
+type Token struct {
+	AccessToken
+	OpenID    string   `json:"openid"`
+	Scopes    []string `json:"scopes"`
+	UpdatedAt int64    `json:"updated_at"` // 最后一次获取或刷新的时间
+}
+
+// TokenManager 按 openid 管理 access_token
+// token 保存在 basic.Storage 中, 过期前 refreshAhead 内使用时通过 OAuth.RefreshToken 刷新
+// 同一个 openid 同时只会有一个刷新请求
+type TokenManager struct {
+	oauth          *OAuth
+	storage        basic.Storage
+	keyPrefix      string
+	refreshAhead   time.Duration
+	refreshTimeout time.Duration
+
+	mu      sync.Mutex
+	flights map[string]*tokenFlight
+}
+
+type tokenFlight struct {
+	done  chan struct{}
+	token *Token
+	err   error
+}
+
+// NewTokenManager 创建 TokenManager, storage 为空时使用 basic.MapStorage
+func NewTokenManager(oauth *OAuth, storage basic.Storage) *TokenManager {
+	if storage == nil {
+		storage = basic.NewMapStorage()
+	}
+
+	return &TokenManager{
+		oauth:          oauth,
+		storage:        storage,
+		keyPrefix:      DefaultTokenKeyPrefix,
+		refreshAhead:   DefaultTokenRefreshAhead,
+		refreshTimeout: DefaultTokenRefreshTimeout,
+		flights:        map[string]*tokenFlight{},
+	}
+}
+
+// WithKeyPrefix 设置 key 前缀, 多个应用共享 storage 时需要区分
+func (tm *TokenManager) WithKeyPrefix(prefix string) *TokenManager {
+	tm.keyPrefix = prefix
+	return tm
+}
+
+// WithRefreshAhead 设置提前刷新的时间
+func (tm *TokenManager) WithRefreshAhead(d time.Duration) *TokenManager {
+	tm.refreshAhead = d
+	return tm
+}
+
+// WithRefreshTimeout 设置单次刷新的超时时间
+// 刷新与调用者的 ctx 无关, 避免某个调用者取消后其他等待者一起失败
+func (tm *TokenManager) WithRefreshTimeout(d time.Duration) *TokenManager {
+	tm.refreshTimeout = d
+	return tm
+}
+
+func (tm *TokenManager) key(openid string) string {
+	return tm.keyPrefix + openid
+}
+
+// Exchange 使用授权码换取 token, 查询 openid 后保存
+func (tm *TokenManager) Exchange(ctx context.Context, code string) (*Token, error) {
+	resp, err := tm.oauth.Code2AccessTokenCtx(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := (*User)(tm.oauth).GetAccountInfoCtx(ctx, resp.AccessToken.AccessToken)
+	if err != nil {
+		return nil, errors.WithMessage(err, "get account info fail")
+	}
+
+	token := &Token{
+		AccessToken: resp.AccessToken,
+		OpenID:      info.Openid,
+		Scopes:      resp.Scopes,
+	}
+
+	if err = tm.Save(token); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// Save 保存 token, 会覆盖已有的 token
+func (tm *TokenManager) Save(token *Token) error {
+	if token.OpenID == "" {
+		return errors.New("openid is empty")
+	}
+
+	if token.UpdatedAt == 0 {
+		token.UpdatedAt = time.Now().Unix()
+	}
+
+	val, err := json.Marshal(token)
+	if err != nil {
+		return errors.Wrap(err, "json marshal fail")
+	}
+
+	return errors.Wrapf(tm.storage.Set(tm.key(token.OpenID), val), "save token fail, openid:%s", token.OpenID)
+}
+
+// Get 获取保存的 token, 不会刷新, 不存在时返回 ErrTokenNotFound
+func (tm *TokenManager) Get(openid string) (*Token, error) {
+	val, err := tm.storage.Get(tm.key(openid))
+	if err != nil {
+		return nil, errors.Wrapf(err, "get token fail, openid:%s", openid)
+	}
+
+	if len(val) == 0 {
+		return nil, errors.Wrapf(ErrTokenNotFound, "openid:%s", openid)
+	}
+
+	token := &Token{}
+	if err = json.Unmarshal(val, token); err != nil {
+		return nil, errors.Wrapf(err, "json unmarshal fail, data:%s", val)
+	}
+
+	return token, nil
+}
+
+// Delete 删除保存的 token, 例如用户取消授权后
+func (tm *TokenManager) Delete(openid string) error {
+	return errors.Wrapf(tm.storage.Del(tm.key(openid)), "delete token fail, openid:%s", openid)
+}
+
+// Token 获取可用的 token, 即将过期时自动刷新
+func (tm *TokenManager) Token(ctx context.Context, openid string) (*Token, error) {
+	token, err := tm.Get(openid)
+	if err != nil {
+		return nil, err
+	}
+
+	if !tm.needRefresh(token) {
+		return token, nil
+	}
+
+	return tm.refresh(ctx, openid, false)
+}
+
+// AccessToken 获取可用的 access_token, 即将过期时自动刷新
+func (tm *TokenManager) AccessToken(ctx context.Context, openid string) (string, error) {
+	token, err := tm.Token(ctx, openid)
+	if err != nil {
+		return "", err
+	}
+
+	return token.AccessToken.AccessToken, nil
+}
+
+// Refresh 立即刷新 token, 例如接口返回 access_token 无效时
+func (tm *TokenManager) Refresh(ctx context.Context, openid string) (*Token, error) {
+	return tm.refresh(ctx, openid, true)
+}
+
+func (tm *TokenManager) needRefresh(token *Token) bool {
+	return token.ExpiresAt().Add(-tm.refreshAhead).Before(time.Now())
+}
+
+// refresh 合并同一个 openid 的并发刷新
+// force 为 false 时, 如果其他调用已经刷新过则直接使用
+// 刷新在独立的 context 中进行, 超时由 refreshTimeout 控制, ctx 只控制各调用者的等待
+func (tm *TokenManager) refresh(ctx context.Context, openid string, force bool) (*Token, error) {
+	tm.mu.Lock()
+	flight, ok := tm.flights[openid]
+	if !ok {
+		flight = &tokenFlight{done: make(chan struct{})}
+		tm.flights[openid] = flight
+
+		go tm.runFlight(flight, openid, force)
+	}
+	tm.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-flight.done:
+		return flight.token, flight.err
+	}
+}
+
+func (tm *TokenManager) runFlight(flight *tokenFlight, openid string, force bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), tm.refreshTimeout)
+	defer cancel()
+
+	flight.token, flight.err = tm.doRefresh(ctx, openid, force)
+
+	tm.mu.Lock()
+	delete(tm.flights, openid)
+	tm.mu.Unlock()
+	close(flight.done)
+}
+
+func (tm *TokenManager) doRefresh(ctx context.Context, openid string, force bool) (*Token, error) {
+	// 重新读取, storage 可能被其他实例更新过
+	token, err := tm.Get(openid)
+	if err != nil {
+		return nil, err
+	}
+
+	if !force && !tm.needRefresh(token) {
+		return token, nil
+	}
+
+	resp, err := tm.oauth.RefreshTokenCtx(ctx, token.RefreshToken)
+	if err != nil {
+		return nil, errors.WithMessagef(err, "refresh token fail, openid:%s", openid)
+	}
+
+	token.AccessToken = resp.AccessToken
+	token.UpdatedAt = time.Now().Unix()
+	if err = tm.Save(token); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
@@ -0,0 +1,240 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package openhome
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vtb-link/bianka/basic"
+)
+
+// fakeOAuthServer 模拟授权接口, 每次刷新生成新的 access_token
+type fakeOAuthServer struct {
+	*httptest.Server
+
+	refreshes int32
+	expiresIn int64 // 新 token 的有效时间(秒)
+	current   atomic.Value
+}
+
+func newFakeOAuthServer(t *testing.T) *fakeOAuthServer {
+	fs := &fakeOAuthServer{expiresIn: 3600}
+	fs.current.Store("token-0")
+
+	mux := http.NewServeMux()
+	writeToken := func(w http.ResponseWriter, token string) {
+		_, _ = fmt.Fprintf(w, `{"code":0,"message":"0","data":{"access_token":%q,"expires_in":%d,"refresh_token":"refresh-%s","scopes":["USER_INFO"]}}`,
+			token, time.Now().Unix()+atomic.LoadInt64(&fs.expiresIn), token)
+	}
+	mux.HandleFunc("/x/account-oauth2/v1/token", func(w http.ResponseWriter, r *http.Request) {
+		writeToken(w, fs.current.Load().(string))
+	})
+	mux.HandleFunc("/x/account-oauth2/v1/refresh_token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("refresh_token") != "refresh-"+fs.current.Load().(string) {
+			t.Errorf("unexpected refresh token %s", r.FormValue("refresh_token"))
+		}
+
+		// 放大并发刷新的窗口
+		time.Sleep(time.Millisecond * 20)
+		token := fmt.Sprintf("token-%d", atomic.AddInt32(&fs.refreshes, 1))
+		fs.current.Store(token)
+		writeToken(w, token)
+	})
+	mux.HandleFunc("/arcopen/fn/user/account/info", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("access_token") != fs.current.Load().(string) {
+			_, _ = w.Write([]byte(`{"code":-101,"message":"账号未登录"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":0,"message":"0","data":{"name":"bianka","openid":"oid"}}`))
+	})
+
+	fs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		mux.ServeHTTP(w, r)
+	}))
+
+	return fs
+}
+
+func (fs *fakeOAuthServer) app(storage basic.Storage) *AppClient {
+	return NewAppClient(&AppConfig{
+		ClientID:     "cid",
+		ClientSecret: "secret",
+		MemberHost:   fs.URL,
+		ApiHost:      fs.URL,
+		AccountHost:  fs.URL,
+		TokenStorage: storage,
+	})
+}
+
+func TestOAuth_RefreshToken(t *testing.T) {
+	fs := newFakeOAuthServer(t)
+	defer fs.Close()
+
+	resp, err := fs.app(nil).OAuth.RefreshToken("refresh-token-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.AccessToken.AccessToken != "token-1" || resp.IsExpired() {
+		t.Fatalf("unexpected token %+v", resp)
+	}
+}
+
+func TestTokenManager(t *testing.T) {
+	fs := newFakeOAuthServer(t)
+	defer fs.Close()
+
+	storage := basic.NewMapStorage()
+	app := fs.app(storage)
+
+	if _, err := app.Tokens.Get("oid"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("expected ErrTokenNotFound, got %v", err)
+	}
+
+	token, err := app.Tokens.Exchange(context.Background(), "code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.OpenID != "oid" || token.AccessToken.AccessToken != "token-0" || len(token.Scopes) != 1 {
+		t.Fatalf("unexpected token %+v", token)
+	}
+
+	// 其他实例共享 storage
+	other := fs.app(storage)
+	if accessToken, err := other.Tokens.AccessToken(context.Background(), "oid"); err != nil || accessToken != "token-0" {
+		t.Fatalf("unexpected access token %s, %v", accessToken, err)
+	}
+
+	// 即将过期时刷新, 并发调用只刷新一次
+	token.ExpiresIn = int(time.Now().Add(time.Minute).Unix())
+	if err = app.Tokens.Save(token); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if accessToken, err := app.Tokens.AccessToken(context.Background(), "oid"); err != nil || accessToken != "token-1" {
+				t.Errorf("unexpected access token %s, %v", accessToken, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&fs.refreshes); n != 1 {
+		t.Fatalf("expected 1 refresh, got %d", n)
+	}
+
+	if token, err = other.Tokens.Get("oid"); err != nil || token.RefreshToken != "refresh-token-1" || len(token.Scopes) != 1 {
+		t.Fatalf("refreshed token should be saved, %+v %v", token, err)
+	}
+
+	if err = app.Tokens.Delete("oid"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = app.Tokens.AccessToken(context.Background(), "oid"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("expected ErrTokenNotFound, got %v", err)
+	}
+}
+
+func TestTokenManager_RefreshWaiterCanceled(t *testing.T) {
+	fs := newFakeOAuthServer(t)
+	defer fs.Close()
+
+	app := fs.app(nil)
+	token, err := app.Tokens.Exchange(context.Background(), "code")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 发起刷新的调用者取消, 刷新仍然完成并保存, 不影响其他调用者
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = app.Tokens.Refresh(ctx, "oid"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second * 5)
+	for {
+		if token, err = app.Tokens.Get("oid"); err == nil && token.AccessToken.AccessToken == "token-1" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("refresh should finish after the caller canceled, %+v %v", token, err)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	if n := atomic.LoadInt32(&fs.refreshes); n != 1 {
+		t.Fatalf("expected 1 refresh, got %d", n)
+	}
+}
+
+func TestAppClient_OpenIDToken(t *testing.T) {
+	fs := newFakeOAuthServer(t)
+	defer fs.Close()
+
+	app := fs.app(nil)
+	if _, err := app.Tokens.Exchange(context.Background(), "code"); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := app.User.GetAccountInfo(OpenIDToken("oid"))
+	if err != nil || info.Openid != "oid" {
+		t.Fatalf("unexpected result %+v, %v", info, err)
+	}
+
+	// 服务端提前失效, 刷新后重试一次
+	fs.current.Store("revoked")
+	if err = app.Tokens.Save(&Token{AccessToken: AccessToken{
+		AccessToken:  "token-0",
+		ExpiresIn:    int(time.Now().Add(time.Hour).Unix()),
+		RefreshToken: "refresh-revoked",
+	}, OpenID: "oid"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, err = app.User.GetAccountInfo(OpenIDToken("oid")); err != nil || info.Openid != "oid" {
+		t.Fatalf("unexpected result %+v, %v", info, err)
+	}
+
+	if n := atomic.LoadInt32(&fs.refreshes); n != 1 {
+		t.Fatalf("expected 1 refresh, got %d", n)
+	}
+
+	if _, err = app.User.GetAccountInfo(OpenIDToken("unknown")); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("expected ErrTokenNotFound, got %v", err)
+	}
+}
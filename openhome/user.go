@@ -24,8 +24,9 @@
 package openhome
 
 import (
+	"context"
+
 	"github.com/go-resty/resty/v2"
-	"github.com/pkg/errors"
 )
 
 type User basicService
@@ -36,21 +37,20 @@ type AccountScopesResp struct {
 }
 
 func (u *User) GetAccountScopes(accessToken string) (*AccountScopesResp, error) {
+	return u.GetAccountScopesCtx(context.Background(), accessToken)
+}
+
+// GetAccountScopesCtx 同 GetAccountScopes, 支持传入 context
+func (u *User) GetAccountScopesCtx(ctx context.Context, accessToken string) (*AccountScopesResp, error) {
 	result := NewBaseResp(&AccountScopesResp{})
 
-	resp, err := resty.New().R().
-		SetResult(result).
+	r := u.app.newRequest(ctx).
 		SetQueryParams(map[string]string{
 			"client_id":    u.app.appCfg.ClientID,
 			"access_token": accessToken,
-		}).
-		Get(`https://member.bilibili.com/arcopen/fn/user/account/scopes`)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "do request fail")
-	}
+		})
 
-	if err = checkResp(resp, result); err != nil {
+	if err := u.app.execute(r, resty.MethodGet, u.app.memberURL("/arcopen/fn/user/account/scopes"), result); err != nil {
 		return nil, err
 	}
 
@@ -64,21 +64,20 @@ type AccountInfoResp struct {
 }
 
 func (u *User) GetAccountInfo(accessToken string) (*AccountInfoResp, error) {
+	return u.GetAccountInfoCtx(context.Background(), accessToken)
+}
+
+// GetAccountInfoCtx 同 GetAccountInfo, 支持传入 context
+func (u *User) GetAccountInfoCtx(ctx context.Context, accessToken string) (*AccountInfoResp, error) {
 	result := NewBaseResp(&AccountInfoResp{})
 
-	resp, err := resty.New().R().
-		SetResult(result).
+	r := u.app.newRequest(ctx).
 		SetQueryParams(map[string]string{
 			"client_id":    u.app.appCfg.ClientID,
 			"access_token": accessToken,
-		}).
-		Get(`https://member.bilibili.com/arcopen/fn/user/account/info`)
-
-	if err != nil {
-		return nil, errors.Wrapf(err, "do request fail")
-	}
+		})
 
-	if err = checkResp(resp, result); err != nil {
+	if err := u.app.execute(r, resty.MethodGet, u.app.memberURL("/arcopen/fn/user/account/info"), result, withScopes(ScopesUserinfo)); err != nil {
 		return nil, err
 	}
 
@@ -30,88 +30,109 @@ import (
 )
 
 const (
-	CmdLiveOpenPlatformDanmu        = "LIVE_OPEN_PLATFORM_DM"              // 弹幕
-	CmdLiveOpenPlatformSendGift     = "LIVE_OPEN_PLATFORM_SEND_GIFT"       // 礼物
-	CmdLiveOpenPlatformSuperChat    = "LIVE_OPEN_PLATFORM_SUPER_CHAT"      // SC
-	CmdLiveOpenPlatformSuperChatDel = "LIVE_OPEN_PLATFORM_SUPER_CHAT_DEL"  // SC删除
-	CmdLiveOpenPlatformGuard        = "LIVE_OPEN_PLATFORM_GUARD"           // 付费大航海
-	CmdLiveOpenPlatformLike         = "LIVE_OPEN_PLATFORM_LIKE"            // 点赞
-	CmdLiveOpenPlatformRoomEnter    = "LIVE_OPEN_PLATFORM_LIVE_ROOM_ENTER" // 进入房间
-	CmdLiveOpenPlatformLiveStart    = "LIVE_OPEN_PLATFORM_LIVE_START"      // 开始直播
-	CmdLiveOpenPlatformLiveEnd      = "LIVE_OPEN_PLATFORM_LIVE_END"        // 结束直播
-	// CmdLiveOpenPlatformInteractionEnd = "LIVE_OPEN_PLATFORM_INTERACTION_END" // 消息推送结束通知
-
-	CmdLiveRoomDanmu         = "OPEN_LIVEROOM_DM"              // 弹幕
-	CmdLiveRoomSendGift      = "OPEN_LIVEROOM_SEND_GIFT"       // 礼物
-	CmdLiveRoomSuperChat     = "OPEN_LIVEROOM_SUPER_CHAT"      // SC
-	CmdLiveRoomSuperChatDel  = "OPEN_LIVEROOM_SUPER_CHAT_DEL"  // SC删除
-	CmdLiveRoomSuperGuard    = "OPEN_LIVEROOM_GUARD"           // 付费大航海
-	CmdLiveRoomLike          = "OPEN_LIVEROOM_LIKE"            // 点赞
-	CmdLiveRoomLiveRoomEnter = "OPEN_LIVEROOM_LIVE_ROOM_ENTER" // 进入房间
-	CmdLiveRoomLiveStart     = "OPEN_LIVEROOM_LIVE_START"      // 开始直播
-	CmdLiveRoomLiveEnd       = "OPEN_LIVEROOM_LIVE_END"        // 结束直播
-	CmdLiveRoomRoomChange    = "OPEN_LIVEROOM_ROOM_CHANGE"     // 直播间基础信息更新
-	CmdLiveRoomRoomBlockMsg  = "OPEN_LIVEROOM_ROOM_BLOCK_MSG"  // 用户禁言通知
-	CmdLiveRoomInteractWord  = "OPEN_LIVEROOM_INTERACT_WORD"   // 用户关注通知
-	CmdLiveRoomWarning       = "OPEN_LIVEROOM_WARNING"         // 直播间警告信息
-	//CmdLiveRoomInteractionEnd = "OPEN_LIVEROOM_INTERACTION_END" // 消息推送结束通知
+	CmdLiveOpenPlatformDanmu          = "LIVE_OPEN_PLATFORM_DM"              // 弹幕
+	CmdLiveOpenPlatformSendGift       = "LIVE_OPEN_PLATFORM_SEND_GIFT"       // 礼物
+	CmdLiveOpenPlatformSuperChat      = "LIVE_OPEN_PLATFORM_SUPER_CHAT"      // SC
+	CmdLiveOpenPlatformSuperChatDel   = "LIVE_OPEN_PLATFORM_SUPER_CHAT_DEL"  // SC删除
+	CmdLiveOpenPlatformGuard          = "LIVE_OPEN_PLATFORM_GUARD"           // 付费大航海
+	CmdLiveOpenPlatformLike           = "LIVE_OPEN_PLATFORM_LIKE"            // 点赞
+	CmdLiveOpenPlatformRoomEnter      = "LIVE_OPEN_PLATFORM_LIVE_ROOM_ENTER" // 进入房间
+	CmdLiveOpenPlatformLiveStart      = "LIVE_OPEN_PLATFORM_LIVE_START"      // 开始直播
+	CmdLiveOpenPlatformLiveEnd        = "LIVE_OPEN_PLATFORM_LIVE_END"        // 结束直播
+	CmdLiveOpenPlatformInteractionEnd = "LIVE_OPEN_PLATFORM_INTERACTION_END" // 消息推送结束通知
+
+	CmdLiveRoomDanmu          = "OPEN_LIVEROOM_DM"              // 弹幕
+	CmdLiveRoomSendGift       = "OPEN_LIVEROOM_SEND_GIFT"       // 礼物
+	CmdLiveRoomSuperChat      = "OPEN_LIVEROOM_SUPER_CHAT"      // SC
+	CmdLiveRoomSuperChatDel   = "OPEN_LIVEROOM_SUPER_CHAT_DEL"  // SC删除
+	CmdLiveRoomSuperGuard     = "OPEN_LIVEROOM_GUARD"           // 付费大航海
+	CmdLiveRoomLike           = "OPEN_LIVEROOM_LIKE"            // 点赞
+	CmdLiveRoomLiveRoomEnter  = "OPEN_LIVEROOM_LIVE_ROOM_ENTER" // 进入房间
+	CmdLiveRoomLiveStart      = "OPEN_LIVEROOM_LIVE_START"      // 开始直播
+	CmdLiveRoomLiveEnd        = "OPEN_LIVEROOM_LIVE_END"        // 结束直播
+	CmdLiveRoomRoomChange     = "OPEN_LIVEROOM_ROOM_CHANGE"     // 直播间基础信息更新
+	CmdLiveRoomRoomBlockMsg   = "OPEN_LIVEROOM_ROOM_BLOCK_MSG"  // 用户禁言通知
+	CmdLiveRoomInteractWord   = "OPEN_LIVEROOM_INTERACT_WORD"   // 用户关注通知
+	CmdLiveRoomWarning        = "OPEN_LIVEROOM_WARNING"         // 直播间警告信息
+	CmdLiveRoomInteractionEnd = "OPEN_LIVEROOM_INTERACTION_END" // 消息推送结束通知
 )
 
 // AutomaticParsingMessageCommand 自动解析消息命令
-// 如果是已知的命令，data 会被解析成对应的结构体，否则 data 会被解析成 map[string]interface{}
+// 如果是已注册的命令，data 会被解析成对应的结构体，否则 data 会被解析成 map[string]interface{}
+// 注册命令见 RegisterCmd
 func AutomaticParsingMessageCommand(payload []byte) (string, interface{}, error) {
+	cmd, err := ParseCmd(payload)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return cmd.Cmd, cmd.Data, nil
+}
+
+// ParseCmdOption ParseCmd 的可选项
+type ParseCmdOption func(opts *parseCmdOptions)
+
+type parseCmdOptions struct {
+	keepRaw bool
+}
+
+// WithKeepRaw 在 Cmd.Raw 中保留 data 的原始数据
+func WithKeepRaw() ParseCmdOption {
+	return func(opts *parseCmdOptions) {
+		opts.keepRaw = true
+	}
+}
+
+// ParseCmd 解析消息命令, 同 AutomaticParsingMessageCommand
+func ParseCmd(payload []byte, opts ...ParseCmdOption) (*Cmd, error) {
+	options := &parseCmdOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
 	var _cmd struct {
 		Cmd  string          `json:"cmd"`
 		Data json.RawMessage `json:"data"`
 	}
 
 	if err := json.Unmarshal(payload, &_cmd); err != nil {
-		return "", nil, errors.Wrapf(err, "json unmarshal fail, payload:%s", payload)
+		return nil, errors.Wrapf(err, "json unmarshal fail, payload:%s", payload)
 	}
 
-	var err error
 	var data interface{}
-	switch _cmd.Cmd {
-	case CmdLiveOpenPlatformDanmu, CmdLiveRoomDanmu:
-		data = &CmdDanmuData{}
-	case CmdLiveOpenPlatformSendGift, CmdLiveRoomSendGift:
-		data = &CmdSendGiftData{}
-	case CmdLiveOpenPlatformSuperChat, CmdLiveRoomSuperChat:
-		data = &CmdSuperChatData{}
-	case CmdLiveOpenPlatformSuperChatDel, CmdLiveRoomSuperChatDel:
-		data = &CmdSuperChatDelData{}
-	case CmdLiveOpenPlatformGuard, CmdLiveRoomSuperGuard:
-		data = &CmdGuardData{}
-	case CmdLiveOpenPlatformLike, CmdLiveRoomLike:
-		data = &CmdLikeData{}
-	case CmdLiveOpenPlatformRoomEnter, CmdLiveRoomLiveRoomEnter:
-		data = &CmdLiveRoomEnterData{}
-	case CmdLiveOpenPlatformLiveStart, CmdLiveRoomLiveStart:
-		data = &CmdLiveStartData{}
-	case CmdLiveOpenPlatformLiveEnd, CmdLiveRoomLiveEnd:
-		data = &CmdLiveEndData{}
-	case CmdLiveRoomRoomChange:
-		data = &CmdRoomChangeData{}
-	case CmdLiveRoomRoomBlockMsg:
-		data = &CmdRoomBlockMsgData{}
-	case CmdLiveRoomInteractWord:
-		data = &CmdInteractWordData{}
-	case CmdLiveRoomWarning:
-		data = &CmdWarningData{}
-	default:
+	if factory, ok := LookupCmd(_cmd.Cmd); ok {
+		data = factory()
+		if len(_cmd.Data) > 0 {
+			if err := json.Unmarshal(_cmd.Data, data); err != nil {
+				return nil, errors.Wrapf(err, "json unmarshal fail, payload:%s", payload)
+			}
+		}
+	} else if len(_cmd.Data) > 0 {
+		// 未注册的命令 data 可能是对象、数组或基础类型, 按原样解析
+		// 对象仍然解析为 map[string]interface{}
+		if err := json.Unmarshal(_cmd.Data, &data); err != nil {
+			return nil, errors.Wrapf(err, "json unmarshal fail, payload:%s", payload)
+		}
+	} else {
 		data = map[string]interface{}{}
 	}
 
-	if err = json.Unmarshal(_cmd.Data, &data); err != nil {
-		return "", nil, errors.Wrapf(err, "json unmarshal fail, payload:%s", payload)
+	cmd := &Cmd{
+		Cmd:  _cmd.Cmd,
+		Data: data,
+	}
+
+	if options.keepRaw {
+		cmd.Raw = _cmd.Data
 	}
 
-	return _cmd.Cmd, data, nil
+	return cmd, nil
 }
 
 type Cmd struct {
-	Cmd  string      `json:"cmd"`
-	Data interface{} `json:"data"`
+	Cmd  string          `json:"cmd"`
+	Data interface{}     `json:"data"`
+	Raw  json.RawMessage `json:"-"` // data 的原始数据, 需要 WithKeepRaw
 }
 
 // CmdDanmuData 弹幕数据
@@ -329,6 +350,7 @@ type CmdWarningData struct {
 }
 
 // CmdInteractionEndData 消息推送结束通知数据
+// 收到后该 conn_id(game_id) 不会再有消息推送, 长连接会以 basic.CloseInteractionEnd 关闭
 type CmdInteractionEndData struct {
 	// 结束消息推送的conn_id
 	ConnID string `json:"conn_id"`
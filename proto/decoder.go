@@ -0,0 +1,179 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package proto
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	stderr "errors"
+	"io"
+
+	"github.com/andybalholm/brotli"
+	"github.com/pkg/errors"
+)
+
+// DefaultMaxDecompressedSize 解压后的最大长度, 防止异常数据占用过多内存
+const DefaultMaxDecompressedSize = 16 << 20
+
+var (
+	HeadLengthError         = stderr.New("head length error")
+	VersionError            = stderr.New("unsupported protocol version")
+	NestedCompressionError  = stderr.New("nested compression")
+	DecompressedLengthError = stderr.New("decompressed length exceeds limit")
+)
+
+// Decoder 直播间消息解码器
+// 支持协议版本 0, 1(不压缩), 2(zlib), 3(brotli)
+// 解码出的 Message.Payload 直接引用输入或解压后的数据, 不会额外拷贝, 如需复用输入的 buffer 请自行拷贝
+// see https://open-live.bilibili.com/document/657d8e34-f926-a133-16c0-300c1afc6e6b
+type Decoder struct {
+	maxDecompressedSize int
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{
+		maxDecompressedSize: DefaultMaxDecompressedSize,
+	}
+}
+
+// WithMaxDecompressedSize 设置解压后的最大长度, 小于等于0表示不限制
+func (d *Decoder) WithMaxDecompressedSize(size int) *Decoder {
+	d.maxDecompressedSize = size
+	return d
+}
+
+// Decode 解码一帧数据
+// 被压缩的消息是一组 Message, 所以解码完成会返回 []Message 而非 Message
+func (d *Decoder) Decode(raw []byte) ([]Message, error) {
+	messages := make([]Message, 0, 8)
+	err := d.Walk(raw, func(msg Message) error {
+		messages = append(messages, msg)
+		return nil
+	})
+
+	return messages, err
+}
+
+// Walk 逐个解码一帧数据中的 Message 并交给 fn 处理, fn 返回错误时停止
+// 与 Decode 不同, 不需要为整帧数据分配 []Message
+func (d *Decoder) Walk(raw []byte, fn func(msg Message) error) error {
+	if len(raw) < PackageHeaderTotalLength {
+		return errors.Wrapf(PackLengthError, "packet defect, raw length [%d]", len(raw))
+	}
+
+	return d.walk(raw, true, fn)
+}
+
+func (d *Decoder) walk(raw []byte, allowCompressed bool, fn func(msg Message) error) error {
+	for len(raw) > 0 {
+		head, body, err := splitPacket(raw)
+		if err != nil {
+			return err
+		}
+		raw = raw[head.PackLength:]
+
+		switch head.Version {
+		case BodyProtocolVersionNormal, HeaderDefaultVersion:
+			if err = fn(Message{header: head, payload: body}); err != nil {
+				return err
+			}
+		case BodyProtocolVersionZlib, BodyProtocolVersionBrotli:
+			// 压缩包内只会是未压缩的消息
+			if !allowCompressed {
+				return errors.Wrapf(NestedCompressionError, "version [%d]", head.Version)
+			}
+
+			data, err := d.decompress(head.Version, body)
+			if err != nil {
+				return err
+			}
+
+			if err = d.walk(data, false, fn); err != nil {
+				return err
+			}
+		default:
+			return errors.Wrapf(VersionError, "version [%d]", head.Version)
+		}
+	}
+
+	return nil
+}
+
+// splitPacket 拆分出第一个包的 header 与 body
+func splitPacket(raw []byte) (Header, []byte, error) {
+	if len(raw) < PackageHeaderTotalLength {
+		return Header{}, nil, errors.Wrapf(PackLengthError, "packet defect, raw length [%d]", len(raw))
+	}
+
+	head := Header{
+		PackLength: binary.BigEndian.Uint32(raw[PackageOffset:HeaderOffset]),
+		HeadLength: binary.BigEndian.Uint16(raw[HeaderOffset:VersionOffset]),
+		Version:    binary.BigEndian.Uint16(raw[VersionOffset:OperationOffset]),
+		Operation:  binary.BigEndian.Uint32(raw[OperationOffset:SequenceOffset]),
+		Sequence:   binary.BigEndian.Uint32(raw[SequenceOffset:PackageHeaderTotalLength]),
+	}
+
+	if int(head.HeadLength) < PackageHeaderTotalLength || head.PackLength < uint32(head.HeadLength) {
+		return Header{}, nil, errors.Wrapf(HeadLengthError, "head length [%d], pack length [%d]", head.HeadLength, head.PackLength)
+	}
+
+	if uint64(head.PackLength) > uint64(len(raw)) {
+		return Header{}, nil, errors.Wrapf(PackLengthError, "packet defect, raw length [%d], expected length is [%d]", len(raw), head.PackLength)
+	}
+
+	return head, raw[head.HeadLength:head.PackLength:head.PackLength], nil
+}
+
+func (d *Decoder) decompress(version uint16, body []byte) ([]byte, error) {
+	var reader io.Reader
+	switch version {
+	case BodyProtocolVersionZlib:
+		zr, err := zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, errors.Wrap(err, "new zlib reader fail")
+		}
+		defer zr.Close()
+		reader = zr
+	case BodyProtocolVersionBrotli:
+		reader = brotli.NewReader(bytes.NewReader(body))
+	default:
+		return nil, errors.Wrapf(VersionError, "version [%d]", version)
+	}
+
+	if d.maxDecompressedSize > 0 {
+		reader = io.LimitReader(reader, int64(d.maxDecompressedSize)+1)
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, errors.Wrapf(err, "decompress fail, version [%d]", version)
+	}
+
+	if d.maxDecompressedSize > 0 && len(data) > d.maxDecompressedSize {
+		return nil, errors.Wrapf(DecompressedLengthError, "limit [%d]", d.maxDecompressedSize)
+	}
+
+	return data, nil
+}
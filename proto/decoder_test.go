@@ -0,0 +1,182 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package proto
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type goldenMessage struct {
+	Version   uint16 `json:"version"`
+	Operation uint32 `json:"operation"`
+	Sequence  uint32 `json:"sequence"`
+	Payload   string `json:"payload"`
+}
+
+type golden struct {
+	Messages []goldenMessage `json:"messages"`
+	Error    string          `json:"error,omitempty"`
+}
+
+var goldenErrors = map[string]error{
+	"PackLengthError":        PackLengthError,
+	"HeadLengthError":        HeadLengthError,
+	"VersionError":           VersionError,
+	"NestedCompressionError": NestedCompressionError,
+}
+
+func loadFixtures(t testing.TB) map[string][]byte {
+	files, err := filepath.Glob("testdata/*.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixtures := make(map[string][]byte, len(files))
+	for _, file := range files {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fixtures[strings.TrimSuffix(file, ".bin")] = raw
+	}
+
+	return fixtures
+}
+
+func TestDecoder_Golden(t *testing.T) {
+	for name, raw := range loadFixtures(t) {
+		name, raw := name, raw
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			buf, err := os.ReadFile(name + ".json")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var expected golden
+			if err = json.Unmarshal(buf, &expected); err != nil {
+				t.Fatal(err)
+			}
+
+			messages, err := NewDecoder().Decode(raw)
+			if expected.Error != "" {
+				if err == nil {
+					t.Fatalf("expected error %s", expected.Error)
+				}
+
+				if sentinel, ok := goldenErrors[expected.Error]; ok && !errors.Is(err, sentinel) {
+					t.Fatalf("unexpected error %v, expected %s", err, expected.Error)
+				} else if !ok && !strings.Contains(err.Error(), expected.Error) {
+					t.Fatalf("unexpected error %v, expected %s", err, expected.Error)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(messages) != len(expected.Messages) {
+				t.Fatalf("unexpected messages length %d, expected %d", len(messages), len(expected.Messages))
+			}
+
+			for i, msg := range messages {
+				e := expected.Messages[i]
+				if msg.header.Version != e.Version || msg.Operation() != e.Operation || msg.header.Sequence != e.Sequence || string(msg.Payload()) != e.Payload {
+					t.Fatalf("unexpected message %d: %+v %q", i, msg.header, msg.Payload())
+				}
+			}
+		})
+	}
+}
+
+func TestDecoder_ZeroCopy(t *testing.T) {
+	raw := PackMessage(HeaderDefaultSequence, OperationMessage, []byte(`{"cmd":"x"}`)).ToBytes()
+
+	messages, err := NewDecoder().Decode(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 未压缩的消息直接引用输入
+	raw[PackageHeaderTotalLength+2] = 'C'
+	if string(messages[0].Payload()) != `{"Cmd":"x"}` {
+		t.Fatalf("payload should reference raw, got %s", messages[0].Payload())
+	}
+
+	// 不允许通过 append 覆盖后续数据
+	if cap(messages[0].Payload()) != len(messages[0].Payload()) {
+		t.Fatalf("payload cap should equal len")
+	}
+}
+
+func TestDecoder_MaxDecompressedSize(t *testing.T) {
+	inner := PackMessage(HeaderDefaultSequence, OperationMessage, bytes.Repeat([]byte("a"), 4096)).ToBytes()
+
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	_, _ = w.Write(inner)
+	_ = w.Close()
+
+	msg := PackMessage(HeaderDefaultSequence, OperationMessage, buf.Bytes())
+	msg.header.Version = BodyProtocolVersionZlib
+	raw := msg.ToBytes()
+
+	if _, err := NewDecoder().WithMaxDecompressedSize(1024).Decode(raw); !errors.Is(err, DecompressedLengthError) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	messages, err := NewDecoder().Decode(raw)
+	if err != nil || len(messages) != 1 || len(messages[0].Payload()) != 4096 {
+		t.Fatalf("unexpected result %v %v", messages, err)
+	}
+}
+
+func FuzzDecoder(f *testing.F) {
+	for _, raw := range loadFixtures(f) {
+		f.Add(raw)
+	}
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		messages, err := NewDecoder().WithMaxDecompressedSize(1 << 20).Decode(raw)
+		if err != nil {
+			return
+		}
+
+		for _, msg := range messages {
+			if msg.header.Version > HeaderDefaultVersion {
+				t.Fatalf("compressed message leaked, version %d", msg.header.Version)
+			}
+			if int(msg.header.PackLength)-int(msg.header.HeadLength) != len(msg.Payload()) {
+				t.Fatalf("payload length mismatch: %+v %d", msg.header, len(msg.Payload()))
+			}
+		}
+	})
+}
@@ -0,0 +1,165 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package proto
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"sync/atomic"
+
+	"github.com/andybalholm/brotli"
+	"github.com/pkg/errors"
+)
+
+// Encoder 直播间消息编码器
+// 将多个 Message 打包为一帧, 版本为 2(zlib) 或 3(brotli) 时与 bilibili 下发的压缩帧格式一致
+// 可用于编写本地测试服务或代理
+type Encoder struct {
+	version   uint16
+	operation uint32
+	level     int
+
+	sequence      uint32
+	autoIncrement bool
+}
+
+// NewEncoder 创建编码器
+// version 为 BodyProtocolVersionNormal 时不压缩, 仅将多个 Message 拼接为一帧
+func NewEncoder(version uint16) *Encoder {
+	return &Encoder{
+		version:   version,
+		operation: OperationMessage,
+		level:     -1,
+	}
+}
+
+// WithSequence 设置固定的 sequence, 默认为 0
+func (e *Encoder) WithSequence(sequence uint32) *Encoder {
+	e.sequence = sequence
+	e.autoIncrement = false
+	return e
+}
+
+// WithAutoSequence 每次编码后 sequence 自增, 从 start 开始
+func (e *Encoder) WithAutoSequence(start uint32) *Encoder {
+	e.sequence = start
+	e.autoIncrement = true
+	return e
+}
+
+// WithOperation 设置压缩帧的 operation, 默认为 OperationMessage
+func (e *Encoder) WithOperation(operation uint32) *Encoder {
+	e.operation = operation
+	return e
+}
+
+// WithLevel 设置压缩等级, 小于0时使用默认等级
+// zlib 为 0-9, brotli 为 0-11
+func (e *Encoder) WithLevel(level int) *Encoder {
+	e.level = level
+	return e
+}
+
+func (e *Encoder) nextSequence() uint32 {
+	if e.autoIncrement {
+		return atomic.AddUint32(&e.sequence, 1) - 1
+	}
+	return e.sequence
+}
+
+// Encode 编码为一帧数据
+func (e *Encoder) Encode(messages ...Message) ([]byte, error) {
+	if e.version == BodyProtocolVersionNormal || e.version == HeaderDefaultVersion {
+		if err := checkUncompressed(messages); err != nil {
+			return nil, err
+		}
+
+		var buffer bytes.Buffer
+		for _, message := range messages {
+			buffer.Write(message.ToBytes())
+		}
+		return buffer.Bytes(), nil
+	}
+
+	message, err := e.EncodeMessage(messages...)
+	if err != nil {
+		return nil, err
+	}
+
+	return message.ToBytes(), nil
+}
+
+// EncodeMessage 将多个 Message 压缩为一个 Message
+func (e *Encoder) EncodeMessage(messages ...Message) (Message, error) {
+	if err := checkUncompressed(messages); err != nil {
+		return Message{}, err
+	}
+
+	var buffer bytes.Buffer
+	var writer io.WriteCloser
+	switch e.version {
+	case BodyProtocolVersionZlib:
+		level := e.level
+		if level < 0 {
+			level = zlib.DefaultCompression
+		}
+
+		w, err := zlib.NewWriterLevel(&buffer, level)
+		if err != nil {
+			return Message{}, errors.Wrap(err, "new zlib writer fail")
+		}
+		writer = w
+	case BodyProtocolVersionBrotli:
+		level := e.level
+		if level < 0 {
+			level = brotli.DefaultCompression
+		}
+		writer = brotli.NewWriterLevel(&buffer, level)
+	default:
+		return Message{}, errors.Wrapf(VersionError, "version [%d]", e.version)
+	}
+
+	for _, message := range messages {
+		if _, err := writer.Write(message.ToBytes()); err != nil {
+			return Message{}, errors.Wrap(err, "compress fail")
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return Message{}, errors.Wrap(err, "compress fail")
+	}
+
+	return PackMessageWithVersion(e.version, e.nextSequence(), e.operation, buffer.Bytes()), nil
+}
+
+// checkUncompressed 压缩帧内只能是未压缩的消息
+func checkUncompressed(messages []Message) error {
+	for _, message := range messages {
+		if v := message.Version(); v != BodyProtocolVersionNormal && v != HeaderDefaultVersion {
+			return errors.Wrapf(NestedCompressionError, "version [%d]", v)
+		}
+	}
+	return nil
+}
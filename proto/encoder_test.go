@@ -0,0 +1,93 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package proto
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEncoder_RoundTrip(t *testing.T) {
+	payloads := []string{
+		`{"cmd":"LIVE_OPEN_PLATFORM_DM","data":{"msg":"1"}}`,
+		`{"cmd":"LIVE_OPEN_PLATFORM_DM","data":{"msg":"2"}}`,
+		`{"cmd":"LIVE_OPEN_PLATFORM_LIKE","data":{"like_count":3}}`,
+	}
+
+	messages := make([]Message, 0, len(payloads))
+	for _, payload := range payloads {
+		messages = append(messages, PackMessageWithVersion(BodyProtocolVersionNormal, 0, OperationMessage, []byte(payload)))
+	}
+
+	for _, version := range []uint16{BodyProtocolVersionNormal, BodyProtocolVersionZlib, BodyProtocolVersionBrotli} {
+		encoder := NewEncoder(version).WithAutoSequence(10)
+
+		for i := 0; i < 2; i++ {
+			raw, err := encoder.Encode(messages...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			head, err := UnpackHeader(raw[:PackageHeaderTotalLength])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if version != BodyProtocolVersionNormal {
+				if head.Version != version || head.Sequence != uint32(10+i) || int(head.PackLength) != len(raw) {
+					t.Fatalf("unexpected header %+v, version %d", head, version)
+				}
+			}
+
+			decoded, err := UnpackMessage(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(decoded) != len(payloads) {
+				t.Fatalf("unexpected messages length %d, version %d", len(decoded), version)
+			}
+			for j, msg := range decoded {
+				if string(msg.Payload()) != payloads[j] || msg.Version() != BodyProtocolVersionNormal {
+					t.Fatalf("unexpected message %d: %s, version %d", j, msg.Payload(), version)
+				}
+			}
+		}
+	}
+}
+
+func TestEncoder_Nested(t *testing.T) {
+	inner, err := NewEncoder(BodyProtocolVersionZlib).EncodeMessage(PackMessage(HeaderDefaultSequence, OperationMessage, []byte("{}")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = NewEncoder(BodyProtocolVersionBrotli).Encode(inner); !errors.Is(err, NestedCompressionError) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if _, err = NewEncoder(9).Encode(); !errors.Is(err, VersionError) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -66,3 +66,15 @@ func (message Message) Operation() uint32 {
 func (message Message) Payload() []byte {
 	return message.payload
 }
+
+func (message Message) Header() Header {
+	return message.header
+}
+
+func (message Message) Version() uint16 {
+	return message.header.Version
+}
+
+func (message Message) Sequence() uint32 {
+	return message.header.Sequence
+}
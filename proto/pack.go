@@ -24,12 +24,9 @@
 package proto
 
 import (
-	"bytes"
-	"compress/zlib"
 	"encoding/binary"
 	stderr "errors"
 	"fmt"
-	"io"
 
 	"github.com/pkg/errors"
 )
@@ -45,6 +42,7 @@ const (
 
 	BodyProtocolVersionNormal = 0
 	BodyProtocolVersionZlib   = 2
+	BodyProtocolVersionBrotli = 3
 	HeaderDefaultVersion      = 1
 	HeaderDefaultOperation    = 1
 	HeaderDefaultSequence     = 1
@@ -80,57 +78,9 @@ func UnpackHeader(head []byte) (Header, error) {
 
 // UnpackMessage 解析直播间消息
 // 被压缩的消息是一组 Message, 所以解析完成会返回 []Message 而非 Message
+// 等同于 NewDecoder().Decode(raw), Message.Payload 会引用 raw, 详见 Decoder
 func UnpackMessage(raw []byte) ([]Message, error) {
-	messages := make([]Message, 0, 8)
-
-	if len(raw) <= PackageHeaderTotalLength {
-		return messages, errors.Wrapf(PackLengthError, fmt.Sprintf("packet defect, raw length [%d]", len(raw)))
-	}
-
-	head, err := UnpackHeader(raw[:PackageHeaderTotalLength])
-	if err != nil {
-		return messages, err
-	} else if int(head.PackLength) > len(raw) {
-		return messages, errors.Wrapf(PackLengthError, fmt.Sprintf("packet defect, raw length [%d], expected length is [%d]", len(raw), head.PackLength))
-	}
-
-	// unzlib
-	// see https://open-live.bilibili.com/document/657d8e34-f926-a133-16c0-300c1afc6e6b
-	if head.Version == BodyProtocolVersionZlib {
-		reader, err := zlib.NewReader(bytes.NewReader(raw[PackageHeaderTotalLength:]))
-		if err != nil {
-			return messages, errors.Wrap(err, "new zlib reader fail")
-		}
-
-		if err := reader.Close(); err != nil {
-			return messages, errors.Wrap(err, "close zlib reader fail")
-		}
-
-		if raw, err = io.ReadAll(reader); err != nil {
-			return messages, errors.Wrapf(err, "read zlib fail, raw: %s", raw)
-		}
-	}
-
-	for len(raw) > 0 {
-		head, err = UnpackHeader(raw[:PackageHeaderTotalLength])
-		if err != nil {
-			return messages, err
-		} else if int(head.PackLength) > len(raw) {
-			return messages, errors.Wrapf(PackLengthError, fmt.Sprintf("packet defect, raw length [%d], expected length is [%d]", len(raw), head.PackLength))
-		}
-
-		payload := make([]byte, len(raw[head.HeadLength:head.PackLength]))
-		copy(payload, raw[head.HeadLength:head.PackLength])
-
-		messages = append(messages, Message{
-			header:  head,
-			payload: payload,
-		})
-
-		raw = raw[head.PackLength:]
-	}
-
-	return messages, nil
+	return NewDecoder().Decode(raw)
 }
 
 func PackMessage(sequenceID, operation uint32, raw []byte) Message {
@@ -140,6 +90,18 @@ func PackMessage(sequenceID, operation uint32, raw []byte) Message {
 	}
 }
 
+// PackMessageWithVersion 指定协议版本, 例如推送的消息为 BodyProtocolVersionNormal
+// 压缩帧请使用 Encoder
+func PackMessageWithVersion(version uint16, sequenceID, operation uint32, raw []byte) Message {
+	header := PackHeader(sequenceID, uint32(len(raw)), operation)
+	header.Version = version
+
+	return Message{
+		header:  header,
+		payload: raw,
+	}
+}
+
 func bigEndianUint32(num uint32) []byte {
 	b := make([]byte, 4)
 	binary.BigEndian.PutUint32(b, num)
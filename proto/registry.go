@@ -0,0 +1,113 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package proto
+
+import (
+	"sort"
+	"sync"
+)
+
+// CmdDataFactory 创建 cmd 对应的数据结构, 必须返回结构体指针
+type CmdDataFactory func() interface{}
+
+var cmdRegistry = struct {
+	sync.RWMutex
+	factories map[string]CmdDataFactory
+}{
+	factories: map[string]CmdDataFactory{},
+}
+
+func init() {
+	RegisterCmd(CmdLiveOpenPlatformDanmu, func() interface{} { return &CmdDanmuData{} })
+	RegisterCmd(CmdLiveOpenPlatformSendGift, func() interface{} { return &CmdSendGiftData{} })
+	RegisterCmd(CmdLiveOpenPlatformSuperChat, func() interface{} { return &CmdSuperChatData{} })
+	RegisterCmd(CmdLiveOpenPlatformSuperChatDel, func() interface{} { return &CmdSuperChatDelData{} })
+	RegisterCmd(CmdLiveOpenPlatformGuard, func() interface{} { return &CmdGuardData{} })
+	RegisterCmd(CmdLiveOpenPlatformLike, func() interface{} { return &CmdLikeData{} })
+	RegisterCmd(CmdLiveOpenPlatformRoomEnter, func() interface{} { return &CmdLiveRoomEnterData{} })
+	RegisterCmd(CmdLiveOpenPlatformLiveStart, func() interface{} { return &CmdLiveStartData{} })
+	RegisterCmd(CmdLiveOpenPlatformLiveEnd, func() interface{} { return &CmdLiveEndData{} })
+	RegisterCmd(CmdLiveOpenPlatformInteractionEnd, func() interface{} { return &CmdInteractionEndData{} })
+
+	RegisterCmd(CmdLiveRoomDanmu, func() interface{} { return &CmdDanmuData{} })
+	RegisterCmd(CmdLiveRoomSendGift, func() interface{} { return &CmdSendGiftData{} })
+	RegisterCmd(CmdLiveRoomSuperChat, func() interface{} { return &CmdSuperChatData{} })
+	RegisterCmd(CmdLiveRoomSuperChatDel, func() interface{} { return &CmdSuperChatDelData{} })
+	RegisterCmd(CmdLiveRoomSuperGuard, func() interface{} { return &CmdGuardData{} })
+	RegisterCmd(CmdLiveRoomLike, func() interface{} { return &CmdLikeData{} })
+	RegisterCmd(CmdLiveRoomLiveRoomEnter, func() interface{} { return &CmdLiveRoomEnterData{} })
+	RegisterCmd(CmdLiveRoomLiveStart, func() interface{} { return &CmdLiveStartData{} })
+	RegisterCmd(CmdLiveRoomLiveEnd, func() interface{} { return &CmdLiveEndData{} })
+	RegisterCmd(CmdLiveRoomRoomChange, func() interface{} { return &CmdRoomChangeData{} })
+	RegisterCmd(CmdLiveRoomRoomBlockMsg, func() interface{} { return &CmdRoomBlockMsgData{} })
+	RegisterCmd(CmdLiveRoomInteractWord, func() interface{} { return &CmdInteractWordData{} })
+	RegisterCmd(CmdLiveRoomWarning, func() interface{} { return &CmdWarningData{} })
+	RegisterCmd(CmdLiveRoomInteractionEnd, func() interface{} { return &CmdInteractionEndData{} })
+}
+
+// RegisterCmd 注册 cmd 对应的数据结构, 已注册的 cmd 会被覆盖
+// 可以在 SDK 发版前自行支持新的 cmd, 例如:
+//
+//	proto.RegisterCmd("LIVE_OPEN_PLATFORM_NEW_CMD", func() interface{} { return &NewCmdData{} })
+func RegisterCmd(cmd string, factory CmdDataFactory) {
+	if factory == nil {
+		panic("proto: RegisterCmd factory is nil")
+	}
+
+	cmdRegistry.Lock()
+	defer cmdRegistry.Unlock()
+
+	cmdRegistry.factories[cmd] = factory
+}
+
+// UnregisterCmd 取消注册, 取消后 data 会被解析成 map[string]interface{}
+func UnregisterCmd(cmd string) {
+	cmdRegistry.Lock()
+	defer cmdRegistry.Unlock()
+
+	delete(cmdRegistry.factories, cmd)
+}
+
+// LookupCmd 查询 cmd 对应的数据结构
+func LookupCmd(cmd string) (CmdDataFactory, bool) {
+	cmdRegistry.RLock()
+	defer cmdRegistry.RUnlock()
+
+	factory, ok := cmdRegistry.factories[cmd]
+	return factory, ok
+}
+
+// RegisteredCmds 已注册的 cmd, 按字典序排列
+func RegisteredCmds() []string {
+	cmdRegistry.RLock()
+	defer cmdRegistry.RUnlock()
+
+	cmds := make([]string, 0, len(cmdRegistry.factories))
+	for cmd := range cmdRegistry.factories {
+		cmds = append(cmds, cmd)
+	}
+	sort.Strings(cmds)
+
+	return cmds
+}
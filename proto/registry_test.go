@@ -0,0 +1,98 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package proto
+
+import (
+	"testing"
+)
+
+func TestRegisterCmd(t *testing.T) {
+	type newCmdData struct {
+		Foo string `json:"foo"`
+	}
+
+	const cmdName = "LIVE_OPEN_PLATFORM_TEST_NEW_CMD"
+	payload := []byte(`{"cmd":"LIVE_OPEN_PLATFORM_TEST_NEW_CMD","data":{"foo":"bar"}}`)
+
+	_, data, err := AutomaticParsingMessageCommand(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := data.(map[string]interface{}); !ok {
+		t.Fatalf("unregistered cmd should be parsed as map, got %T", data)
+	}
+
+	RegisterCmd(cmdName, func() interface{} { return &newCmdData{} })
+	defer UnregisterCmd(cmdName)
+
+	cmd, err := ParseCmd(payload, WithKeepRaw())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, ok := cmd.Data.(*newCmdData)
+	if !ok || d.Foo != "bar" {
+		t.Fatalf("unexpected data: %#v", cmd.Data)
+	}
+	if string(cmd.Raw) != `{"foo":"bar"}` {
+		t.Fatalf("unexpected raw: %s", cmd.Raw)
+	}
+}
+
+func TestRegisterCmd_Builtin(t *testing.T) {
+	_, data, err := AutomaticParsingMessageCommand([]byte(`{"cmd":"OPEN_LIVEROOM_DM","data":{"msg":"hi"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, ok := data.(*CmdDanmuData); !ok || d.Msg != "hi" {
+		t.Fatalf("unexpected data: %#v", data)
+	}
+
+	cmd, err := ParseCmd([]byte(`{"cmd":"OPEN_LIVEROOM_DM","data":{"msg":"hi"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.Raw != nil {
+		t.Fatalf("raw should be empty without WithKeepRaw")
+	}
+}
+
+func TestParseCmd_UnregisteredNonObject(t *testing.T) {
+	cmd, err := ParseCmd([]byte(`{"cmd":"LIVE_OPEN_PLATFORM_TEST_UNKNOWN","data":[1,"a",{"b":2}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	arr, ok := cmd.Data.([]interface{})
+	if !ok || len(arr) != 3 {
+		t.Fatalf("unexpected data: %#v", cmd.Data)
+	}
+
+	cmd, err = ParseCmd([]byte(`{"cmd":"LIVE_OPEN_PLATFORM_TEST_UNKNOWN","data":"hi"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, ok := cmd.Data.(string); !ok || s != "hi" {
+		t.Fatalf("unexpected data: %#v", cmd.Data)
+	}
+}
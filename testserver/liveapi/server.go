@@ -0,0 +1,496 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+// Package liveapi
+//
+// 本地的 live-open.biliapi.com 替身
+// 实现 /v2/app/start, /v2/app/end, /v2/app/heartbeat, /v2/app/batchHeartbeat
+// 使用 live.CommonHeader 校验签名与 content md5, 记录场次状态并返回与线上一致的错误码
+// 配合 testserver.Server 可以离线完成互动玩法的集成测试
+package liveapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vtb-link/bianka/basic"
+	"github.com/vtb-link/bianka/live"
+	"github.com/vtb-link/bianka/testserver"
+)
+
+const (
+	// DefaultHeartbeatTimeout 超过该时间没有心跳, 场次失效
+	DefaultHeartbeatTimeout = time.Second * 60
+	// DefaultTimestampSkew 请求时间戳允许的误差
+	DefaultTimestampSkew = time.Minute * 10
+	// BatchHeartbeatMaxSize 批量心跳的最大数量
+	BatchHeartbeatMaxSize = 200
+)
+
+// Game 场次
+type Game struct {
+	GameID        string
+	Code          string
+	AuthBody      string
+	Anchor        live.AnchorInfo
+	StartedAt     time.Time
+	LastHeartbeat time.Time
+	EndedAt       time.Time // 未结束为零值
+}
+
+// Running 场次是否有效
+func (g Game) Running() bool {
+	return g.EndedAt.IsZero()
+}
+
+type nonceEntry struct {
+	contentMD5 string
+	resp       []byte
+	done       chan struct{} // 首个请求处理完毕后关闭, 之后 resp 可读
+}
+
+// Server 开放平台接口替身
+type Server struct {
+	httpServer *httptest.Server
+
+	accessKey       string
+	accessKeySecret string
+	appID           int64
+
+	mu               sync.Mutex
+	ws               *testserver.Server
+	heartbeatTimeout time.Duration
+	timestampSkew    time.Duration
+	anchors          map[string]live.AnchorInfo
+	games            map[string]*Game
+	nonces           map[string]*nonceEntry
+	gameSeq          int
+	requests         int
+}
+
+// NewServer 创建并启动服务, 使用完毕后需要调用 Close
+func NewServer(accessKey, accessKeySecret string, appID int64) *Server {
+	s := &Server{
+		accessKey:       accessKey,
+		accessKeySecret: accessKeySecret,
+		appID:           appID,
+
+		heartbeatTimeout: DefaultHeartbeatTimeout,
+		timestampSkew:    DefaultTimestampSkew,
+		anchors:          map[string]live.AnchorInfo{},
+		games:            map[string]*Game{},
+		nonces:           map[string]*nonceEntry{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/app/start", s.handle(s.appStart))
+	mux.HandleFunc("/v2/app/end", s.handle(s.appEnd))
+	mux.HandleFunc("/v2/app/heartbeat", s.handle(s.appHeartbeat))
+	mux.HandleFunc("/v2/app/batchHeartbeat", s.handle(s.appBatchHeartbeat))
+	s.httpServer = httptest.NewServer(mux)
+
+	return s
+}
+
+// WithWebsocket 使用 testserver.Server 作为长连接服务
+// AppStart 返回的 wss_link 指向 ws, 且 ws 只接受有效场次的 auth_body
+func (s *Server) WithWebsocket(ws *testserver.Server) *Server {
+	s.mu.Lock()
+	s.ws = ws
+	s.mu.Unlock()
+
+	ws.WithAuthValidator(s.validAuthBody)
+	return s
+}
+
+// WithHeartbeatTimeout 设置场次的心跳超时时间
+func (s *Server) WithHeartbeatTimeout(timeout time.Duration) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.heartbeatTimeout = timeout
+	return s
+}
+
+// WithTimestampSkew 设置请求时间戳允许的误差
+func (s *Server) WithTimestampSkew(skew time.Duration) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.timestampSkew = skew
+	return s
+}
+
+// AddCode 添加一个有效的主播身份码
+func (s *Server) AddCode(code string, anchor live.AnchorInfo) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.anchors[code] = anchor
+	return s
+}
+
+// URL 接口地址, 用于 live.Config.OpenPlatformHttpHost
+func (s *Server) URL() string {
+	return s.httpServer.URL
+}
+
+// Config 返回指向本服务的 live.Config
+func (s *Server) Config() *live.Config {
+	cfg := live.NewConfig(s.accessKey, s.accessKeySecret, s.appID)
+	cfg.OpenPlatformHttpHost = s.URL()
+	return cfg
+}
+
+// Client 返回指向本服务的 live.Client
+func (s *Server) Client() *live.Client {
+	return live.NewClient(s.Config())
+}
+
+// Close 关闭服务
+func (s *Server) Close() {
+	s.httpServer.Close()
+}
+
+// Game 查询场次
+func (s *Server) Game(gameID string) (Game, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	game, ok := s.games[gameID]
+	if !ok {
+		return Game{}, false
+	}
+
+	s.expire(game, time.Now())
+	return *game, true
+}
+
+// Games 所有场次, 按 GameID 排序
+func (s *Server) Games() []Game {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	games := make([]Game, 0, len(s.games))
+	for _, game := range s.games {
+		s.expire(game, now)
+		games = append(games, *game)
+	}
+
+	sort.Slice(games, func(i, j int) bool {
+		return games[i].GameID < games[j].GameID
+	})
+	return games
+}
+
+// ExpireGame 使场次失效, 模拟心跳超时
+func (s *Server) ExpireGame(gameID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if game, ok := s.games[gameID]; ok && game.Running() {
+		game.EndedAt = time.Now()
+	}
+}
+
+// Requests 签名校验通过的请求次数, 不包含重放的请求
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests
+}
+
+// handle 校验签名, 处理 nonce 幂等后交给 fn
+func (s *Server) handle(fn func(body []byte) *live.BaseResp) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			s.write(w, failResp(live.CodeInvalidParams, "method not allowed"))
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			s.write(w, failResp(live.CodeInvalidParams, "read body fail"))
+			return
+		}
+
+		header := &live.CommonHeader{
+			Timestamp:        r.Header.Get(live.BiliTimestampHeader),
+			SignatureMethod:  r.Header.Get(live.BiliSignatureMethodHeader),
+			SignatureVersion: r.Header.Get(live.BiliSignVersionHeader),
+			Nonce:            r.Header.Get(live.BiliSignatureNonceHeader),
+			AccessKeyID:      r.Header.Get(live.BiliAccessKeyIdHeader),
+			ContentMD5:       r.Header.Get(live.BiliContentMD5Header),
+			Authorization:    r.Header.Get(live.AuthorizationHeader),
+		}
+
+		if resp := s.verify(header, body); resp != nil {
+			s.write(w, resp)
+			return
+		}
+
+		// 检查与占用 nonce 需要在同一把锁内完成, 避免并发的相同 nonce 都被处理
+		s.mu.Lock()
+		if entry, ok := s.nonces[header.Nonce]; ok {
+			s.mu.Unlock()
+
+			// 相同的 nonce 与内容视为重试, 等待首个请求完成后返回相同的结果
+			if entry.contentMD5 == header.ContentMD5 {
+				<-entry.done
+				w.Header().Set(live.ContentTypeHeader, live.JsonType)
+				_, _ = w.Write(entry.resp)
+				return
+			}
+
+			s.write(w, failResp(live.CodeDuplicateRequest, "duplicate nonce"))
+			return
+		}
+		entry := &nonceEntry{contentMD5: header.ContentMD5, done: make(chan struct{})}
+		s.nonces[header.Nonce] = entry
+		s.requests++
+		s.mu.Unlock()
+
+		entry.resp = s.write(w, fn(body))
+		close(entry.done)
+	}
+}
+
+// verify 校验公共请求头, 通过时返回nil
+func (s *Server) verify(header *live.CommonHeader, body []byte) *live.BaseResp {
+	if header.Timestamp == "" || header.Nonce == "" || header.AccessKeyID == "" || header.ContentMD5 == "" || header.Authorization == "" {
+		return failResp(live.CodeInvalidParams, "missing x-bili-* header")
+	}
+
+	if header.SignatureMethod != live.HmacSha256 || header.SignatureVersion != live.BiliVersion {
+		return failResp(live.CodeInvalidSignature, "unsupported signature method or version")
+	}
+
+	if header.AccessKeyID != s.accessKey {
+		return failResp(live.CodeInvalidSignature, "invalid access key")
+	}
+
+	ts, err := strconv.ParseInt(header.Timestamp, 10, 64)
+	if err != nil {
+		return failResp(live.CodeInvalidParams, "invalid timestamp")
+	}
+
+	s.mu.Lock()
+	skew := s.timestampSkew
+	s.mu.Unlock()
+
+	if d := time.Since(time.Unix(ts, 0)); d > skew || d < -skew {
+		return failResp(live.CodeRequestExpired, "request expired")
+	}
+
+	if live.Md5(string(body)) != header.ContentMD5 {
+		return failResp(live.CodeInvalidSignature, "content md5 mismatch")
+	}
+
+	if header.CreateSignature(s.accessKeySecret) != header.Authorization {
+		return failResp(live.CodeInvalidSignature, "signature mismatch")
+	}
+
+	return nil
+}
+
+func (s *Server) appStart(body []byte) *live.BaseResp {
+	var req live.AppStartRequest
+	if err := json.Unmarshal(body, &req); err != nil || req.Code == "" {
+		return failResp(live.CodeInvalidParams, "invalid params")
+	}
+
+	if req.AppID != s.appID {
+		return failResp(live.CodeInvalidApp, "invalid app id")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	anchor, ok := s.anchors[req.Code]
+	if !ok {
+		return failResp(live.CodeInvalidCode, "invalid code")
+	}
+
+	now := time.Now()
+	for _, game := range s.games {
+		s.expire(game, now)
+		if game.Code == req.Code && game.Running() {
+			return failResp(live.CodeGameAlreadyStarted, "game already started")
+		}
+	}
+
+	s.gameSeq++
+	game := &Game{
+		GameID:        fmt.Sprintf("game-%d", s.gameSeq),
+		Code:          req.Code,
+		Anchor:        anchor,
+		StartedAt:     now,
+		LastHeartbeat: now,
+	}
+	game.AuthBody = fmt.Sprintf(`{"game_id":%q,"room_id":%d}`, game.GameID, anchor.RoomID)
+	s.games[game.GameID] = game
+
+	var links []string
+	if s.ws != nil {
+		links = []string{s.ws.URL()}
+	}
+
+	return successResp(&live.AppStartResponse{
+		AnchorInfo: anchor,
+		GameInfo:   live.GameInfo{GameID: game.GameID},
+		WebsocketInfo: live.WebSocketInfo{
+			AuthBody: game.AuthBody,
+			WssLink:  links,
+		},
+	})
+}
+
+func (s *Server) appEnd(body []byte) *live.BaseResp {
+	var req live.AppEndRequest
+	if err := json.Unmarshal(body, &req); err != nil || req.GameID == "" {
+		return failResp(live.CodeInvalidParams, "invalid params")
+	}
+
+	if req.AppID != s.appID {
+		return failResp(live.CodeInvalidApp, "invalid app id")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	game, ok := s.runningGame(req.GameID)
+	if !ok {
+		return failResp(live.CodeGameIDInvalid, "game id invalid")
+	}
+
+	game.EndedAt = time.Now()
+	return successResp(struct{}{})
+}
+
+func (s *Server) appHeartbeat(body []byte) *live.BaseResp {
+	var req live.AppHeartbeatRequest
+	if err := json.Unmarshal(body, &req); err != nil || req.GameID == "" {
+		return failResp(live.CodeInvalidParams, "invalid params")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	game, ok := s.runningGame(req.GameID)
+	if !ok {
+		return failResp(live.CodeGameIDInvalid, "game id invalid")
+	}
+
+	game.LastHeartbeat = time.Now()
+	return successResp(struct{}{})
+}
+
+func (s *Server) appBatchHeartbeat(body []byte) *live.BaseResp {
+	var req live.AppBatchHeartbeatRequest
+	if err := json.Unmarshal(body, &req); err != nil || len(req.GameIDs) == 0 || len(req.GameIDs) > BatchHeartbeatMaxSize {
+		return failResp(live.CodeInvalidParams, "invalid params")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	failed := make([]string, 0)
+	for _, gameID := range req.GameIDs {
+		game, ok := s.runningGame(gameID)
+		if !ok {
+			failed = append(failed, gameID)
+			continue
+		}
+		game.LastHeartbeat = time.Now()
+	}
+
+	return successResp(&live.AppBatchHeartbeatResponse{FailedGameIds: failed})
+}
+
+// runningGame 查询有效的场次, 需要持有锁
+func (s *Server) runningGame(gameID string) (*Game, bool) {
+	game, ok := s.games[gameID]
+	if !ok {
+		return nil, false
+	}
+
+	s.expire(game, time.Now())
+	return game, game.Running()
+}
+
+// expire 心跳超时的场次标记为结束, 需要持有锁
+func (s *Server) expire(game *Game, now time.Time) {
+	if game.Running() && s.heartbeatTimeout > 0 && now.Sub(game.LastHeartbeat) > s.heartbeatTimeout {
+		game.EndedAt = game.LastHeartbeat.Add(s.heartbeatTimeout)
+	}
+}
+
+// validAuthBody 长连接只接受有效场次的 auth_body
+func (s *Server) validAuthBody(body []byte) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, game := range s.games {
+		if game.AuthBody == string(body) {
+			s.expire(game, time.Now())
+			return game.Running()
+		}
+	}
+	return false
+}
+
+func (s *Server) write(w http.ResponseWriter, resp *live.BaseResp) []byte {
+	resp.RequestID = basic.RandStringBytes(16)
+	raw, _ := json.Marshal(resp)
+
+	w.Header().Set(live.ContentTypeHeader, live.JsonType)
+	_, _ = io.Copy(w, bytes.NewReader(raw))
+	return raw
+}
+
+func successResp(data interface{}) *live.BaseResp {
+	raw, _ := json.Marshal(data)
+	return &live.BaseResp{
+		Code:    0,
+		Message: "0",
+		Data:    raw,
+	}
+}
+
+func failResp(code int64, message string) *live.BaseResp {
+	return &live.BaseResp{
+		Code:    code,
+		Message: message,
+		Data:    json.RawMessage("{}"),
+	}
+}
@@ -0,0 +1,326 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package liveapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vtb-link/bianka/basic"
+	"github.com/vtb-link/bianka/live"
+	"github.com/vtb-link/bianka/proto"
+	"github.com/vtb-link/bianka/testserver"
+	"github.com/vtb-link/bianka/testserver/liveapi"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	testAccessKey = "access-key"
+	testSecret    = "secret"
+	testAppID     = 1
+	testCode      = "code"
+)
+
+func newTestServer(t *testing.T) *liveapi.Server {
+	srv := liveapi.NewServer(testAccessKey, testSecret, testAppID).
+		AddCode(testCode, live.AnchorInfo{RoomID: 100, Uname: "anchor", Uid: 1})
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func respCode(t *testing.T, resp *live.BaseResp, err error) int64 {
+	t.Helper()
+
+	if resp == nil {
+		t.Fatalf("unexpected nil response, err: %v", err)
+	}
+	if (resp.Code == 0) != (err == nil) {
+		t.Fatalf("unexpected error %v for code %d", err, resp.Code)
+	}
+	return resp.Code
+}
+
+func TestServer_Lifecycle(t *testing.T) {
+	ws := testserver.NewServer()
+	defer ws.Close()
+
+	srv := newTestServer(t).WithWebsocket(ws)
+	client := srv.Client()
+
+	startResp, err := client.AppStart(testCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if startResp.AnchorInfo.RoomID != 100 || startResp.GameInfo.GameID == "" || len(startResp.GetLinks()) != 1 {
+		t.Fatalf("unexpected start resp %+v", startResp)
+	}
+
+	// 长连接只接受有效场次的 auth_body
+	danmu := make(chan string, 1)
+	router := basic.NewEventRouter().OnDanmu(func(data *proto.CmdDanmuData) { danmu <- data.Msg })
+	wsClient, err := basic.StartWebsocket(startResp, router.DispatcherHandleMap(), nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wsClient.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if _, err = ws.WaitConn(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ws.PushDanmu(&proto.CmdDanmuData{Msg: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if msg := <-danmu; msg != "hello" {
+		t.Fatalf("unexpected danmu %s", msg)
+	}
+
+	if err = client.AppHeartbeat(startResp.GameInfo.GameID); err != nil {
+		t.Fatal(err)
+	}
+
+	batchResp, err := client.AppBatchHeartbeat([]string{startResp.GameInfo.GameID, "game-unknown"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batchResp.FailedGameIds) != 1 || batchResp.FailedGameIds[0] != "game-unknown" {
+		t.Fatalf("unexpected failed game ids %v", batchResp.FailedGameIds)
+	}
+
+	// 同一个身份码重复启动
+	_, err = client.AppStart(testCode)
+	if !errors.Is(err, live.ErrGameAlreadyStarted) || !errors.Is(err, live.BilibiliResponseNotSuccess) {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	var apiErr *live.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != live.CodeGameAlreadyStarted || apiErr.Endpoint != "/v2/app/start" || apiErr.RequestID == "" {
+		t.Fatalf("unexpected api error %+v", apiErr)
+	}
+
+	if err = client.AppEnd(startResp.GameInfo.GameID); err != nil {
+		t.Fatal(err)
+	}
+
+	game, ok := srv.Game(startResp.GameInfo.GameID)
+	if !ok || game.Running() {
+		t.Fatalf("game should be ended, %+v", game)
+	}
+
+	resp, err := client.DoRequest(`{"game_id":"`+startResp.GameInfo.GameID+`"}`, "/v2/app/heartbeat", "nonce-after-end")
+	if code := respCode(t, resp, err); code != live.CodeGameIDInvalid {
+		t.Fatalf("unexpected code %d", code)
+	}
+
+	// 已结束的场次不能再建立长连接
+	closeCh := make(chan int, 1)
+	ended, err := basic.StartWebsocket(startResp, nil, func(_ *basic.WsClient, _ basic.StartResp, closeType int) {
+		closeCh <- closeType
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ended.Close()
+
+	select {
+	case closeType := <-closeCh:
+		if closeType != basic.CloseAuthFailed {
+			t.Fatalf("unexpected close type %d", closeType)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("wait close timeout")
+	}
+}
+
+func TestServer_Codes(t *testing.T) {
+	srv := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		client *live.Client
+		body   string
+		path   string
+		code   int64
+	}{
+		{
+			name:   "invalid code",
+			client: srv.Client(),
+			body:   `{"code":"unknown","app_id":1}`,
+			path:   "/v2/app/start",
+			code:   live.CodeInvalidCode,
+		},
+		{
+			name:   "invalid app",
+			client: srv.Client(),
+			body:   `{"code":"code","app_id":2}`,
+			path:   "/v2/app/start",
+			code:   live.CodeInvalidApp,
+		},
+		{
+			name:   "invalid params",
+			client: srv.Client(),
+			body:   `{"game_id":""}`,
+			path:   "/v2/app/heartbeat",
+			code:   live.CodeInvalidParams,
+		},
+		{
+			name:   "invalid signature",
+			client: live.NewClient(&live.Config{AccessKey: testAccessKey, AccessKeySecret: "wrong", OpenPlatformHttpHost: srv.URL(), AppID: testAppID}),
+			body:   `{"game_id":"game-1"}`,
+			path:   "/v2/app/heartbeat",
+			code:   live.CodeInvalidSignature,
+		},
+		{
+			name:   "invalid access key",
+			client: live.NewClient(&live.Config{AccessKey: "wrong", AccessKeySecret: testSecret, OpenPlatformHttpHost: srv.URL(), AppID: testAppID}),
+			body:   `{"game_id":"game-1"}`,
+			path:   "/v2/app/heartbeat",
+			code:   live.CodeInvalidSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.client.DoRequest(tt.body, tt.path, "nonce-"+tt.name)
+			if code := respCode(t, resp, err); code != tt.code {
+				t.Fatalf("unexpected code %d, expected %d", code, tt.code)
+			}
+		})
+	}
+}
+
+func TestServer_RequestExpired(t *testing.T) {
+	srv := newTestServer(t).WithTimestampSkew(-time.Second)
+
+	resp, err := srv.Client().DoRequest(`{"game_id":"game-1"}`, "/v2/app/heartbeat", "nonce")
+	if code := respCode(t, resp, err); code != live.CodeRequestExpired {
+		t.Fatalf("unexpected code %d", code)
+	}
+}
+
+func TestServer_Nonce(t *testing.T) {
+	srv := newTestServer(t)
+	client := srv.Client()
+
+	body := `{"code":"code","app_id":1}`
+	first, err := client.DoRequest(body, "/v2/app/start", "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 相同 nonce 与内容的重试返回相同结果, 不会重复启动
+	second, err := client.DoRequest(body, "/v2/app/start", "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var a, b live.AppStartResponse
+	_ = json.Unmarshal(first.Data, &a)
+	_ = json.Unmarshal(second.Data, &b)
+	if a.GameInfo.GameID == "" || a.GameInfo.GameID != b.GameInfo.GameID || first.RequestID != second.RequestID {
+		t.Fatalf("retry should replay the response, %s %s", first.Data, second.Data)
+	}
+
+	if games := srv.Games(); len(games) != 1 || srv.Requests() != 1 {
+		t.Fatalf("unexpected games %v", games)
+	}
+
+	// 相同 nonce 不同内容
+	resp, err := client.DoRequest(`{"game_id":"`+a.GameInfo.GameID+`"}`, "/v2/app/heartbeat", "nonce")
+	if code := respCode(t, resp, err); code != live.CodeDuplicateRequest {
+		t.Fatalf("unexpected code %d", code)
+	}
+}
+
+func TestServer_NonceConcurrent(t *testing.T) {
+	srv := newTestServer(t)
+	client := srv.Client()
+
+	body := `{"code":"code","app_id":1}`
+	gameIDs := make(chan string, 8)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(gameIDs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			resp, err := client.DoRequest(body, "/v2/app/start", "nonce")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			var startResp live.AppStartResponse
+			_ = json.Unmarshal(resp.Data, &startResp)
+			gameIDs <- startResp.GameInfo.GameID
+		}()
+	}
+	wg.Wait()
+	close(gameIDs)
+
+	first := ""
+	for gameID := range gameIDs {
+		if first == "" {
+			first = gameID
+		}
+		if gameID == "" || gameID != first {
+			t.Fatalf("concurrent retries should replay the same response, got %s and %s", first, gameID)
+		}
+	}
+
+	if games := srv.Games(); len(games) != 1 || srv.Requests() != 1 {
+		t.Fatalf("unexpected games %v, requests %d", games, srv.Requests())
+	}
+}
+
+func TestServer_HeartbeatTimeout(t *testing.T) {
+	srv := newTestServer(t).WithHeartbeatTimeout(time.Millisecond * 50)
+	client := srv.Client()
+
+	startResp, err := client.AppStart(testCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Millisecond * 100)
+
+	resp, err := client.DoRequest(`{"game_id":"`+startResp.GameInfo.GameID+`"}`, "/v2/app/heartbeat", "nonce")
+	if code := respCode(t, resp, err); code != live.CodeGameIDInvalid {
+		t.Fatalf("unexpected code %d", code)
+	}
+
+	// 超时后可以重新启动
+	if _, err = client.AppStart(testCode); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,463 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+// Package testserver
+//
+// 本地的 bilibili 直播长连接服务, 用于在没有身份码的情况下测试机器人
+// 使用与线上一致的 proto 协议, 通过 Server.StartResp 可以直接传入 basic.StartWebsocket / basic.NewWsClient
+// 仅依赖 proto, 所以 basic 等包的测试中也可以使用
+package testserver
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/vtb-link/bianka/proto"
+)
+
+const (
+	// AuthFailedCode 鉴权失败时回包的 code
+	AuthFailedCode = -101
+	// DefaultPopularity 心跳回包中的人气值
+	DefaultPopularity = 1
+
+	authFailedWait = time.Second * 5
+)
+
+// ErrServerClosed 服务已关闭
+var ErrServerClosed = errors.New("test server closed")
+
+// StartResp 实现 basic.StartResp
+type StartResp struct {
+	AuthBody string
+	Links    []string
+}
+
+func (r *StartResp) GetAuthBody() []byte {
+	return []byte(r.AuthBody)
+}
+
+func (r *StartResp) GetLinks() []string {
+	return r.Links
+}
+
+// Server 本地长连接服务
+type Server struct {
+	httpServer *httptest.Server
+	upgrader   websocket.Upgrader
+
+	mu            sync.Mutex
+	authValidator func(body []byte) bool
+	issued        map[string]struct{} // StartResp 签发的鉴权内容
+	failAuth      int                 // 接下来鉴权失败的次数
+	compression   uint16
+	popularity    uint32
+	conns         map[*Conn]struct{}
+	authBodies    []string
+	heartbeats    int
+	closed        bool
+
+	authed chan *Conn
+}
+
+// NewServer 创建并启动服务, 使用完毕后需要调用 Close
+func NewServer() *Server {
+	s := &Server{
+		compression: proto.BodyProtocolVersionNormal,
+		popularity:  DefaultPopularity,
+		conns:       map[*Conn]struct{}{},
+		issued:      map[string]struct{}{},
+		authed:      make(chan *Conn, 64),
+	}
+	s.httpServer = httptest.NewServer(http.HandlerFunc(s.serve))
+
+	return s
+}
+
+// WithAuthBody 只接受指定的鉴权内容, 默认只接受 StartResp 签发的鉴权内容
+func (s *Server) WithAuthBody(authBodies ...string) *Server {
+	return s.WithAuthValidator(func(body []byte) bool {
+		for _, authBody := range authBodies {
+			if string(body) == authBody {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// WithAuthValidator 自定义鉴权
+func (s *Server) WithAuthValidator(validator func(body []byte) bool) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.authValidator = validator
+	return s
+}
+
+// WithCompression 推送消息使用的协议版本, 支持 0(不压缩), 2(zlib), 3(brotli)
+func (s *Server) WithCompression(version uint16) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.compression = version
+	return s
+}
+
+// WithPopularity 心跳回包中的人气值
+func (s *Server) WithPopularity(popularity uint32) *Server {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.popularity = popularity
+	return s
+}
+
+// FailAuth 接下来的 n 次鉴权直接失败
+func (s *Server) FailAuth(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failAuth = n
+}
+
+// URL 长连接地址
+func (s *Server) URL() string {
+	return "ws" + strings.TrimPrefix(s.httpServer.URL, "http")
+}
+
+// StartResp 返回指向本服务的 StartResp
+// 未设置 WithAuthBody / WithAuthValidator 时, 只有这里签发过的 authBody 可以鉴权成功
+func (s *Server) StartResp(authBody string) *StartResp {
+	s.mu.Lock()
+	s.issued[authBody] = struct{}{}
+	s.mu.Unlock()
+
+	return &StartResp{
+		AuthBody: authBody,
+		Links:    []string{s.URL()},
+	}
+}
+
+// Close 关闭服务以及所有链接
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	s.DropConnections()
+	s.httpServer.Close()
+}
+
+// AuthBodies 收到的鉴权内容, 包含鉴权失败的
+func (s *Server) AuthBodies() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.authBodies...)
+}
+
+// Heartbeats 收到的心跳次数
+func (s *Server) Heartbeats() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.heartbeats
+}
+
+// Conns 当前鉴权成功的链接
+func (s *Server) Conns() []*Conn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conns := make([]*Conn, 0, len(s.conns))
+	for conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// WaitConn 等待下一个鉴权成功的链接
+func (s *Server) WaitConn(ctx context.Context) (*Conn, error) {
+	select {
+	case conn := <-s.authed:
+		return conn, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Push 向所有鉴权成功的链接推送消息
+func (s *Server) Push(cmd string, data interface{}) error {
+	payload, err := json.Marshal(proto.Cmd{Cmd: cmd, Data: data})
+	if err != nil {
+		return errors.Wrap(err, "json marshal fail")
+	}
+
+	return s.PushRaw(payload)
+}
+
+// PushRaw 向所有鉴权成功的链接推送原始消息, payload 为 {"cmd":"xxx","data":{}}
+func (s *Server) PushRaw(payload []byte) error {
+	var errs []error
+	for _, conn := range s.Conns() {
+		if err := conn.PushRaw(payload); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Wrapf(errs[0], "push fail, %d conns", len(errs))
+	}
+	return nil
+}
+
+// PushDanmu 推送弹幕
+func (s *Server) PushDanmu(data *proto.CmdDanmuData) error {
+	return s.Push(proto.CmdLiveOpenPlatformDanmu, data)
+}
+
+// PushGift 推送礼物
+func (s *Server) PushGift(data *proto.CmdSendGiftData) error {
+	return s.Push(proto.CmdLiveOpenPlatformSendGift, data)
+}
+
+// PushSuperChat 推送SC
+func (s *Server) PushSuperChat(data *proto.CmdSuperChatData) error {
+	return s.Push(proto.CmdLiveOpenPlatformSuperChat, data)
+}
+
+// PushGuard 推送付费大航海
+func (s *Server) PushGuard(data *proto.CmdGuardData) error {
+	return s.Push(proto.CmdLiveOpenPlatformGuard, data)
+}
+
+// PushInteractionEnd 推送消息推送结束通知
+func (s *Server) PushInteractionEnd(data *proto.CmdInteractionEndData) error {
+	return s.Push(proto.CmdLiveOpenPlatformInteractionEnd, data)
+}
+
+// DropConnections 不发送关闭帧直接断开所有链接, 模拟网络异常
+func (s *Server) DropConnections() {
+	for _, conn := range s.Conns() {
+		conn.Drop()
+	}
+}
+
+// CloseConnections 向所有链接发送关闭帧后断开
+func (s *Server) CloseConnections(code int, text string) {
+	for _, conn := range s.Conns() {
+		_ = conn.Close(code, text)
+	}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	conn := &Conn{server: s, ws: ws}
+	defer conn.Drop()
+
+	if !conn.auth() {
+		return
+	}
+
+	// 先登记再回包, 保证客户端收到鉴权成功后 Push 能推送到该链接
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.conns[conn] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+
+	if err = conn.write(proto.PackMessage(proto.HeaderDefaultSequence, proto.OperationUserAuthenticationReply, []byte(`{"code":0}`)).ToBytes()); err != nil {
+		return
+	}
+
+	select {
+	case s.authed <- conn:
+	default:
+	}
+
+	conn.readLoop()
+}
+
+// checkAuth 校验鉴权内容并记录
+func (s *Server) checkAuth(body []byte) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.authBodies = append(s.authBodies, string(body))
+	if s.failAuth > 0 {
+		s.failAuth--
+		return false
+	}
+
+	if s.authValidator != nil {
+		return s.authValidator(body)
+	}
+
+	_, ok := s.issued[string(body)]
+	return len(body) > 0 && ok
+}
+
+// Conn 一个鉴权成功的长连接
+type Conn struct {
+	server *Server
+	ws     *websocket.Conn
+
+	writeMu  sync.Mutex
+	authBody string
+	dropOnce sync.Once
+}
+
+// AuthBody 鉴权内容
+func (c *Conn) AuthBody() string {
+	return c.authBody
+}
+
+// Push 推送消息
+func (c *Conn) Push(cmd string, data interface{}) error {
+	payload, err := json.Marshal(proto.Cmd{Cmd: cmd, Data: data})
+	if err != nil {
+		return errors.Wrap(err, "json marshal fail")
+	}
+
+	return c.PushRaw(payload)
+}
+
+// PushRaw 推送原始消息, 按照 Server.WithCompression 的版本打包
+func (c *Conn) PushRaw(payload []byte) error {
+	c.server.mu.Lock()
+	version := c.server.compression
+	c.server.mu.Unlock()
+
+	raw, err := proto.NewEncoder(version).Encode(proto.PackMessageWithVersion(proto.BodyProtocolVersionNormal, 0, proto.OperationMessage, payload))
+	if err != nil {
+		return err
+	}
+
+	return c.write(raw)
+}
+
+// Drop 不发送关闭帧直接断开
+func (c *Conn) Drop() {
+	c.dropOnce.Do(func() {
+		_ = c.ws.UnderlyingConn().Close()
+	})
+}
+
+// Close 发送关闭帧后断开
+func (c *Conn) Close(code int, text string) error {
+	c.writeMu.Lock()
+	err := c.ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, text))
+	c.writeMu.Unlock()
+
+	c.Drop()
+	return err
+}
+
+func (c *Conn) write(raw []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	return errors.Wrap(c.ws.WriteMessage(websocket.BinaryMessage, raw), "write message fail")
+}
+
+// auth 第一个包必须是鉴权包, 鉴权失败时回包
+func (c *Conn) auth() bool {
+	_, buf, err := c.ws.ReadMessage()
+	if err != nil {
+		return false
+	}
+
+	msgList, err := proto.UnpackMessage(buf)
+	if err != nil || len(msgList) != 1 || msgList[0].Operation() != proto.OperationUserAuthentication {
+		return false
+	}
+
+	body := msgList[0].Payload()
+	if !c.server.checkAuth(body) {
+		reply, _ := json.Marshal(proto.CmdAuthData{Code: AuthFailedCode})
+		_ = c.write(proto.PackMessage(proto.HeaderDefaultSequence, proto.OperationUserAuthenticationReply, reply).ToBytes())
+
+		// 等待客户端处理回包后主动关闭, 避免客户端先读到断开
+		_ = c.ws.SetReadDeadline(time.Now().Add(authFailedWait))
+		for {
+			if _, _, err = c.ws.ReadMessage(); err != nil {
+				return false
+			}
+		}
+	}
+
+	c.authBody = string(body)
+	return true
+}
+
+func (c *Conn) readLoop() {
+	for {
+		_, buf, err := c.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		msgList, err := proto.UnpackMessage(buf)
+		if err != nil {
+			continue
+		}
+
+		for _, msg := range msgList {
+			if msg.Operation() != proto.OperationHeartbeat {
+				continue
+			}
+
+			c.server.mu.Lock()
+			c.server.heartbeats++
+			popularity := c.server.popularity
+			c.server.mu.Unlock()
+
+			reply := make([]byte, 4)
+			binary.BigEndian.PutUint32(reply, popularity)
+			if err = c.write(proto.PackMessage(msg.Sequence(), proto.OperationHeartbeatReply, reply).ToBytes()); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,204 @@
+/*
+ * MIT License
+ *
+ * Copyright (c) 2024 VTB-LINK and runstp.
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS," WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+ * FOR A PARTICULAR PURPOSE, AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS
+ * OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES, OR OTHER LIABILITY,
+ * WHETHER IN AN ACTION OF CONTRACT, TORT, OR OTHERWISE, ARISING FROM, OUT OF,
+ * OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+ */
+
+package testserver_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/vtb-link/bianka/basic"
+	"github.com/vtb-link/bianka/proto"
+	"github.com/vtb-link/bianka/testserver"
+	"golang.org/x/exp/slog"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func startClient(t *testing.T, srv *testserver.Server, authBody string, router *basic.EventRouter) (*basic.WsClient, <-chan int) {
+	t.Helper()
+
+	closeCh := make(chan int, 1)
+	wsClient, err := basic.StartWebsocket(srv.StartResp(authBody), router.DispatcherHandleMap(), func(_ *basic.WsClient, _ basic.StartResp, closeType int) {
+		closeCh <- closeType
+	}, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = wsClient.Close() })
+
+	return wsClient, closeCh
+}
+
+func waitConn(t *testing.T, srv *testserver.Server) *testserver.Conn {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	conn, err := srv.WaitConn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func waitClose(t *testing.T, closeCh <-chan int) int {
+	t.Helper()
+
+	select {
+	case closeType := <-closeCh:
+		return closeType
+	case <-time.After(time.Second * 5):
+		t.Fatal("wait close timeout")
+		return 0
+	}
+}
+
+func TestServer_Push(t *testing.T) {
+	for _, version := range []uint16{proto.BodyProtocolVersionNormal, proto.BodyProtocolVersionZlib, proto.BodyProtocolVersionBrotli} {
+		srv := testserver.NewServer().WithAuthBody("auth").WithCompression(version)
+
+		danmu := make(chan string, 1)
+		gift := make(chan string, 1)
+		router := basic.NewEventRouter().
+			OnDanmu(func(data *proto.CmdDanmuData) { danmu <- data.Msg }).
+			OnGift(func(data *proto.CmdSendGiftData) { gift <- data.GiftName })
+
+		startClient(t, srv, "auth", router)
+		if conn := waitConn(t, srv); conn.AuthBody() != "auth" {
+			t.Fatalf("unexpected auth body %s", conn.AuthBody())
+		}
+
+		if err := srv.PushDanmu(&proto.CmdDanmuData{Msg: "hello"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := srv.PushGift(&proto.CmdSendGiftData{GiftName: "辣条"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if msg := <-danmu; msg != "hello" {
+			t.Fatalf("unexpected danmu %s, version %d", msg, version)
+		}
+		if name := <-gift; name != "辣条" {
+			t.Fatalf("unexpected gift %s, version %d", name, version)
+		}
+
+		srv.Close()
+	}
+}
+
+func TestServer_Heartbeat(t *testing.T) {
+	srv := testserver.NewServer()
+	defer srv.Close()
+
+	wsClient, _ := startClient(t, srv, "auth", basic.NewEventRouter())
+	waitConn(t, srv)
+
+	if err := wsClient.SendHeartbeat(); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second * 5)
+	for srv.Heartbeats() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("wait heartbeat timeout")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestServer_AuthFailed(t *testing.T) {
+	srv := testserver.NewServer().WithAuthBody("auth")
+	defer srv.Close()
+
+	_, closeCh := startClient(t, srv, "wrong", basic.NewEventRouter())
+	if closeType := waitClose(t, closeCh); closeType != basic.CloseAuthFailed {
+		t.Fatalf("unexpected close type %d", closeType)
+	}
+
+	srv.FailAuth(1)
+	_, closeCh = startClient(t, srv, "auth", basic.NewEventRouter())
+	if closeType := waitClose(t, closeCh); closeType != basic.CloseAuthFailed {
+		t.Fatalf("unexpected close type %d", closeType)
+	}
+
+	if bodies := srv.AuthBodies(); len(bodies) != 2 || bodies[0] != "wrong" || bodies[1] != "auth" {
+		t.Fatalf("unexpected auth bodies %v", bodies)
+	}
+}
+
+func TestServer_AuthIssuedBody(t *testing.T) {
+	srv := testserver.NewServer()
+	defer srv.Close()
+
+	// 未经 StartResp 签发的鉴权内容
+	startResp := &testserver.StartResp{AuthBody: "forged", Links: []string{srv.URL()}}
+	closeCh := make(chan int, 1)
+	wsClient, err := basic.StartWebsocket(startResp, nil, func(_ *basic.WsClient, _ basic.StartResp, closeType int) {
+		closeCh <- closeType
+	}, testLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wsClient.Close()
+
+	if closeType := waitClose(t, closeCh); closeType != basic.CloseAuthFailed {
+		t.Fatalf("unexpected close type %d", closeType)
+	}
+
+	_, issuedCloseCh := startClient(t, srv, "issued", basic.NewEventRouter())
+	if conn := waitConn(t, srv); conn.AuthBody() != "issued" {
+		t.Fatalf("unexpected auth body %s", conn.AuthBody())
+	}
+
+	select {
+	case closeType := <-issuedCloseCh:
+		t.Fatalf("unexpected close %d", closeType)
+	default:
+	}
+}
+
+func TestServer_Disconnect(t *testing.T) {
+	srv := testserver.NewServer()
+	defer srv.Close()
+
+	_, closeCh := startClient(t, srv, "auth", basic.NewEventRouter())
+	waitConn(t, srv)
+	srv.CloseConnections(websocket.CloseNormalClosure, "bye")
+	if closeType := waitClose(t, closeCh); closeType != basic.CloseReceivedShutdownMessage {
+		t.Fatalf("unexpected close type %d", closeType)
+	}
+
+	_, closeCh = startClient(t, srv, "auth", basic.NewEventRouter())
+	waitConn(t, srv)
+	srv.DropConnections()
+	if closeType := waitClose(t, closeCh); closeType != basic.CloseReadingConnError {
+		t.Fatalf("unexpected close type %d", closeType)
+	}
+}